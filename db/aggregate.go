@@ -0,0 +1,461 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Reducers of an aggregation, applied to the records of each group
+const (
+	ReduceCount         = "count"
+	ReduceCountDistinct = "count_distinct"
+	ReduceSum           = "sum"
+	ReduceAvg           = "avg"
+	ReduceMin           = "min"
+	ReduceMax           = "max"
+	ReduceStddev        = "stddev"
+	ReduceQuantile      = "quantile"
+)
+
+// Names given to the outputs of an aggregation, they are referred to as @name in RediSearch expressions
+var outputNameRegex = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// Reduces a column of each group to a single value named As
+// count needs no column, quantile needs Quantile between 0 and 1
+type Reducer struct {
+	Op       string  `json:"op"`
+	Col      string  `json:"col"`
+	Quantile float64 `json:"quantile"`
+	As       string  `json:"as"`
+
+	// made from the legacy operation field, which passes any RediSearch reducer through
+	legacy bool
+}
+
+// Returned when an aggregation request is invalid, nothing is aggregated
+type AggregationError struct {
+	Reason string `json:"reason"`
+}
+
+func (e *AggregationError) Error() string {
+	return fmt.Sprintf("invalid aggregation, %s", e.Reason)
+}
+
+func aggregationError(format string, a ...any) error {
+	return &AggregationError{Reason: fmt.Sprintf(format, a...)}
+}
+
+// Returns the name of the reducer's output
+func (r *Reducer) name() string {
+	if r.As != "" {
+		return r.As
+	}
+	if r.Op == ReduceCount {
+		return ReduceCount
+	}
+	if r.Op == ReduceQuantile {
+		// outputs are referred to as @name, so the decimal point is left out like any character outside outputNameRegex
+		q := strings.ReplaceAll(strconv.FormatFloat(r.Quantile, 'f', -1, 64), ".", "_")
+		return fmt.Sprintf("%s_%s_%s", r.Op, r.Col, q)
+	}
+	return fmt.Sprintf("%s_%s", r.Op, r.Col)
+}
+
+// Returns the reducers of the request, the legacy operation and column make a single reducer named {operation}_result
+// The legacy operation can be any RediSearch reducer taking a column, ex: tolist or first_value
+func (aggReq *AggRequest) reducers() []Reducer {
+	if aggReq.Operation == "" {
+		return aggReq.Reducers
+	}
+	op := strings.ToLower(aggReq.Operation)
+	r := Reducer{Op: op, Col: aggReq.Column, As: fmt.Sprintf("%s_result", aggReq.Operation), legacy: true}
+	if op == ReduceCount {
+		r.Col = ""
+	}
+	return []Reducer{r}
+}
+
+// Validates the groups, reducers, having, order by and limit of an aggregation request
+// Having and order by refer to the outputs, the group by columns and the reducer names
+func (schema *Schema) validateAggRequest(aggReq *AggRequest) error {
+	if aggReq.Operation != "" && len(aggReq.Reducers) > 0 {
+		return aggregationError("only one of operation and reducers can be given")
+	}
+	reducers := aggReq.reducers()
+	if len(reducers) == 0 {
+		return aggregationError("at least one reducer is required")
+	}
+	if aggReq.Limit < 0 || aggReq.Offset < 0 {
+		return aggregationError("limit and offset can't be negative")
+	}
+	if aggReq.Offset > 0 && aggReq.Limit == 0 {
+		return aggregationError("offset needs a limit")
+	}
+
+	outputs := make(map[string]bool)
+	for _, g := range aggReq.Groupby {
+		col, err := schema.getColumn(g)
+		if err != nil {
+			return aggregationError(err.Error())
+		}
+		if col.columnIndexFieldType() == "" {
+			return aggregationError("can't group by column %s, it must be searchable or filterable", g)
+		}
+		if outputs[g] {
+			return aggregationError("column %s is grouped by more than once", g)
+		}
+		outputs[g] = true
+	}
+	if aggReq.Bucket != nil {
+		if aggReq.Bucket.As != "" && !outputNameRegex.MatchString(aggReq.Bucket.As) {
+			return aggregationError("invalid output name %s, must only have letters, digits and _", aggReq.Bucket.As)
+		}
+		err := schema.validateTimeBucket(aggReq.Bucket, outputs)
+		if err != nil {
+			return err
+		}
+		outputs[aggReq.Bucket.name()] = true
+	}
+
+	for i := range reducers {
+		r := &reducers[i]
+		switch r.Op {
+		case ReduceCount:
+			if r.Col != "" {
+				return aggregationError("count takes no column")
+			}
+		case ReduceCountDistinct, ReduceSum, ReduceAvg, ReduceMin, ReduceMax, ReduceStddev, ReduceQuantile:
+			col, err := schema.getColumn(r.Col)
+			if err != nil {
+				return aggregationError(err.Error())
+			}
+			if col.columnIndexFieldType() == "" {
+				return aggregationError("can't reduce column %s, it must be searchable or filterable", r.Col)
+			}
+			if r.Op != ReduceCountDistinct && col.columnIndexFieldType() != "NUMERIC" {
+				return aggregationError("can't %s non-numeric column %s", r.Op, r.Col)
+			}
+		default:
+			if !r.legacy {
+				return aggregationError("invalid reducer %s", r.Op)
+			}
+			if _, err := schema.getColumn(r.Col); err != nil {
+				return aggregationError(err.Error())
+			}
+		}
+		if r.As != "" && !outputNameRegex.MatchString(r.As) {
+			return aggregationError("invalid output name %s, must only have letters, digits and _", r.As)
+		}
+		if r.Op == ReduceQuantile && (r.Quantile < 0 || r.Quantile > 1) {
+			return aggregationError("quantile must be between 0 and 1")
+		}
+		if r.Op != ReduceQuantile && r.Quantile != 0 {
+			return aggregationError("quantile is only valid for quantile reducers")
+		}
+		if outputs[r.name()] {
+			return aggregationError("output %s is given more than once", r.name())
+		}
+		outputs[r.name()] = true
+	}
+
+	for _, h := range aggReq.Having {
+		if !outputs[h.Col] {
+			return aggregationError("having on unknown output %s", h.Col)
+		}
+		switch h.Op {
+		case EqualTo, NotEqualTo, GreaterThan, GreaterThanOrEqual, LessThan, LessThanOrEqual:
+		default:
+			return aggregationError("having only supports eq, ne, gt, gte, lt and lte")
+		}
+		if len(h.Val) != 1 {
+			return aggregationError("having must have only 1 val")
+		}
+	}
+
+	for _, o := range aggReq.OrderBy {
+		if !outputs[o.Col] {
+			return aggregationError("order by unknown output %s", o.Col)
+		}
+		switch strings.ToLower(o.Order) {
+		case "", "asc", "desc":
+		default:
+			return aggregationError("invalid order %s, must be asc or desc", o.Order)
+		}
+	}
+
+	if aggReq.Query != nil {
+		err := schema.validateFilters(aggReq.Query.Filters)
+		if err != nil {
+			return aggregationError(err.Error())
+		}
+		if aggReq.Query.Where != nil {
+			err = schema.validateFilterExpr(aggReq.Query.Where)
+			if err != nil {
+				return aggregationError(err.Error())
+			}
+		}
+		if aggReq.Query.SearchTerm != "" && aggReq.Query.Search != nil {
+			return aggregationError("only one of searchTerm and search can be given")
+		}
+		if search := aggReq.Query.search(); search != nil {
+			err = schema.validateSearch(search)
+			if err != nil {
+				return aggregationError(err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the RediSearch range of a numeric filter
+func numericFilterRange(f Filter) string {
+	switch f.Op {
+	case GreaterThan:
+		return fmt.Sprintf("[(%s +inf]", f.Val[0])
+	case GreaterThanOrEqual:
+		return fmt.Sprintf("[%s +inf]", f.Val[0])
+	case LessThan:
+		return fmt.Sprintf("[-inf (%s]", f.Val[0])
+	case LessThanOrEqual:
+		return fmt.Sprintf("[-inf %s]", f.Val[0])
+	case Between:
+		lo, hi := f.Val[0], f.Val[1]
+		if f.Bounds != "" && f.Bounds[0] == '(' {
+			lo = "(" + lo
+		}
+		if f.Bounds != "" && f.Bounds[1] == ')' {
+			hi = "(" + hi
+		}
+		return fmt.Sprintf("[%s %s]", lo, hi)
+	}
+	return ""
+}
+
+// Returns the RediSearch query matching the records of a filter
+// The query depends on how the column is indexed, null checks can't be searched
+func (schema *Schema) filterSearchQuery(f Filter) (string, error) {
+	col, err := schema.getColumn(f.Col)
+	if err != nil {
+		return "", err
+	}
+	field := "@" + searchEscaper.Replace(col.Name)
+	fieldType := col.columnIndexFieldType()
+
+	switch f.Op {
+	case IsNull, IsNotNull:
+		return "", aggregationError("null checks on %s can't be aggregated", f.Col)
+	case GreaterThan, GreaterThanOrEqual, LessThan, LessThanOrEqual, Between:
+		if fieldType != "NUMERIC" {
+			return "", aggregationError("range filters on %s can't be aggregated, it is not numeric", f.Col)
+		}
+		for _, v := range f.Val {
+			if _, err := strconv.ParseFloat(v, 64); err != nil {
+				return "", aggregationError("value %s of %s is not a number", v, f.Col)
+			}
+		}
+		return field + ":" + numericFilterRange(f), nil
+	}
+
+	// equality and pattern filters
+	var q string
+	switch fieldType {
+	case "NUMERIC":
+		if f.Op == StartsWith || f.Op == Contains {
+			return "", aggregationError("prefix and contains filters on numeric column %s can't be aggregated", f.Col)
+		}
+		ranges := make([]string, 0, len(f.Val))
+		for _, v := range f.Val {
+			if _, err := strconv.ParseFloat(v, 64); err != nil {
+				return "", aggregationError("value %s of %s is not a number", v, f.Col)
+			}
+			ranges = append(ranges, fmt.Sprintf("%s:[%s %s]", field, v, v))
+		}
+		q = "(" + strings.Join(ranges, "|") + ")"
+	case "TAG":
+		vals := make([]string, 0, len(f.Val))
+		for _, v := range f.Val {
+			vals = append(vals, tagEscaper.Replace(v))
+		}
+		switch f.Op {
+		case StartsWith:
+			vals[0] += "*"
+		case Contains:
+			vals[0] = "*" + vals[0] + "*"
+		}
+		q = fmt.Sprintf("%s:{%s}", field, strings.Join(vals, "|"))
+	case "TEXT":
+		vals := make([]string, 0, len(f.Val))
+		for _, v := range f.Val {
+			words := strings.Fields(v)
+			for i, w := range words {
+				words[i] = searchEscaper.Replace(w)
+			}
+			switch f.Op {
+			case StartsWith:
+				vals = append(vals, strings.Join(words, " ")+"*")
+			case Contains:
+				vals = append(vals, "*"+strings.Join(words, " ")+"*")
+			default:
+				vals = append(vals, `"`+strings.Join(words, " ")+`"`)
+			}
+		}
+		q = fmt.Sprintf("%s:(%s)", field, strings.Join(vals, "|"))
+	default:
+		return "", aggregationError("filters on %s can't be aggregated, it must be searchable or filterable", f.Col)
+	}
+
+	if f.Op == NotEqualTo {
+		q = "-" + q
+	}
+	return q, nil
+}
+
+// Returns the RediSearch query of a filter tree
+func (schema *Schema) filterExprSearchQuery(expr *FilterExpr) (string, error) {
+	if expr.Col != "" {
+		return schema.filterSearchQuery(expr.Filter)
+	}
+	if expr.Not != nil {
+		q, err := schema.filterExprSearchQuery(expr.Not)
+		if err != nil {
+			return "", err
+		}
+		return "-(" + q + ")", nil
+	}
+
+	sep, children := " ", expr.And
+	if expr.Or != nil {
+		sep, children = " | ", expr.Or
+	}
+	parts := make([]string, 0, len(children))
+	for i := range children {
+		q, err := schema.filterExprSearchQuery(&children[i])
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, q)
+	}
+	return "(" + strings.Join(parts, sep) + ")", nil
+}
+
+// Returns the RediSearch query selecting the records of a query's filters, where tree and search
+func (schema *Schema) querySearchQuery(query *Query) (string, error) {
+	if query == nil {
+		return "*", nil
+	}
+	parts := make([]string, 0, len(query.Filters)+2)
+	for _, f := range query.Filters {
+		q, err := schema.filterSearchQuery(f)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, q)
+	}
+	if query.Where != nil {
+		q, err := schema.filterExprSearchQuery(query.Where)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, q)
+	}
+	if search := query.search(); search != nil {
+		parts = append(parts, "("+search.queryString()+")")
+	}
+	if len(parts) == 0 {
+		return "*", nil
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// Returns the FILTER expression of a having condition
+// Numbers are compared as numbers, other values as quoted strings
+func havingExpression(h Filter) string {
+	ops := map[FilterOp]string{
+		EqualTo:            "==",
+		NotEqualTo:         "!=",
+		GreaterThan:        ">",
+		GreaterThanOrEqual: ">=",
+		LessThan:           "<",
+		LessThanOrEqual:    "<=",
+	}
+	val := h.Val[0]
+	if _, err := strconv.ParseFloat(val, 64); err != nil {
+		val = "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(val) + "'"
+	}
+	return fmt.Sprintf("@%s %s %s", h.Col, ops[h.Op], val)
+}
+
+// Returns the FT.AGGREGATE arguments of a validated request
+// the query selects the records, followed by the GROUPBY with its REDUCE steps, a FILTER per having,
+// a SORTBY and a LIMIT
+// A time bucket is APPLYed to its loaded column and grouped by, having, order by and limit are then
+// left to finishAggregation as they apply to the gap filled series
+func (table *Table) aggregateArgs(aggReq *AggRequest) ([]any, error) {
+	q, err := table.Schema.querySearchQuery(aggReq.Query)
+	if err != nil {
+		return nil, err
+	}
+	args := []any{"FT.AGGREGATE", table.formatTableIndex(), q}
+
+	groupby := len(aggReq.Groupby)
+	if b := aggReq.Bucket; b != nil {
+		col, err := table.Schema.getColumn(b.Col)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "LOAD", 1, "@"+col.Name, "APPLY", b.applyExpression(col), "AS", b.name())
+		groupby++
+	}
+	args = append(args, "GROUPBY", groupby)
+	for _, g := range aggReq.Groupby {
+		args = append(args, "@"+g)
+	}
+	if aggReq.Bucket != nil {
+		args = append(args, "@"+aggReq.Bucket.name())
+	}
+	for _, r := range aggReq.reducers() {
+		args = append(args, "REDUCE", strings.ToUpper(r.Op))
+		switch r.Op {
+		case ReduceCount:
+			args = append(args, 0)
+		case ReduceQuantile:
+			args = append(args, 2, "@"+r.Col, strconv.FormatFloat(r.Quantile, 'f', -1, 64))
+		default:
+			args = append(args, 1, "@"+r.Col)
+		}
+		args = append(args, "AS", r.name())
+	}
+	if aggReq.Bucket != nil {
+		return args, nil
+	}
+
+	for _, h := range aggReq.Having {
+		args = append(args, "FILTER", havingExpression(h))
+	}
+
+	if len(aggReq.OrderBy) > 0 {
+		args = append(args, "SORTBY", 2*len(aggReq.OrderBy))
+		for _, o := range aggReq.OrderBy {
+			order := "ASC"
+			if o.isDesc() {
+				order = "DESC"
+			}
+			args = append(args, "@"+o.Col, order)
+		}
+		max := MaxSortedGroups
+		if aggReq.Limit > 0 {
+			max = aggReq.Offset + aggReq.Limit
+		}
+		args = append(args, "MAX", max)
+	}
+
+	if aggReq.Limit > 0 {
+		args = append(args, "LIMIT", aggReq.Offset, aggReq.Limit)
+	}
+	return args, nil
+}
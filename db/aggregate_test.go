@@ -0,0 +1,157 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func aggTestTable() Table {
+	return Table{
+		Name:    "sales",
+		Version: 1,
+		Schema: Schema{
+			Name: "sales",
+			Columns: []Column{
+				{Name: "region", DataType: "string", Filterable: true},
+				{Name: "name", DataType: "string", Searchable: true},
+				{Name: "amount", DataType: "float", Filterable: true, Sortable: true},
+				{Name: "note", DataType: "string"},
+			},
+		},
+	}
+}
+
+func TestAggregateArgs(t *testing.T) {
+	table := aggTestTable()
+
+	aggReq := AggRequest{
+		Groupby: []string{"region"},
+		Reducers: []Reducer{
+			{Op: ReduceCount},
+			{Op: ReduceSum, Col: "amount", As: "total"},
+			{Op: ReduceQuantile, Col: "amount", Quantile: 0.9},
+		},
+		Query: &Query{
+			Filters: []Filter{{Col: "amount", Op: GreaterThan, Val: []string{"10"}}},
+			Where: &FilterExpr{Or: []FilterExpr{
+				{Filter: Filter{Col: "region", Op: In, Val: []string{"North America", "EMEA"}}},
+				{Not: &FilterExpr{Filter: Filter{Col: "name", Op: EqualTo, Val: []string{"acme corp"}}}},
+			}},
+		},
+		Having:  []Filter{{Col: "count", Op: GreaterThanOrEqual, Val: []string{"2"}}},
+		OrderBy: []OrderBy{{Col: "total", Order: "desc"}},
+		Limit:   5,
+	}
+	// default names can be referred to in having and orderBy
+	if name := aggReq.Reducers[2].name(); !outputNameRegex.MatchString(name) {
+		t.Fatalf("Default name %s is not a valid output name", name)
+	}
+	err := table.Schema.validateAggRequest(&aggReq)
+	if err != nil {
+		t.Fatalf("Failed validating aggregation %s\n", err)
+	}
+	args, err := table.aggregateArgs(&aggReq)
+	if err != nil {
+		t.Fatalf("Failed building aggregation %s\n", err)
+	}
+	expected := []any{
+		"FT.AGGREGATE", table.formatTableIndex(),
+		`@amount:[(10 +inf] (@region:{North\ America|EMEA} | -(@name:("acme corp")))`,
+		"GROUPBY", 1, "@region",
+		"REDUCE", "COUNT", 0, "AS", "count",
+		"REDUCE", "SUM", 1, "@amount", "AS", "total",
+		"REDUCE", "QUANTILE", 2, "@amount", "0.9", "AS", "quantile_amount_0_9",
+		"FILTER", "@count >= 2",
+		"SORTBY", 2, "@total", "DESC", "MAX", 5,
+		"LIMIT", 0, 5,
+	}
+	if fmt.Sprint(args) != fmt.Sprint(expected) {
+		t.Fatalf("Expected args %v, got %v", expected, args)
+	}
+
+	// legacy requests keep their output name and run over every record
+	legacy := AggRequest{Operation: "SUM", Column: "amount", Groupby: []string{"region"}}
+	err = table.Schema.validateAggRequest(&legacy)
+	if err != nil {
+		t.Fatalf("Failed validating legacy aggregation %s\n", err)
+	}
+	args, err = table.aggregateArgs(&legacy)
+	if err != nil {
+		t.Fatalf("Failed building legacy aggregation %s\n", err)
+	}
+	expected = []any{"FT.AGGREGATE", table.formatTableIndex(), "*", "GROUPBY", 1, "@region", "REDUCE", "SUM", 1, "@amount", "AS", "SUM_result"}
+	if fmt.Sprint(args) != fmt.Sprint(expected) {
+		t.Fatalf("Expected args %v, got %v", expected, args)
+	}
+
+	// the legacy operation passes other RediSearch reducers through
+	tolist := AggRequest{Operation: "TOLIST", Column: "name", Groupby: []string{"region"}}
+	err = table.Schema.validateAggRequest(&tolist)
+	if err != nil {
+		t.Fatalf("Failed validating legacy reducer %s\n", err)
+	}
+	args, err = table.aggregateArgs(&tolist)
+	if err != nil {
+		t.Fatalf("Failed building legacy aggregation %s\n", err)
+	}
+	tolistArgs := []any{"FT.AGGREGATE", table.formatTableIndex(), "*", "GROUPBY", 1, "@region", "REDUCE", "TOLIST", 1, "@name", "AS", "TOLIST_result"}
+	if fmt.Sprint(args) != fmt.Sprint(tolistArgs) {
+		t.Fatalf("Expected args %v, got %v", tolistArgs, args)
+	}
+
+	// sorting without a limit still returns every group
+	legacy.OrderBy = []OrderBy{{Col: "SUM_result"}}
+	args, err = table.aggregateArgs(&legacy)
+	if err != nil {
+		t.Fatalf("Failed building sorted aggregation %s\n", err)
+	}
+	expected = append(expected, "SORTBY", 2, "@SUM_result", "ASC", "MAX", MaxSortedGroups)
+	if fmt.Sprint(args) != fmt.Sprint(expected) {
+		t.Fatalf("Expected args %v, got %v", expected, args)
+	}
+}
+
+func TestValidateAggRequest(t *testing.T) {
+	table := aggTestTable()
+
+	invalid := []AggRequest{
+		{Groupby: []string{"region"}},
+		{Operation: "count", Reducers: []Reducer{{Op: ReduceCount}}},
+		{Groupby: []string{"note"}, Reducers: []Reducer{{Op: ReduceCount}}},
+		{Reducers: []Reducer{{Op: ReduceSum, Col: "region"}}},
+		{Reducers: []Reducer{{Op: "median", Col: "amount"}}},
+		{Reducers: []Reducer{{Op: ReduceQuantile, Col: "amount", Quantile: 1.5}}},
+		{Reducers: []Reducer{{Op: ReduceCount}, {Op: ReduceCount}}},
+		{Reducers: []Reducer{{Op: ReduceCount}}, Having: []Filter{{Col: "total", Op: GreaterThan, Val: []string{"1"}}}},
+		{Reducers: []Reducer{{Op: ReduceCount}}, OrderBy: []OrderBy{{Col: "amount"}}},
+		{Reducers: []Reducer{{Op: ReduceCount}}, Offset: 10},
+		{Reducers: []Reducer{{Op: ReduceCount, As: "total revenue"}}},
+		{Reducers: []Reducer{{Op: ReduceCount, As: "n) @x"}}},
+		{Reducers: []Reducer{{Op: ReduceCount}}, Query: &Query{Filters: []Filter{{Col: "missing", Op: EqualTo, Val: []string{"a"}}}}},
+	}
+	for _, aggReq := range invalid {
+		err := table.Schema.validateAggRequest(&aggReq)
+		var aerr *AggregationError
+		if !errors.As(err, &aerr) {
+			t.Fatalf("Expected an aggregation error for %v, got %v", aggReq, err)
+		}
+	}
+
+	// null checks can't be searched
+	aggReq := AggRequest{
+		Reducers: []Reducer{{Op: ReduceCount}},
+		Query:    &Query{Filters: []Filter{{Col: "region", Op: IsNull}}},
+	}
+	err := table.Schema.validateAggRequest(&aggReq)
+	if err != nil {
+		t.Fatalf("Failed validating aggregation %s\n", err)
+	}
+	_, err = table.aggregateArgs(&aggReq)
+	if err == nil {
+		t.Fatalf("Not failing for null check in aggregation")
+	}
+}
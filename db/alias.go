@@ -0,0 +1,184 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrAliasConflict = errors.New("name is already used by a table or alias")
+)
+
+// An alias is a name that resolves to a real table
+// Aliases are stored in a single hash of alias name -> table name
+type Alias struct {
+	Name  string `json:"name"`
+	Table string `json:"table"`
+}
+
+// Body of alias create and swap requests
+// Expected optionally guards a swap against a concurrent change
+type AliasRequest struct {
+	Table    string `json:"table" binding:"required"`
+	Expected string `json:"expected"`
+}
+
+// Returns the table an alias points to, or name itself if it is not an alias
+// an alias to a table that no longer exists is rejected with ErrNil
+func (db *Database) resolveTableName(name string) (string, error) {
+	table, err := db.Client.HGet(Ctx, formatAliasesKey(), name).Result()
+	if err == redis.Nil {
+		return name, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	n, err := db.Client.Exists(Ctx, formatSchemaKey(table)).Result()
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return "", ErrNil
+	}
+	return table, nil
+}
+
+// Checks the table exists, aliases only point to real tables so they are never chained
+func (db *Database) validateAliasTarget(tx *redis.Tx, table string) error {
+	if table == "" {
+		return ErrEmptyKey
+	}
+	n, err := tx.Exists(Ctx, formatSchemaKey(table)).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New(fmt.Sprintf("table %s does not exist", table))
+	}
+	return nil
+}
+
+// Runs fn in a transaction that fails if the aliases or any of the schema keys change
+func (db *Database) aliasTx(fn func(tx *redis.Tx) error, names ...string) error {
+	keys := []string{formatAliasesKey()}
+	for _, name := range names {
+		keys = append(keys, formatSchemaKey(name))
+	}
+	err := db.Client.Watch(Ctx, fn, keys...)
+	if err == redis.TxFailedErr {
+		return errors.New("aliases were modified concurrently, try again")
+	}
+	return err
+}
+
+// AddAlias creates a new alias pointing to table
+// the alias name can't be used by a table or another alias
+func (db *Database) AddAlias(name string, table string) error {
+	if name == "" {
+		return ErrEmptyKey
+	}
+	return db.aliasTx(func(tx *redis.Tx) error {
+		n, err := tx.Exists(Ctx, formatSchemaKey(name)).Result()
+		if err != nil {
+			return err
+		}
+		found, err := tx.HExists(Ctx, formatAliasesKey(), name).Result()
+		if err != nil {
+			return err
+		}
+		if n > 0 || found {
+			return ErrAliasConflict
+		}
+		err = db.validateAliasTarget(tx, table)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(Ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(Ctx, formatAliasesKey(), name, table)
+			return nil
+		})
+		return err
+	}, name, table)
+}
+
+// SwapAlias atomically points an existing alias to table
+// if expected is not empty, the swap only happens if the alias currently points to expected
+// returns the table the alias pointed to before the swap
+func (db *Database) SwapAlias(name string, table string, expected string) (string, error) {
+	var previous string
+	err := db.aliasTx(func(tx *redis.Tx) error {
+		var err error
+		previous, err = tx.HGet(Ctx, formatAliasesKey(), name).Result()
+		if err == redis.Nil {
+			return ErrNil
+		}
+		if err != nil {
+			return err
+		}
+		if expected != "" && previous != expected {
+			return errors.New(fmt.Sprintf("alias %s points to %s, not %s", name, previous, expected))
+		}
+		err = db.validateAliasTarget(tx, table)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(Ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(Ctx, formatAliasesKey(), name, table)
+			return nil
+		})
+		return err
+	}, table)
+	if err != nil {
+		return "", err
+	}
+	return previous, nil
+}
+
+// GetAlias returns the alias with the given name
+func (db *Database) GetAlias(name string) (*Alias, error) {
+	if name == "" {
+		return nil, ErrEmptyKey
+	}
+	table, err := db.Client.HGet(Ctx, formatAliasesKey(), name).Result()
+	if err == redis.Nil {
+		return nil, ErrNil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Alias{Name: name, Table: table}, nil
+}
+
+// GetAllAliases returns every alias
+func (db *Database) GetAllAliases() ([]Alias, error) {
+	all, err := db.Client.HGetAll(Ctx, formatAliasesKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+	aliases := make([]Alias, 0, len(all))
+	for name, table := range all {
+		aliases = append(aliases, Alias{Name: name, Table: table})
+	}
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i].Name < aliases[j].Name })
+	return aliases, nil
+}
+
+// DeleteAlias removes an alias, the table it points to is untouched
+func (db *Database) DeleteAlias(name string) error {
+	n, err := db.Client.HDel(Ctx, formatAliasesKey(), name).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNil
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAliasSwap(t *testing.T) {
+	mr := newMiniRedis(t)
+
+	for _, name := range []string{"sales_v1", "sales_v2"} {
+		schema := Schema{
+			Name:    name,
+			Columns: []Column{{Name: "region", DataType: "string", Filterable: true}},
+		}
+		err := mr.AddSchema(&schema)
+		if err != nil {
+			t.Fatalf("Failed adding schema %s\n", err)
+		}
+	}
+	err := mr.BulkLoad("sales_v1", strings.NewReader("region\nEMEA\n"), "csv")
+	if err != nil {
+		t.Fatalf("Failed loading data %s\n", err)
+	}
+	err = mr.BulkLoad("sales_v2", strings.NewReader("region\nAMER\nAPAC\n"), "csv")
+	if err != nil {
+		t.Fatalf("Failed loading data %s\n", err)
+	}
+
+	err = mr.AddAlias("sales", "sales_v1")
+	if err != nil {
+		t.Fatalf("Failed adding alias %s\n", err)
+	}
+	data, err := mr.GetData("sales", Query{})
+	if err != nil || len(data.Records) != 1 {
+		t.Fatalf("Expected 1 record through alias, got %v %v", data, err)
+	}
+
+	// swap guarded by the expected table
+	_, err = mr.SwapAlias("sales", "sales_v2", "sales_v3")
+	if err == nil {
+		t.Fatalf("Not failing for swap with wrong expected table")
+	}
+	previous, err := mr.SwapAlias("sales", "sales_v2", "sales_v1")
+	if err != nil || previous != "sales_v1" {
+		t.Fatalf("Failed swapping alias %s %s\n", previous, err)
+	}
+	data, err = mr.GetData("sales", Query{})
+	if err != nil || len(data.Records) != 2 {
+		t.Fatalf("Expected 2 records after swap, got %v %v", data, err)
+	}
+	schema, err := mr.GetSchema("sales")
+	if err != nil || schema.Name != "sales_v2" {
+		t.Fatalf("Expected schema of sales_v2 through alias, got %v %v", schema, err)
+	}
+
+	// names are shared between tables and aliases
+	err = mr.AddAlias("sales_v1", "sales_v2")
+	if err != ErrAliasConflict {
+		t.Fatalf("Not failing for alias with a table name")
+	}
+	err = mr.AddSchema(&Schema{Name: "sales", Columns: []Column{{Name: "a", DataType: "string"}}})
+	if err != ErrAliasConflict {
+		t.Fatalf("Not failing for table with an alias name")
+	}
+	err = mr.AddAlias("other", "missing")
+	if err == nil {
+		t.Fatalf("Not failing for alias to a missing table")
+	}
+	_, err = mr.SwapAlias("missing", "sales_v1", "")
+	if err != ErrNil {
+		t.Fatalf("Not failing for swap of a missing alias")
+	}
+
+	err = mr.DeleteAlias("sales")
+	if err != nil {
+		t.Fatalf("Failed deleting alias %s\n", err)
+	}
+	aliases, err := mr.GetAllAliases()
+	if err != nil || len(aliases) != 0 {
+		t.Fatalf("Expected no aliases, got %v", aliases)
+	}
+
+	// an alias to a table dropped from redis is rejected
+	err = mr.AddAlias("old", "sales_v1")
+	if err != nil {
+		t.Fatalf("Failed adding alias %s\n", err)
+	}
+	mr.Client.Del(Ctx, formatSchemaKey("sales_v1"))
+	_, err = mr.GetSchema("old")
+	if err != ErrNil {
+		t.Fatalf("Expected ErrNil for alias to a dropped table, got %v", err)
+	}
+	_, err = mr.GetData("old", Query{})
+	if err != ErrNil {
+		t.Fatalf("Expected ErrNil reading through alias to a dropped table, got %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// How long a cached query result is kept after it was last used
+	QueryCacheTTL = time.Minute
+)
+
+// Returns a copy of the filter with the values of set operators sorted and deduplicated
+// so the same filter always hashes the same
+func normalizeFilter(f Filter) Filter {
+	switch f.Op {
+	case EqualTo, In, NotEqualTo:
+	default:
+		return f
+	}
+	vals := make([]string, 0, len(f.Val))
+	seen := make(map[string]bool, len(f.Val))
+	for _, v := range f.Val {
+		if !seen[v] {
+			seen[v] = true
+			vals = append(vals, v)
+		}
+	}
+	sort.Strings(vals)
+	f.Val = vals
+	return f
+}
+
+// Sorts a list of json encoded nodes, the order of and'ed or or'ed nodes does not matter
+func sortedJSON(nodes []json.RawMessage) []json.RawMessage {
+	sort.Slice(nodes, func(i, j int) bool { return string(nodes[i]) < string(nodes[j]) })
+	return nodes
+}
+
+// Returns the normalized json encoding of a filter tree
+func normalizeFilterExpr(expr *FilterExpr) (json.RawMessage, error) {
+	if expr.Col != "" {
+		return json.Marshal(normalizeFilter(expr.Filter))
+	}
+	if expr.Not != nil {
+		child, err := normalizeFilterExpr(expr.Not)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]json.RawMessage{"not": child})
+	}
+
+	op, children := "and", expr.And
+	if expr.Or != nil {
+		op, children = "or", expr.Or
+	}
+	nodes := make([]json.RawMessage, 0, len(children))
+	for i := range children {
+		child, err := normalizeFilterExpr(&children[i])
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, child)
+	}
+	return json.Marshal(map[string][]json.RawMessage{op: sortedJSON(nodes)})
+}
+
+// Returns the hash of the parts of a query that select records, filters are and'ed so their order does not matter
+func queryCacheHash(query Query) (string, error) {
+	filters := make([]json.RawMessage, 0, len(query.Filters))
+	for _, f := range query.Filters {
+		data, err := json.Marshal(normalizeFilter(f))
+		if err != nil {
+			return "", err
+		}
+		filters = append(filters, data)
+	}
+	normalized := map[string]any{"filters": sortedJSON(filters)}
+	if query.Where != nil {
+		where, err := normalizeFilterExpr(query.Where)
+		if err != nil {
+			return "", err
+		}
+		normalized["where"] = where
+	}
+
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha1.Sum(data)), nil
+}
+
+// Returns the key to the filtered records of a query, from the cache if the same query already ran
+// Cached results are keyed by the table version and its generation, which every record mutation increments,
+// so results of older versions or generations are never read again and expire
+func (db *Database) getCachedRecordKeys(table Table, query Query) (string, error) {
+	generation, err := db.Client.Get(Ctx, table.formatGenerationKey()).Int64()
+	if err != nil && err != redis.Nil {
+		return "", err
+	}
+	hash, err := queryCacheHash(query)
+	if err != nil {
+		return "", err
+	}
+	cacheKey := table.formatQueryCacheKey(generation, hash)
+
+	// a successful EXPIRE is a hit and keeps the result for another TTL
+	hit, err := db.Client.Expire(Ctx, cacheKey, QueryCacheTTL).Result()
+	if err != nil || hit {
+		return cacheKey, err
+	}
+
+	finalKey, err := db.getFilteredRecordKeys(table, query.Filters, query.Where)
+	if err != nil {
+		return "", err
+	}
+	// an empty result is not stored, so there is nothing to cache
+	n, err := db.Client.Exists(Ctx, finalKey).Result()
+	if err != nil || n == 0 {
+		return finalKey, err
+	}
+	err = db.Client.Rename(Ctx, finalKey, cacheKey).Err()
+	if err != nil {
+		return "", err
+	}
+	return cacheKey, db.Client.Expire(Ctx, cacheKey, QueryCacheTTL).Err()
+}
+
+// Invalidates the cached query results of a table
+func invalidateQueryCacheToPipe(table Table, pipe *redis.Pipeliner) {
+	(*pipe).Incr(Ctx, table.formatGenerationKey())
+}
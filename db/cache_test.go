@@ -0,0 +1,72 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQueryCache(t *testing.T) {
+	mr := newMiniRedis(t)
+
+	tableName, err := mr.loadXPPTestData()
+	if err != nil {
+		t.Fatalf("Failed loading xpp test data %s\n", err)
+	}
+	table, err := mr.getTable(tableName)
+	if err != nil {
+		t.Fatalf("Failed getting table %s\n", err)
+	}
+
+	query := Query{Filters: []Filter{
+		{Col: "col3_string", Op: In, Val: []string{"AMER", "EMEA"}},
+		{Col: "col4_int", Op: GreaterThan, Val: []string{"0"}},
+	}}
+	// same filters in another order
+	reordered := Query{Filters: []Filter{
+		{Col: "col4_int", Op: GreaterThan, Val: []string{"0"}},
+		{Col: "col3_string", Op: In, Val: []string{"EMEA", "AMER", "EMEA"}},
+	}}
+
+	first, err := mr.getQueryKey(table, query)
+	if err != nil {
+		t.Fatalf("Failed getting query key %s\n", err)
+	}
+	second, err := mr.getQueryKey(table, reordered)
+	if err != nil {
+		t.Fatalf("Failed getting query key %s\n", err)
+	}
+	if first != second || !strings.Contains(first, ":querycache:") {
+		t.Fatalf("Expected normalized queries to share a cache key, got %s and %s", first, second)
+	}
+	ttl, err := mr.Client.TTL(Ctx, first).Result()
+	if err != nil || ttl <= 0 {
+		t.Fatalf("Expected a ttl on the cached result, got %v %v", ttl, err)
+	}
+	data, err := mr.GetData(tableName, query)
+	if err != nil {
+		t.Fatalf("Failed getting data %s\n", err)
+	}
+	total := data.Metadata.ResultSet.Total
+
+	// mutations invalidate the cache
+	_, err = mr.CreateRecord(tableName, strings.NewReader(`{"records": [
+		{"col2_string": "company99", "col1_int": "1", "col3_string": "EMEA", "col4_int": "5"}
+	]}`))
+	if err != nil {
+		t.Fatalf("Failed creating record %s\n", err)
+	}
+	third, err := mr.getQueryKey(table, query)
+	if err != nil {
+		t.Fatalf("Failed getting query key %s\n", err)
+	}
+	if third == first {
+		t.Fatalf("Expected a new cache key after a mutation, got %s", third)
+	}
+	data, err = mr.GetData(tableName, query)
+	if err != nil || data.Metadata.ResultSet.Total != total+1 {
+		t.Fatalf("Expected %d records after create, got %v %v", total+1, data.Metadata, err)
+	}
+}
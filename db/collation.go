@@ -0,0 +1,179 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Collations of sortable string columns
+// binary compares the bytes of the values, nocase compares lower cased values
+// and breaks ties between values that only differ in case by their bytes
+const (
+	CollationBinary = "binary"
+	CollationNoCase = "nocase"
+)
+
+// Separates the collation key from the value in the members of a string column's sorted set
+// Values sort by their collation key first, so ranges only need the key
+const collationSeparator = "\x00"
+
+func validateCollation(col *Column) error {
+	switch col.Collation {
+	case "":
+		return nil
+	case CollationBinary, CollationNoCase:
+		if col.DataType != "string" {
+			return errors.New(fmt.Sprintf("invalid schema %s collation is only valid for string columns", col.Name))
+		}
+		return nil
+	default:
+		return errors.New(fmt.Sprintf("invalid schema %s collation must be %s or %s", col.Name, CollationBinary, CollationNoCase))
+	}
+}
+
+// Returns the key values of the column are compared by
+func (col *Column) collationKey(val string) string {
+	if col.Collation == CollationNoCase {
+		return strings.ToLower(val)
+	}
+	return val
+}
+
+// Returns the member of a string value in the column's sorted set, all members have score 0
+func (col *Column) lexMember(val string) string {
+	return col.collationKey(val) + collationSeparator + val
+}
+
+// Returns the value of a member of a string column's sorted set
+func lexMemberValue(member string) string {
+	_, val, _ := strings.Cut(member, collationSeparator)
+	return val
+}
+
+// Compares two values of a column, numbers by value and strings by the column's collation
+func (col *Column) compareValues(a, b string) int {
+	if col.DataType == "string" {
+		if c := strings.Compare(col.collationKey(a), col.collationKey(b)); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	}
+	return compareFloatStrings(a, b)
+}
+
+// Returns the ZRANGEBYLEX range of a range filter on a string column
+// A member is key + separator + value, so every member with the key itself sorts
+// between key and key + "\x01"
+func (col *Column) lexRange(f Filter) redis.ZRangeBy {
+	r := redis.ZRangeBy{Min: "-", Max: "+"}
+	below := func(v string) string { return "(" + col.collationKey(v) }
+	through := func(v string) string { return "(" + col.collationKey(v) + "\x01" }
+
+	switch f.Op {
+	case GreaterThan:
+		r.Min = through(f.Val[0])
+	case LessThan:
+		r.Max = below(f.Val[0])
+	case GreaterThanOrEqual:
+		r.Min = below(f.Val[0])
+	case LessThanOrEqual:
+		r.Max = through(f.Val[0])
+	case Between:
+		r.Min = below(f.Val[0])
+		r.Max = through(f.Val[1])
+		if f.Bounds != "" && f.Bounds[0] == '(' {
+			r.Min = through(f.Val[0])
+		}
+		if f.Bounds != "" && f.Bounds[1] == ')' {
+			r.Max = below(f.Val[1])
+		}
+	}
+	return r
+}
+
+// Makes sure the column's order set is built, string values have no numeric score
+// so records are scored by the rank of their value in the column's sorted set instead
+// Writes to a string column drop the order set and it is rebuilt here on the next order by
+// Each build has its own temporary key and is only renamed to the order set if no record changed meanwhile
+func (db *Database) ensureStringOrder(table Table, col *Column) error {
+	orderKey := table.formatOrderKey(col.Name)
+	n, err := db.Client.Exists(Ctx, orderKey).Result()
+	if err != nil || n > 0 {
+		return err
+	}
+
+	generationKey := table.formatGenerationKey()
+	generation, err := db.Client.Get(Ctx, generationKey).Int64()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	members, err := db.Client.ZRange(Ctx, table.formatSortableKey(col.Name), 0, -1).Result()
+	if err != nil || len(members) == 0 {
+		return err
+	}
+
+	// a weighted ZUNIONSTORE of the filter sets scores each record by the rank of its value
+	tmpKey := table.formatOrderStoreKey(col.Name, "build", time.Now().String())
+	defer db.deleteTempKeys(tmpKey)
+	filterKeys := make([]string, 0, len(members))
+	for _, m := range members {
+		filterKeys = append(filterKeys, table.formatFilterKey(col.Name, lexMemberValue(m)))
+	}
+	for i, chunk := range chunkKeys(filterKeys) {
+		keys := make([]string, 0, len(chunk)+1)
+		weights := make([]float64, 0, len(chunk)+1)
+		if i > 0 {
+			keys = append(keys, tmpKey)
+			weights = append(weights, 1)
+		}
+		for j, k := range chunk {
+			keys = append(keys, k)
+			weights = append(weights, float64(i*MaxStoreKeys+j))
+		}
+		_, err = db.Client.ZUnionStore(Ctx, tmpKey, &redis.ZStore{Keys: keys, Weights: weights}).Result()
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			err = db.expireTempKeys(tmpKey)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// a write during the build changed the generation and may have dropped the order set, the build is stale
+	err = db.Client.Watch(Ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(Ctx, generationKey).Int64()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if current != generation {
+			return redis.TxFailedErr
+		}
+		_, err = tx.TxPipelined(Ctx, func(pipe redis.Pipeliner) error {
+			pipe.Rename(Ctx, tmpKey, orderKey)
+			pipe.Persist(Ctx, orderKey)
+			return nil
+		})
+		return err
+	}, generationKey)
+	if err == redis.TxFailedErr {
+		return errors.New(fmt.Sprintf("records changed while ordering by %s, try again", col.Name))
+	}
+	return err
+}
+
+// Drops the order set of a sortable string column after its values change
+func invalidateStringOrderToPipe(table Table, pipe *redis.Pipeliner, col *Column) {
+	if col.Sortable && col.DataType == "string" {
+		(*pipe).Del(Ctx, table.formatOrderKey(col.Name))
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Returned when the conditions of a record request are invalid, nothing is searched
+type ConditionError struct {
+	Column string `json:"column"`
+	Reason string `json:"reason"`
+}
+
+func (e *ConditionError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("invalid conditions, %s", e.Reason)
+	}
+	return fmt.Sprintf("invalid condition on column %s, %s", e.Column, e.Reason)
+}
+
+// Escapes a tag value, spaces are also separators in tag queries
+var tagEscaper = newSearchEscaper(" ")
+
+// Returns the RediSearch query matching records with the value of a condition's column
+// Numeric columns match a single value range, tags match exactly and text columns match the value as a phrase
+func (schema *Schema) conditionQuery(condition Condition) (string, error) {
+	col, err := schema.getColumn(condition.Column)
+	if err != nil {
+		return "", &ConditionError{Column: condition.Column, Reason: "column not found in schema"}
+	}
+	field := "@" + searchEscaper.Replace(col.Name)
+
+	switch col.columnIndexFieldType() {
+	case "NUMERIC":
+		f, err := strconv.ParseFloat(condition.Value, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return "", &ConditionError{Column: col.Name, Reason: fmt.Sprintf("value %s is not a number", condition.Value)}
+		}
+		v := strconv.FormatFloat(f, 'f', -1, 64)
+		return fmt.Sprintf("%s:[%s %s]", field, v, v), nil
+	case "TAG":
+		if condition.Value == "" {
+			return "", &ConditionError{Column: col.Name, Reason: "value can't be empty"}
+		}
+		return fmt.Sprintf("%s:{%s}", field, tagEscaper.Replace(condition.Value)), nil
+	case "TEXT":
+		words := strings.Fields(condition.Value)
+		if len(words) == 0 {
+			return "", &ConditionError{Column: col.Name, Reason: "value can't be empty"}
+		}
+		for i, w := range words {
+			words[i] = searchEscaper.Replace(w)
+		}
+		return fmt.Sprintf(`%s:"%s"`, field, strings.Join(words, " ")), nil
+	default:
+		return "", &ConditionError{Column: col.Name, Reason: "column is not indexed, it must be searchable or filterable"}
+	}
+}
+
+// Returns true if the record has the exact value of every condition on a text column
+func (schema *Schema) matchesTextConditions(record map[string]string, conditions []Condition) bool {
+	for _, c := range conditions {
+		col, err := schema.getColumn(c.Column)
+		if err != nil {
+			return false
+		}
+		if col.columnIndexFieldType() == "TEXT" && record[col.Name] != c.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the RediSearch query matching records with all of the conditions
+func (schema *Schema) conditionsQuery(conditions []Condition) (string, error) {
+	if len(conditions) == 0 {
+		return "", &ConditionError{Reason: "at least one condition is required"}
+	}
+	parts := make([]string, 0, len(conditions))
+	for _, c := range conditions {
+		q, err := schema.conditionQuery(c)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, q)
+	}
+	return strings.Join(parts, " "), nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestConditionsQuery(t *testing.T) {
+	schema := Schema{
+		Name: "companies",
+		Columns: []Column{
+			{Name: "name", DataType: "string", Searchable: true},
+			{Name: "region", DataType: "string", Filterable: true},
+			{Name: "size", DataType: "int", Filterable: true},
+			{Name: "note", DataType: "string"},
+		},
+	}
+
+	tests := []struct {
+		conditions []Condition
+		expected   string
+	}{
+		{[]Condition{{"name", "acme corp"}}, `@name:"acme corp"`},
+		{[]Condition{{"name", "a-b (c)"}}, `@name:"a\-b \(c\)"`},
+		{[]Condition{{"region", "North America"}}, `@region:{North\ America}`},
+		{[]Condition{{"region", "a|b}"}}, `@region:{a\|b\}}`},
+		{[]Condition{{"region", "a, b"}}, `@region:{a\,\ b}`},
+		{[]Condition{{"size", "10"}}, `@size:[10 10]`},
+		{[]Condition{{"size", "-2.5"}, {"region", "EMEA"}}, `@size:[-2.5 -2.5] @region:{EMEA}`},
+	}
+	for _, test := range tests {
+		q, err := schema.conditionsQuery(test.conditions)
+		if err != nil {
+			t.Fatalf("Failed building query for %v %s\n", test.conditions, err)
+		}
+		if q != test.expected {
+			t.Fatalf("Expected query %s for %v, got %s", test.expected, test.conditions, q)
+		}
+	}
+
+	invalid := [][]Condition{
+		{},
+		{{"missing", "a"}},
+		{{"note", "a"}},
+		{{"size", "ten"}},
+		{{"size", "NaN"}},
+		{{"name", "  "}},
+		{{"region", "EMEA"}, {"size", "1 OR 1"}},
+	}
+	for _, conditions := range invalid {
+		_, err := schema.conditionsQuery(conditions)
+		var cerr *ConditionError
+		if !errors.As(err, &cerr) {
+			t.Fatalf("Expected a condition error for %v, got %v", conditions, err)
+		}
+	}
+}
+
+func TestCreateIndexArgs(t *testing.T) {
+	table := Table{Schema: Schema{
+		Name: "companies",
+		Columns: []Column{
+			{Name: "name", DataType: "string", Searchable: true},
+			{Name: "region", DataType: "string", Filterable: true},
+			{Name: "size", DataType: "int", Filterable: true, Sortable: true},
+		},
+	}}
+	args := table.createIndexArgs()
+	// tags are whole values, "a, b" must not be split on its comma
+	expected := []any{"name", "TEXT", "region", "TAG", "SEPARATOR", "\x1f", "CASESENSITIVE", "size", "NUMERIC", "SORTABLE"}
+	if !reflect.DeepEqual(args[len(args)-len(expected):], expected) {
+		t.Fatalf("Expected fields %q, got %q", expected, args)
+	}
+}
+
+func TestExactMatches(t *testing.T) {
+	schema := Schema{
+		Name: "companies",
+		Columns: []Column{
+			{Name: "name", DataType: "string", Searchable: true},
+			{Name: "region", DataType: "string", Filterable: true},
+		},
+	}
+	// the phrase search of "acme corp" also finds records that contain it
+	results := []interface{}{
+		"r:1", []interface{}{"name", "acme corp", "region", "EMEA"},
+		"r:2", []interface{}{"name", "acme corp international", "region", "EMEA"},
+		"r:3", []interface{}{"name", "Acme Corp", "region", "EMEA"},
+	}
+	keys, records := schema.exactMatches(results, []Condition{{"name", "acme corp"}, {"region", "EMEA"}})
+	if !reflect.DeepEqual(keys, []string{"r:1"}) || len(records) != 1 || records[0]["name"] != "acme corp" {
+		t.Fatalf("Expected only r:1 to match, got %v %v", keys, records)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"unicode/utf8"
+)
+
+const (
+	// Max number of violations kept in a ValidationError, the rest are only counted
+	MaxViolations = 100
+)
+
+// A column constraint that a row failed
+// Row is the 0 based index of the record in the request, Key is set when updating existing records
+type Violation struct {
+	Row    int     `json:"row"`
+	Key    string  `json:"key,omitempty"`
+	Column string  `json:"column"`
+	Value  *string `json:"value"`
+	Reason string  `json:"reason"`
+}
+
+// Returned when records violate column constraints, nothing is written
+type ValidationError struct {
+	Total      int         `json:"total"`
+	Violations []Violation `json:"violations"`
+}
+
+func (e *ValidationError) Error() string {
+	v := e.Violations[0]
+	return fmt.Sprintf("%d constraint violations, row %d column %s %s", e.Total, v.Row, v.Column, v.Reason)
+}
+
+// Adds a violation, only the first MaxViolations are kept
+func (e *ValidationError) add(v Violation) {
+	e.Total++
+	if len(e.Violations) < MaxViolations {
+		e.Violations = append(e.Violations, v)
+	}
+}
+
+// Returns the error if there were any violations, otherwise nil
+func (e *ValidationError) err() error {
+	if e.Total == 0 {
+		return nil
+	}
+	return e
+}
+
+// Checks values against the constraints of a schema's columns
+// Patterns are compiled once so a checker is built per request
+type constraintChecker struct {
+	schema   *Schema
+	patterns map[string]*regexp.Regexp
+	errs     ValidationError
+}
+
+func newConstraintChecker(schema *Schema) (*constraintChecker, error) {
+	c := constraintChecker{
+		schema:   schema,
+		patterns: make(map[string]*regexp.Regexp),
+	}
+	for _, col := range schema.Columns {
+		if col.Pattern == "" {
+			continue
+		}
+		// patterns must match the whole value
+		re, err := regexp.Compile("^(?:" + col.Pattern + ")$")
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid pattern for column %s: %s", col.Name, err))
+		}
+		c.patterns[col.Name] = re
+	}
+	return &c, nil
+}
+
+// Validates the constraints themselves when a schema is added
+func validateConstraints(schema *Schema) error {
+	for _, col := range schema.Columns {
+		if col.Min != nil && col.Max != nil && *col.Min > *col.Max {
+			return errors.New(fmt.Sprintf("invalid schema %s min is greater than max", col.Name))
+		}
+		if col.MaxLength != nil && *col.MaxLength < 0 {
+			return errors.New(fmt.Sprintf("invalid schema %s maxLength is negative", col.Name))
+		}
+	}
+	_, err := newConstraintChecker(schema)
+	return err
+}
+
+// Returns why a stored value violates the column's constraints, or "" if it doesn't
+// null is true when the value is stored as null
+func (c *constraintChecker) checkValue(col *Column, val string, null bool) string {
+	if null || val == "" {
+		if col.Required {
+			return "is required"
+		}
+		return ""
+	}
+
+	if col.Min != nil || col.Max != nil {
+		n, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return "is not a number"
+		}
+		if col.Min != nil && n < *col.Min {
+			return fmt.Sprintf("is less than min %v", *col.Min)
+		}
+		if col.Max != nil && n > *col.Max {
+			return fmt.Sprintf("is greater than max %v", *col.Max)
+		}
+	}
+	if col.MaxLength != nil && utf8.RuneCountInString(val) > *col.MaxLength {
+		return fmt.Sprintf("is longer than maxLength %d", *col.MaxLength)
+	}
+	if re, ok := c.patterns[col.Name]; ok && !re.MatchString(val) {
+		return fmt.Sprintf("does not match pattern %s", col.Pattern)
+	}
+	if len(col.Enum) > 0 {
+		found := false
+		for _, e := range col.Enum {
+			if e == val {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "is not one of the allowed values"
+		}
+	}
+	return ""
+}
+
+// Checks a single value and records a violation for row, returns false if it was violated
+func (c *constraintChecker) check(row int, key string, col *Column, val string, null bool) bool {
+	reason := c.checkValue(col, val, null)
+	if reason == "" {
+		return true
+	}
+	v := Violation{Row: row, Key: key, Column: col.Name, Reason: reason}
+	if !null {
+		v.Value = &val
+	}
+	c.errs.add(v)
+	return false
+}
+
+// Checks a csv row the same way recordToPipe loads it, returns false if any constraint was violated
+func (c *constraintChecker) checkCSVRecord(row int, record []string, headerMap map[int]string, schemaMap map[string]int, opts LoadOptions) bool {
+	ok := true
+	for i, raw := range record {
+		col := &c.schema.Columns[schemaMap[headerMap[i]]]
+		val, notNull := col.resolveValue(raw, opts.isNull(i, raw))
+		ok = c.check(row, "", col, val, !notNull) && ok
+	}
+	// missing columns are loaded as null cells
+	for i := range c.schema.Columns {
+		col := &c.schema.Columns[i]
+		if _, found := schemaMap[col.Name]; !found {
+			if col.Default != nil {
+				ok = c.check(row, "", col, *col.Default, false) && ok
+			} else {
+				ok = c.check(row, "", col, "", true) && ok
+			}
+		}
+	}
+	return ok
+}
+
+// Checks a full record as stored in redis, missing columns are null
+func (c *constraintChecker) checkRecord(row int, key string, record map[string]string) bool {
+	ok := true
+	for i := range c.schema.Columns {
+		col := &c.schema.Columns[i]
+		val, found := record[col.Name]
+		ok = c.check(row, key, col, val, !found) && ok
+	}
+	return ok
+}
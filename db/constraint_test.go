@@ -0,0 +1,185 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newConstraintSchema() Schema {
+	min := 0.0
+	max := 1000.0
+	maxLength := 8
+	return Schema{
+		Name: "constrained",
+		Columns: []Column{
+			{Name: "name", DataType: "string", Required: true, MaxLength: &maxLength},
+			{Name: "region", DataType: "string", Filterable: true, Enum: []string{"AMER", "EMEA", "APAC"}},
+			{Name: "code", DataType: "string", Pattern: "[A-Z]{2}[0-9]+", Nullable: true},
+			{Name: "revenue", DataType: "float", Filterable: true, Sortable: true, Min: &min, Max: &max},
+		},
+	}
+}
+
+func TestValidateConstraints(t *testing.T) {
+	mr := newMiniRedis(t)
+
+	schema := newConstraintSchema()
+	schema.Columns[2].Pattern = "[A-Z"
+	err := mr.AddSchema(&schema)
+	if err == nil {
+		t.Fatalf("Not failing for invalid pattern")
+	}
+
+	schema = newConstraintSchema()
+	min := 10.0
+	max := 1.0
+	schema.Columns[3].Min = &min
+	schema.Columns[3].Max = &max
+	err = mr.AddSchema(&schema)
+	if err == nil {
+		t.Fatalf("Not failing for min greater than max")
+	}
+}
+
+func TestBulkLoadConstraints(t *testing.T) {
+	mr := newMiniRedis(t)
+
+	schema := newConstraintSchema()
+	err := mr.AddSchema(&schema)
+	if err != nil {
+		t.Fatalf("Failed adding schema %s\n", err)
+	}
+
+	data := "name,region,code,revenue\n" +
+		"acme,EMEA,AB12,100\n" +
+		",AMER,,5\n" +
+		"globex,LATAM,ab12,100\n" +
+		"initech-long,APAC,CD3,5000\n"
+	err = mr.BulkLoad(schema.Name, strings.NewReader(data), "csv")
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	if verr.Total != 5 {
+		t.Fatalf("Expected 5 violations, got %d: %v", verr.Total, verr.Violations)
+	}
+
+	expected := []struct {
+		row int
+		col string
+	}{{1, "name"}, {2, "region"}, {2, "code"}, {3, "name"}, {3, "revenue"}}
+	for i, e := range expected {
+		v := verr.Violations[i]
+		if v.Row != e.row || v.Column != e.col {
+			t.Fatalf("Expected violation on row %d column %s, got %v", e.row, e.col, v)
+		}
+	}
+	if v := verr.Violations[0].Value; v == nil || *v != "" {
+		t.Fatalf("Expected empty value for required violation")
+	}
+
+	// nothing is loaded on a violation
+	table, err := mr.getTable(schema.Name)
+	if err != nil {
+		t.Fatalf("Failed getting table struct %s\n", err)
+	}
+	n, err := mr.Client.ZCard(Ctx, table.formatAllRecordKeys()).Result()
+	if err != nil || n != 0 {
+		t.Fatalf("Expected no records loaded, got %d", n)
+	}
+	load, err := mr.GetLastLoad(table)
+	if err != nil || load.Status != LoadFailed {
+		t.Fatalf("Expected load to be marked failed")
+	}
+}
+
+// A failed load leaves the records of the previous load readable
+func TestBulkLoadConstraintsKeepsVersion(t *testing.T) {
+	mr := newMiniRedis(t)
+
+	schema := newConstraintSchema()
+	err := mr.AddSchema(&schema)
+	if err != nil {
+		t.Fatalf("Failed adding schema %s\n", err)
+	}
+	err = mr.BulkLoad(schema.Name, strings.NewReader("name,region,code,revenue\nacme,EMEA,AB12,100\n"), "csv")
+	if err != nil {
+		t.Fatalf("Failed loading data %s\n", err)
+	}
+	err = mr.BulkLoad(schema.Name, strings.NewReader("name,region,code,revenue\nglobex,LATAM,AB12,100\n"), "csv")
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+
+	data, err := mr.GetData(schema.Name, Query{})
+	if err != nil {
+		t.Fatalf("Failed getting data %s\n", err)
+	}
+	if len(data.Records) != 1 || data.Records[0]["name"] != "acme" {
+		t.Fatalf("Expected the record of the first load, got %v", data.Records)
+	}
+	load, err := mr.GetLastLoad(Table{Name: schema.Name})
+	if err != nil || load.Status != LoadFailed || load.Version != 1 {
+		t.Fatalf("Expected load 1 to be marked failed, got %+v %v", load, err)
+	}
+
+	// the next load still gets a new version
+	err = mr.BulkLoad(schema.Name, strings.NewReader("name,region,code,revenue\nglobex,AMER,AB12,100\n"), "csv")
+	if err != nil {
+		t.Fatalf("Failed loading data %s\n", err)
+	}
+	table, err := mr.getTable(schema.Name)
+	if err != nil || table.Version != 2 {
+		t.Fatalf("Expected version 2, got %d %v", table.Version, err)
+	}
+}
+
+func TestWriteConstraints(t *testing.T) {
+	mr := newMiniRedis(t)
+
+	schema := newConstraintSchema()
+	err := mr.AddSchema(&schema)
+	if err != nil {
+		t.Fatalf("Failed adding schema %s\n", err)
+	}
+	data := "name,region,code,revenue\nacme,EMEA,AB12,100\nglobex,AMER,,5\n"
+	err = mr.BulkLoad(schema.Name, strings.NewReader(data), "csv")
+	if err != nil {
+		t.Fatalf("Failed loading data %s\n", err)
+	}
+
+	// CreateRecord
+	body := `{"records": [
+		{"name": "hooli", "region": "APAC", "code": null, "revenue": "1"},
+		{"name": "hooli", "region": "APAC", "code": null, "revenue": "-1"}
+	]}`
+	_, err = mr.CreateRecord(schema.Name, strings.NewReader(body))
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Total != 1 || verr.Violations[0].Row != 1 {
+		t.Fatalf("Expected a violation on record 1, got %v", err)
+	}
+
+	// UpdateData
+	query := Query{
+		Filters: []Filter{{Col: "region", Op: EqualTo, Val: []string{"EMEA"}}},
+		Updates: map[string]string{"region": "MARS"},
+	}
+	err = mr.UpdateData(schema.Name, query)
+	if !errors.As(err, &verr) || verr.Violations[0].Column != "region" {
+		t.Fatalf("Expected a violation on region, got %v", err)
+	}
+
+	// nothing was written
+	tableData, err := mr.GetData(schema.Name, Query{})
+	if err != nil {
+		t.Fatalf("Failed getting data %s\n", err)
+	}
+	if len(tableData.Records) != 2 || tableData.Records[0]["region"] != "EMEA" {
+		t.Fatalf("Records changed after violations: %v", tableData.Records)
+	}
+}
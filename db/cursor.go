@@ -0,0 +1,218 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// How long a cursor's snapshot is kept after its last page was read
+	CursorTTL = 5 * time.Minute
+)
+
+var (
+	ErrInvalidCursor = errors.New("cursor is invalid or expired")
+)
+
+// Opaque token returned to clients, it only points to the snapshot kept in redis
+type cursorToken struct {
+	Table string `json:"t"`
+	// name the cursor was opened through when it is an alias of Table
+	Alias   string `json:"a,omitempty"`
+	Version int    `json:"v"`
+	ID      string `json:"id"`
+	Offset  int    `json:"o"`
+}
+
+// A snapshot of a query's results, the segments are frozen copies of the result keys
+// so records created or reloaded after the first page don't shift later pages
+// Search is kept to highlight every page
+type cursorState struct {
+	Segments []orderedKey `json:"segments"`
+	Columns  []string     `json:"columns"`
+	Limit    int          `json:"limit"`
+	Search   *Search      `json:"search,omitempty"`
+	Joins    []Join       `json:"joins,omitempty"`
+}
+
+func encodeCursor(token cursorToken) (string, error) {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(cursor string) (cursorToken, error) {
+	var token cursorToken
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return token, ErrInvalidCursor
+	}
+	err = json.Unmarshal(data, &token)
+	if err != nil || token.ID == "" || token.Offset < 0 {
+		return token, ErrInvalidCursor
+	}
+	return token, nil
+}
+
+func newCursorID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// A page of record keys read from a cursor's snapshot
+// Next is the cursor to the following page, empty after the last page
+// Search is set if the page is highlighted
+type cursorPage struct {
+	Table     Table
+	Columns   []string
+	Keys      *[]string
+	ResultSet ResultSet
+	Next      string
+	Search    *Search
+	Joins     []Join
+}
+
+// Creates a snapshot of the query's results and returns the first page with the cursor to the next page
+// tableName is the name the query was made through, the cursor can only be read through it or the table
+func (db *Database) openCursor(tableName string, table Table, query Query) (*cursorPage, error) {
+	id, err := newCursorID()
+	if err != nil {
+		return nil, err
+	}
+
+	finalKey, err := db.getQueryKey(table, query)
+	if err != nil {
+		return nil, err
+	}
+
+	state := cursorState{Columns: query.Columns, Limit: query.Limit, Joins: query.Joins}
+	if search := query.search(); search != nil && search.Highlight {
+		state.Search = search
+	}
+	if len(query.OrderBy) > 1 {
+		// records sorted by multiple columns are cached with their position as score
+		sorted, err := db.storeSortedRecordKeys(table, finalKey, query.OrderBy)
+		if err != nil {
+			return nil, err
+		}
+		snapshotKey := table.formatCursorKey(id, 0)
+		_, err = db.Client.ZUnionStore(Ctx, snapshotKey, &redis.ZStore{Keys: []string{sorted}}).Result()
+		if err != nil {
+			return nil, err
+		}
+		state.Segments = []orderedKey{{Key: snapshotKey}}
+	} else {
+		segments := []orderedKey{{Key: finalKey}}
+		if len(query.OrderBy) == 1 {
+			segments, err = db.storeOrderedSegments(table, finalKey, query.OrderBy[0])
+			if err != nil {
+				return nil, err
+			}
+		}
+		// copy every segment so the snapshot does not change with the table
+		for i, seg := range segments {
+			snapshotKey := table.formatCursorKey(id, i)
+			_, err = db.Client.ZUnionStore(Ctx, snapshotKey, &redis.ZStore{Keys: []string{seg.Key}}).Result()
+			if err != nil {
+				return nil, err
+			}
+			state.Segments = append(state.Segments, orderedKey{Key: snapshotKey, Desc: seg.Desc})
+		}
+	}
+
+	stateJSON, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Client.Set(Ctx, table.formatCursorStateKey(id), stateJSON, CursorTTL).Err()
+	if err != nil {
+		return nil, err
+	}
+
+	token := cursorToken{Table: table.Name, Version: table.Version, ID: id, Offset: query.Offset}
+	if tableName != table.Name {
+		token.Alias = tableName
+	}
+	return db.readCursorPage(table, token, state, query.Limit)
+}
+
+// Returns the page of the snapshot at the token's offset
+// The snapshot's TTL is refreshed on every page
+func (db *Database) readCursorPage(table Table, token cursorToken, state cursorState, limit int) (*cursorPage, error) {
+	pipe := db.Client.Pipeline()
+	pipe.Expire(Ctx, table.formatCursorStateKey(token.ID), CursorTTL)
+	for _, seg := range state.Segments {
+		pipe.Expire(Ctx, seg.Key, CursorTTL)
+	}
+	_, err := pipe.Exec(Ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, resultSet, err := db.getPagedSegmentKeys(state.Segments, limit, token.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	page := cursorPage{Table: table, Columns: state.Columns, Keys: keys, ResultSet: resultSet, Search: state.Search, Joins: state.Joins}
+	if len(*keys) > 0 && token.Offset+len(*keys) < resultSet.Total {
+		token.Offset += len(*keys)
+		page.Next, err = encodeCursor(token)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &page, nil
+}
+
+// Returns the next page of a cursor, the limit of the first page is used unless another one is given
+// The table and version are pinned by the cursor, so an alias swap or reload mid scroll does not change the pages
+func (db *Database) readCursor(tableName string, cursor string, limit int) (*cursorPage, error) {
+	token, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	// the cursor must be read through the table it was opened on, or the alias it was opened through
+	if tableName != token.Table && (token.Alias == "" || tableName != token.Alias) {
+		return nil, ErrInvalidCursor
+	}
+	table, err := db.getTable(token.Table)
+	if err != nil {
+		return nil, err
+	}
+	table.Version = token.Version
+
+	stateJSON, err := db.Client.Get(Ctx, table.formatCursorStateKey(token.ID)).Result()
+	if err == redis.Nil {
+		return nil, ErrInvalidCursor
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state cursorState
+	err = json.Unmarshal([]byte(stateJSON), &state)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = state.Limit
+	}
+	return db.readCursorPage(table, token, state, limit)
+}
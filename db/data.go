@@ -19,10 +19,19 @@ type ResultSet struct {
 	Total  int `json:"total"`
 }
 
+// Groups the records selected by Query and reduces each group with the reducers
+// Operation and Column are a single reducer kept for older clients, Limit 0 returns every group
 type AggRequest struct {
-	Operation string   `json:"operation" binding:"required"`
-	Column    string   `json:"column" binding:"required"`
-	Groupby   []string `json:"group_by" binding:"required"`
+	Operation string      `json:"operation"`
+	Column    string      `json:"column"`
+	Groupby   []string    `json:"group_by"`
+	Reducers  []Reducer   `json:"reducers"`
+	Bucket    *TimeBucket `json:"bucket"`
+	Query     *Query      `json:"query"`
+	Having    []Filter    `json:"having"`
+	OrderBy   []OrderBy   `json:"orderBy"`
+	Limit     int         `json:"limit"`
+	Offset    int         `json:"offset"`
 }
 
 type Condition struct {
@@ -46,11 +55,16 @@ type RecGetDelRequest struct {
 
 type Metadata struct {
 	ResultSet ResultSet `json:"result_set"`
+	// Cursor to the next page of a scroll, empty after the last page
+	Cursor string `json:"cursor,omitempty"`
 }
 
+// Null columns are returned as nil so they are encoded as JSON null
+// Highlights holds the highlighted values of each record's matched columns when a search asks for them
 type GetDataResponse struct {
-	Records  []map[string]string `json:"records"`
-	Metadata Metadata            `json:"metadata"`
+	Records    []map[string]any    `json:"records"`
+	Highlights []map[string]string `json:"highlights,omitempty"`
+	Metadata   Metadata            `json:"metadata"`
 }
 
 type WorkerJobs struct {
@@ -103,10 +117,28 @@ func (db *Database) getPagedRecordKeys(key string, limit int, offset int) (*[]st
 
 // Gets all of the filter keys for a given filter by performing
 // ZRANGEBYSCORE command to get all of the filter keys in the ordered set
+// String columns use ZRANGEBYLEX on the collation members of their values instead
 func (db *Database) getOrderedFilterKeys(table Table, f Filter) ([]string, error) {
 	key := table.formatSortableKey(f.Col)
 	var r redis.ZRangeBy
 
+	col, err := table.Schema.getColumn(f.Col)
+	if err != nil {
+		return nil, err
+	}
+	if col.DataType == "string" {
+		r = col.lexRange(f)
+		members, err := db.Client.ZRangeByLex(Ctx, key, &r).Result()
+		if err != nil {
+			return nil, err
+		}
+		filterKeys := make([]string, 0, len(members))
+		for _, m := range members {
+			filterKeys = append(filterKeys, table.formatFilterKey(f.Col, lexMemberValue(m)))
+		}
+		return filterKeys, nil
+	}
+
 	switch f.Op {
 	case GreaterThan:
 		r.Min = "(" + f.Val[0]
@@ -120,49 +152,256 @@ func (db *Database) getOrderedFilterKeys(table Table, f Filter) ([]string, error
 	case LessThanOrEqual:
 		r.Min = "-inf"
 		r.Max = f.Val[0]
+	case Between:
+		r.Min = f.Val[0]
+		r.Max = f.Val[1]
+		if f.Bounds != "" {
+			if f.Bounds[0] == '(' {
+				r.Min = "(" + r.Min
+			}
+			if f.Bounds[1] == ')' {
+				r.Max = "(" + r.Max
+			}
+		}
 	}
 
 	return db.Client.ZRangeByScore(Ctx, key, &r).Result()
 }
 
-// For a given filter, gets all of the filterKeys, runs a UNION and appends destintion to unionkeys
-func (db *Database) addFilterUnionKey(table Table, unionKeys *[]string, t string, f Filter) error {
+// Returns the values of a string column starting with prefix from the column's registry of values
+func (db *Database) getPrefixValues(table Table, col string, prefix string) ([]string, error) {
+	// no valid utf-8 string contains 0xff, so it sorts after every value with the prefix
+	r := redis.ZRangeBy{
+		Min: "[" + prefix,
+		Max: "(" + prefix + "\xff",
+	}
+	return db.Client.ZRangeByLex(Ctx, table.formatValuesKey(col), &r).Result()
+}
+
+// Returns the values of a string column containing substr from the column's registry of values
+func (db *Database) getContainsValues(table Table, col string, substr string) ([]string, error) {
+	match := "*" + globEscaper.Replace(substr) + "*"
+	vals := make([]string, 0)
+	var cursor uint64
+	for {
+		res, next, err := db.Client.ZScan(Ctx, table.formatValuesKey(col), cursor, match, ScanCount).Result()
+		if err != nil {
+			return nil, err
+		}
+		// results alternate between member and score
+		for i := 0; i < len(res); i += 2 {
+			vals = append(vals, res[i])
+		}
+		cursor = next
+		if cursor == 0 {
+			return vals, nil
+		}
+	}
+}
+
+// Splits keys into chunks of at most MaxStoreKeys
+func chunkKeys(keys []string) [][]string {
+	chunks := make([][]string, 0, len(keys)/MaxStoreKeys+1)
+	for len(keys) > 0 {
+		n := MaxStoreKeys
+		if len(keys) < n {
+			n = len(keys)
+		}
+		chunks = append(chunks, keys[:n])
+		keys = keys[n:]
+	}
+	return chunks
+}
+
+// Stores the union of keys into dst, a few keys at a time so large in filters stay below argument limits
+func (db *Database) unionStoreChunked(dst string, keys []string) (int64, error) {
+	var n int64
+	var err error
+	for i, chunk := range chunkKeys(keys) {
+		if i > 0 {
+			chunk = append([]string{dst}, chunk...)
+		}
+		n, err = db.Client.SUnionStore(Ctx, dst, chunk...).Result()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// Stores every record that is not null and not in any of the keys into dst, a few keys at a time
+func (db *Database) diffStoreChunked(table Table, dst string, col string, keys []string) (int64, error) {
+	n, err := db.Client.SDiffStore(Ctx, dst, table.formatAllRecordSetKey(), table.formatNullKey(col)).Result()
+	if err != nil {
+		return 0, err
+	}
+	for _, chunk := range chunkKeys(keys) {
+		n, err = db.Client.SDiffStore(Ctx, dst, append([]string{dst}, chunk...)...).Result()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// For a given filter, stores the set of matching records and returns its key and size
+// Values are unioned from their filter sets, null checks use the null and all record sets
+// prefix and contains first find the matching values in the column's registry of values
+func (db *Database) storeFilterSet(table Table, t string, f Filter) (string, int64, error) {
 	// format UNIONSTORE destination
-	dst := table.formatUnionStoreKey(f.Col, f.Val, t)
+	dst := table.formatUnionStoreKey(f, t)
 
 	// Get all filterkeys
 	filterKeys := make([]string, 0, len(f.Val))
+	var vals []string
 
-	if f.Op == EqualTo {
+	switch f.Op {
+	case EqualTo, In:
+		vals = f.Val
+	case NotEqualTo:
 		for _, v := range f.Val {
 			filterKeys = append(filterKeys, table.formatFilterKey(f.Col, v))
 		}
-		// EqualTo
-	} else {
+		n, err := db.diffStoreChunked(table, dst, f.Col, filterKeys)
+		return dst, n, err
+	case IsNull:
+		filterKeys = append(filterKeys, table.formatNullKey(f.Col))
+	case IsNotNull:
+		// every record that is not in the null set
+		n, err := db.Client.SDiffStore(Ctx, dst, table.formatAllRecordSetKey(), table.formatNullKey(f.Col)).Result()
+		return dst, n, err
+	case StartsWith:
+		var err error
+		vals, err = db.getPrefixValues(table, f.Col, f.Val[0])
+		if err != nil {
+			return dst, 0, err
+		}
+	case Contains:
+		var err error
+		vals, err = db.getContainsValues(table, f.Col, f.Val[0])
+		if err != nil {
+			return dst, 0, err
+		}
+	default:
 		fs, err := db.getOrderedFilterKeys(table, f)
 		if err != nil {
-			return err
+			return dst, 0, err
 		}
 		filterKeys = append(filterKeys, fs...)
 	}
+	for _, v := range vals {
+		filterKeys = append(filterKeys, table.formatFilterKey(f.Col, v))
+	}
+
+	// no matching filter keys, store nothing
+	if len(filterKeys) == 0 {
+		_, err := db.Client.Del(Ctx, dst).Result()
+		return dst, 0, err
+	}
 
 	// Execute UnionStore
-	n, err := db.Client.SUnionStore(Ctx, dst, filterKeys...).Result()
+	n, err := db.unionStoreChunked(dst, filterKeys)
+	return dst, n, err
+}
+
+// For a given filter, gets all of the filterKeys, runs a UNION and appends destintion to unionkeys
+func (db *Database) addFilterUnionKey(table Table, unionKeys *[]string, t string, f Filter) error {
+	dst, n, err := db.storeFilterSet(table, t, f)
 	*unionKeys = append(*unionKeys, dst)
+	if err != nil {
+		return err
+	}
+	err = db.expireTempKeys(dst)
+	if err != nil {
+		return err
+	}
 	if n == 0 {
 		return ErrNil
 	}
-	return err
+	return nil
+}
+
+// Evaluates a filter tree bottom up and returns the key to the set of matching records
+// and nodes are stored with SINTERSTORE, or nodes with SUNIONSTORE and not nodes with SDIFFSTORE from the all record set
+// id numbers the stored nodes so every node of the tree gets its own key, even repeated leaves
+// that are deleted once their parent is stored
+func (db *Database) storeFilterExpr(table Table, t string, expr *FilterExpr, id *int) (string, error) {
+	if expr.Col != "" {
+		*id++
+		dst, _, err := db.storeFilterSet(table, fmt.Sprintf("%d:%s", *id, t), expr.Filter)
+		if err != nil {
+			return dst, err
+		}
+		return dst, db.expireTempKeys(dst)
+	}
+
+	*id++
+	dst := table.formatExprStoreKey(*id, t)
+
+	if expr.Not != nil {
+		key, err := db.storeFilterExpr(table, t, expr.Not, id)
+		if err != nil {
+			return "", err
+		}
+		_, err = db.Client.SDiffStore(Ctx, dst, table.formatAllRecordSetKey(), key).Result()
+		if err != nil {
+			return dst, err
+		}
+		return dst, db.storedFilterExpr(dst, key)
+	}
+
+	children := expr.And
+	if expr.Or != nil {
+		children = expr.Or
+	}
+	keys := make([]string, 0, len(children))
+	for i := range children {
+		key, err := db.storeFilterExpr(table, t, &children[i], id)
+		if err != nil {
+			return "", err
+		}
+		keys = append(keys, key)
+	}
+
+	var err error
+	if expr.Or != nil {
+		_, err = db.Client.SUnionStore(Ctx, dst, keys...).Result()
+	} else {
+		_, err = db.Client.SInterStore(Ctx, dst, keys...).Result()
+	}
+	if err != nil {
+		return dst, err
+	}
+	return dst, db.storedFilterExpr(dst, keys...)
+}
+
+// Expires a stored node of a filter tree and deletes the keys of its children, which are no longer needed
+func (db *Database) storedFilterExpr(dst string, children ...string) error {
+	err := db.expireTempKeys(dst)
+	if err != nil {
+		return err
+	}
+	return db.deleteTempKeys(children...)
 }
 
 // Returns all record keys based on filters provided
 // Runs a SUNIONSTORE on all values for each filtered columns
+// and stores the where filter tree if there is one
 // Runs a SINTER of all stored union values
-func (db *Database) getFilteredRecordKeys(table Table, filters []Filter) (string, error) {
+func (db *Database) getFilteredRecordKeys(table Table, filters []Filter, where *FilterExpr) (string, error) {
 	t := time.Now().String()
 
 	// var unionKeys []string
-	unionKeys := make([]string, 0, len(filters))
+	unionKeys := make([]string, 0, len(filters)+1)
+	// the union and intersection keys are only needed until the final key is stored
+	var interKey string
+	defer func() {
+		keys := unionKeys
+		if interKey != "" {
+			keys = append(keys, interKey)
+		}
+		db.deleteTempKeys(keys...)
+	}()
 
 	// Loop through all filtered columns and use UNIONSTORE to store all keys
 	for _, f := range filters {
@@ -172,9 +411,22 @@ func (db *Database) getFilteredRecordKeys(table Table, filters []Filter) (string
 		}
 	}
 
+	// The where tree is and'ed with the filters
+	if where != nil {
+		id := 0
+		key, err := db.storeFilterExpr(table, t, where, &id)
+		if err != nil {
+			return "", err
+		}
+		unionKeys = append(unionKeys, key)
+	}
+
 	// get intersection of all UNIONSTORES
-	interKey := table.formatInterStoreKey(unionKeys, t)
+	interKey = table.formatInterStoreKey(unionKeys, t)
 	_, err := db.Client.SInterStore(Ctx, interKey, unionKeys...).Result()
+	if err != nil {
+		return "", err
+	}
 
 	// Must do a zinterstore instead of zinter for testing purposes, miniredis has not implemented zinter
 	finalKey := interKey + "_final"
@@ -185,48 +437,60 @@ func (db *Database) getFilteredRecordKeys(table Table, filters []Filter) (string
 	if err != nil {
 		return "", err
 	}
+	err = db.expireTempKeys(finalKey)
+	if err != nil {
+		return "", err
+	}
 
 	// keys, err := db.Client.ZRange(Ctx, finalKey, 0, -1).Result()
 	return finalKey, nil
 }
 
-// Return All Record Keys based on parameters and filters
-func (db *Database) getRecordKeys(table Table, query Query) (*[]string, ResultSet, error) {
-	// var searchStoreKey string
-	var err error
+// Returns the key to the sorted set of records matching the query
+// Records are in load order, or by relevance if there is a search term
+func (db *Database) getQueryKey(table Table, query Query) (string, error) {
+	key := table.formatAllRecordKeys()
 
-	finalKey := table.formatAllRecordKeys()
 	// Get record keys matching the filters
-	if len(query.Filters) > 0 {
-		finalKey, err = db.getFilteredRecordKeys(table, query.Filters)
+	if len(query.Filters) > 0 || query.Where != nil {
+		var err error
+		key, err = db.getCachedRecordKeys(table, query)
 		if err != nil {
-			return nil, ResultSet{}, err
+			return "", err
 		}
 	}
 
-	// // If there is a searchTerm, perform search and get key to set or recordKeys
-	// if query.SearchTerm != "" {
-	// 	searchStoreKey, err = db.searchIndexStore(table, query.SearchTerm)
-	// 	if err != nil {
-	// 		return nil, ResultSet{}, err
-	// 	}
+	// Inner joins only keep the records in every join set
+	if len(query.joinSets) > 0 {
+		var err error
+		key, err = db.intersectJoinSets(table, key, query.joinSets)
+		if err != nil {
+			return "", err
+		}
+	}
 
-	// 	// Run Zinter with the search keys and replace finalKey set
-	// 	_, err = db.Client.ZInterStore(Ctx, searchStoreKey,
-	// 		&redis.ZStore{
-	// 			Keys: []string{finalKey, searchStoreKey},
-	// 		}).Result()
-	// 	if err != nil {
-	// 		return nil, ResultSet{}, err
-	// 	}
+	// If there is a search, only keep the records matching it
+	if search := query.search(); search != nil {
+		return db.getSearchRecordKeys(table, key, search)
+	}
+	return key, nil
+}
 
-	// 	finalKey = searchStoreKey
-	// }
+// Return All Record Keys based on parameters and filters
+func (db *Database) getRecordKeys(table Table, query Query) (*[]string, ResultSet, error) {
+	finalKey, err := db.getQueryKey(table, query)
+	if err != nil {
+		return nil, ResultSet{}, err
+	}
 
+	if len(query.OrderBy) > 0 {
+		return db.getOrderedRecordKeys(table, finalKey, query)
+	}
 	return db.getPagedRecordKeys(finalKey, query.Limit, query.Offset)
 }
 
 // Returns record based on key and checks to make sure record matches schema
+// Nullable columns may be missing from the record
 func (db *Database) getRecord(key string, schema *Schema) (*map[string]string, error) {
 	record, err := db.Client.HGetAll(Ctx, key).Result()
 	if len(record) == 0 {
@@ -234,22 +498,77 @@ func (db *Database) getRecord(key string, schema *Schema) (*map[string]string, e
 	}
 
 	// Make sure no missing, or additional columns
-	if len((*schema).Columns) != len(record) {
-		return nil, errors.New(fmt.Sprintf("Number of columns for key %s do not match schema", key))
-	}
+	found := 0
 	for _, schemaCol := range (*schema).Columns {
-		if _, ok := record[schemaCol.Name]; !ok {
+		if _, ok := record[schemaCol.Name]; ok {
+			found++
+		} else if !schemaCol.Nullable {
 			return nil, errors.New(fmt.Sprintf("%s column not found in record %s", schemaCol.Name, key))
 		}
 	}
+	if found != len(record) {
+		return nil, errors.New(fmt.Sprintf("Number of columns for key %s do not match schema", key))
+	}
 
 	return &record, err
 }
 
+// Returns only the given columns of a record using HMGET
+// Missing values are only allowed for nullable columns, like in getRecord
+func (db *Database) getRecordColumns(key string, schema *Schema, columns []string) (*map[string]string, error) {
+	vals, err := db.Client.HMGet(Ctx, key, columns...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	record := make(map[string]string, len(columns))
+	for i, v := range vals {
+		if s, ok := v.(string); ok {
+			record[columns[i]] = s
+			continue
+		}
+		col, err := schema.getColumn(columns[i])
+		if err != nil {
+			return nil, err
+		}
+		if !col.Nullable {
+			return nil, errors.New(fmt.Sprintf("%s column not found in record %s", col.Name, key))
+		}
+	}
+	return &record, nil
+}
+
+// Converts a record to a response row, null columns are set to nil
+// Only the given columns are in the row, or every column of the schema if there are none
+func (schema *Schema) recordToRow(record map[string]string, columns []string) map[string]any {
+	if len(columns) == 0 {
+		columns = make([]string, 0, len(schema.Columns))
+		for _, col := range schema.Columns {
+			columns = append(columns, col.Name)
+		}
+	}
+	row := make(map[string]any, len(columns))
+	for _, col := range columns {
+		if val, ok := record[col]; ok {
+			row[col] = val
+		} else {
+			row[col] = nil
+		}
+	}
+	return row
+}
+
 // Gets keys from the jobs channel and sends the record to results channel
-func (db *Database) getRecordsWorker(id int, schema *Schema, jobs <-chan WorkerJobs, results chan<- *WorkerResult) {
+// If columns are given only those are fetched
+func (db *Database) getRecordsWorker(id int, schema *Schema, columns []string, jobs <-chan WorkerJobs, results chan<- *WorkerResult) {
 	for j := range jobs {
-		record, err := db.getRecord(j.Key, schema)
+		var record *map[string]string
+		var err error
+		if len(columns) > 0 {
+			record, err = db.getRecordColumns(j.Key, schema, columns)
+		} else {
+			record, err = db.getRecord(j.Key, schema)
+		}
 		results <- &WorkerResult{Record: record, Index: j.Index, err: err}
 		if err != nil {
 			return
@@ -260,9 +579,9 @@ func (db *Database) getRecordsWorker(id int, schema *Schema, jobs <-chan WorkerJ
 // Creates a worker pool using recordKeys as jobs, and the returned record as results
 // https://gobyexample.com/waitgroups
 // https://gobyexample.com/worker-pools
-func (db *Database) getRecordsWorkerPool(keys *[]string, schema *Schema) (*GetDataResponse, error) {
+func (db *Database) getRecordsWorkerPool(keys *[]string, schema *Schema, columns []string) (*GetDataResponse, error) {
 	tableData := GetDataResponse{
-		Records: make([]map[string]string, len(*keys), len(*keys)),
+		Records: make([]map[string]any, len(*keys), len(*keys)),
 	}
 
 	// queue of keys to get
@@ -282,7 +601,7 @@ func (db *Database) getRecordsWorkerPool(keys *[]string, schema *Schema) (*GetDa
 
 		go func() {
 			defer wg.Done()
-			db.getRecordsWorker(w, schema, jobs, results)
+			db.getRecordsWorker(w, schema, columns, jobs, results)
 		}()
 	}
 
@@ -302,7 +621,7 @@ func (db *Database) getRecordsWorkerPool(keys *[]string, schema *Schema) (*GetDa
 		if res.err != nil {
 			return nil, res.err
 		}
-		tableData.Records[(*res).Index] = *res.Record
+		tableData.Records[(*res).Index] = schema.recordToRow(*res.Record, columns)
 	}
 
 	return &tableData, nil
@@ -310,8 +629,21 @@ func (db *Database) getRecordsWorkerPool(keys *[]string, schema *Schema) (*GetDa
 
 // Returns data for a given table
 // TODO include filters
+// With query.Scroll the results are snapshotted and a cursor to the next page is returned,
+// pages after the first are read with query.Cursor and ignore the rest of the query
 func (db *Database) GetData(tableName string, query Query) (*GetDataResponse, error) {
+	if query.Cursor != "" {
+		page, err := db.readCursor(tableName, query.Cursor, query.Limit)
+		if err != nil {
+			return nil, err
+		}
+		return db.getCursorPageData(page)
+	}
+
 	table, err := db.getTable(tableName)
+	if err != nil {
+		return nil, err
+	}
 
 	// Ensure filters are valid
 	err = table.Schema.validateQuery(query)
@@ -319,6 +651,30 @@ func (db *Database) GetData(tableName string, query Query) (*GetDataResponse, er
 		return nil, err
 	}
 
+	// inner joins only keep the records with a matching dimension record
+	plans, err := db.planJoins(table, query.Joins, query.Columns)
+	if err != nil {
+		return nil, err
+	}
+	err = db.restrictJoins(table, &query, plans)
+	if err == ErrNil {
+		// no dimension record matches an inner join
+		resp := GetDataResponse{Records: make([]map[string]any, 0)}
+		resp.Metadata.ResultSet = ResultSet{Offset: query.Offset, Limit: query.Limit}
+		return &resp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if query.Scroll {
+		page, err := db.openCursor(tableName, table, query)
+		if err != nil {
+			return nil, err
+		}
+		return db.getCursorPageData(page)
+	}
+
 	// get all recordKeys
 	keys, resultSet, err := db.getRecordKeys(table, query)
 	if err != nil {
@@ -326,12 +682,95 @@ func (db *Database) GetData(tableName string, query Query) (*GetDataResponse, er
 	}
 
 	// Create worker pool to get records quicker
-	tableData, err := db.getRecordsWorkerPool(keys, &table.Schema)
+	tableData, err := db.getRecordsWorkerPool(keys, &table.Schema, query.Columns)
 	if err != nil {
 		return nil, err
 	}
 
+	err = db.joinRecords(plans, *keys, tableData.Records)
+	if err != nil {
+		return nil, err
+	}
+
+	if search := query.search(); search != nil && search.Highlight {
+		tableData.Highlights, err = db.getHighlights(table, search, *keys)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	tableData.Metadata.ResultSet = resultSet
 
 	return tableData, nil
 }
+
+// Returns the records of a cursor page with the cursor to the next page
+func (db *Database) getCursorPageData(page *cursorPage) (*GetDataResponse, error) {
+	tableData, err := db.getRecordsWorkerPool(page.Keys, &page.Table.Schema, page.Columns)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(page.Joins) > 0 {
+		plans, err := db.planJoins(page.Table, page.Joins, page.Columns)
+		if err != nil {
+			return nil, err
+		}
+		err = db.joinRecords(plans, *page.Keys, tableData.Records)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if page.Search != nil {
+		tableData.Highlights, err = db.getHighlights(page.Table, page.Search, *page.Keys)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tableData.Metadata.ResultSet = page.ResultSet
+	tableData.Metadata.Cursor = page.Next
+
+	return tableData, nil
+}
+
+// Returns the number of records matching the query's filters, no records are read
+func (db *Database) CountData(tableName string, query Query) (int64, error) {
+	table, err := db.getTable(tableName)
+	if err != nil {
+		return 0, err
+	}
+	err = table.Schema.validateQuery(query)
+	if err != nil {
+		return 0, err
+	}
+	plans, err := db.planJoins(table, query.Joins, query.Columns)
+	if err != nil {
+		return 0, err
+	}
+	err = db.restrictJoins(table, &query, plans)
+	if err == ErrNil {
+		// no dimension record matches an inner join
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := db.getQueryKey(table, query)
+	if err == ErrNil {
+		// a filter matched no records
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return db.Client.ZCard(Ctx, key).Result()
+}
+
+// Returns true if any record matches the query's filters
+func (db *Database) ExistsData(tableName string, query Query) (bool, error) {
+	n, err := db.CountData(tableName, query)
+	return n > 0, err
+}
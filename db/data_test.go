@@ -4,9 +4,14 @@
 package db
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
+
+	"github.com/redis/go-redis/v9"
 )
 
 func TestGetAllRecordKeys(t *testing.T) {
@@ -155,6 +160,191 @@ func TestGetRecordKeys(t *testing.T) {
 	}
 }
 
+func TestGetFilterExprRecordKeys(t *testing.T) {
+	mr := newMiniRedis(t)
+
+	tableName, err := mr.loadXPPTestData()
+	if err != nil {
+		t.Fatalf("Failed loading xpp test data %s\n", err)
+	}
+
+	table, err := mr.getTable(tableName)
+	if err != nil {
+		t.Fatalf("Failed getting table struct %s\n", err)
+	}
+
+	tests := []struct {
+		where    string
+		filters  []Filter
+		expected int
+	}{
+		// (EMEA and > 10000) or APAC
+		{`{"or": [
+			{"and": [{"col": "col3_string", "val": ["EMEA"]}, {"col": "col4_int", "op": "gt", "val": ["10000"]}]},
+			{"col": "col3_string", "val": ["APAC"]}
+		]}`, nil, 5},
+		{`{"not": {"col": "col3_string", "val": ["AMER"]}}`, nil, 13},
+		// where is and'ed with the filters
+		{`{"not": {"col": "col4_int", "op": "lte", "val": ["100"]}}`, []Filter{{Col: "col3_string", Op: EqualTo, Val: []string{"EMEA"}}}, 4},
+		// leaves with no records don't fail the tree
+		{`{"or": [{"col": "col3_string", "val": ["blah"]}, {"col": "col4_int", "op": "gt", "val": ["1000000"]}]}`, nil, 1},
+	}
+	for _, test := range tests {
+		var where FilterExpr
+		err = json.Unmarshal([]byte(test.where), &where)
+		if err != nil {
+			t.Fatalf("Failed unmarshalling %s: %s\n", test.where, err)
+		}
+		query := Query{Filters: test.filters, Where: &where}
+		err = table.Schema.validateQuery(query)
+		if err != nil {
+			t.Fatalf("Failed validating %s: %s\n", test.where, err)
+		}
+		keys, _, err := mr.getRecordKeys(table, query)
+		if err != nil {
+			t.Fatalf("Failed getting record keys for %s: %s\n", test.where, err)
+		}
+		if len(*keys) != test.expected {
+			t.Fatalf("Expected %d record keys for %s, got %d\n", test.expected, test.where, len(*keys))
+		}
+	}
+
+	// invalid trees
+	for _, where := range []string{
+		`{}`,
+		`{"and": []}`,
+		`{"not": {"col": "col3_string", "val": ["AMER"]}, "col": "col3_string"}`,
+		`{"or": [{"col": "blah", "val": ["blah"]}]}`,
+	} {
+		var expr FilterExpr
+		json.Unmarshal([]byte(where), &expr)
+		err = table.Schema.validateQuery(Query{Where: &expr})
+		if err == nil {
+			t.Fatalf("Not failing for invalid filter expression %s", where)
+		}
+	}
+}
+
+// Repeated leaves are stored under their own keys, deleting one doesn't empty the others
+func TestGetFilterExprRepeatedLeaves(t *testing.T) {
+	mr := newMiniRedis(t)
+	schema := Schema{
+		Name: "accounts",
+		Columns: []Column{
+			{Name: "name", DataType: "string"},
+			{Name: "region", DataType: "string", Filterable: true},
+			{Name: "tier", DataType: "string", Filterable: true},
+		},
+	}
+	err := mr.AddSchema(&schema)
+	if err != nil {
+		t.Fatalf("Failed adding schema %s\n", err)
+	}
+	err = mr.BulkLoad("accounts", strings.NewReader("name,region,tier\na,EMEA,gold\nb,EMEA,silver\nc,AMER,gold\n"), "csv")
+	if err != nil {
+		t.Fatalf("Failed loading data %s\n", err)
+	}
+
+	emea := FilterExpr{Filter: Filter{Col: "region", Op: EqualTo, Val: []string{"EMEA"}}}
+	gold := FilterExpr{Filter: Filter{Col: "tier", Op: EqualTo, Val: []string{"gold"}}}
+	tests := []struct {
+		query    Query
+		expected []string
+	}{
+		{Query{Where: &FilterExpr{Or: []FilterExpr{emea, {And: []FilterExpr{emea, gold}}}}}, []string{"a", "b"}},
+		{Query{Filters: []Filter{emea.Filter}, Where: &FilterExpr{And: []FilterExpr{emea, gold}}}, []string{"a"}},
+		{Query{Where: &FilterExpr{And: []FilterExpr{emea, {Not: &FilterExpr{And: []FilterExpr{emea, gold}}}}}}, []string{"b"}},
+	}
+	for _, test := range tests {
+		test.query.Columns = []string{"name"}
+		data, err := mr.GetData("accounts", test.query)
+		if err != nil {
+			t.Fatalf("Failed getting data for %+v: %s\n", test.query.Where, err)
+		}
+		names := make([]string, 0, len(data.Records))
+		for _, r := range data.Records {
+			names = append(names, r["name"].(string))
+		}
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Fatalf("Expected %v for %+v, got %v", test.expected, test.query.Where, names)
+		}
+	}
+}
+
+func TestGetFilterOpRecordKeys(t *testing.T) {
+	mr := newMiniRedis(t)
+
+	tableName, err := mr.loadXPPTestData()
+	if err != nil {
+		t.Fatalf("Failed loading xpp test data %s\n", err)
+	}
+
+	table, err := mr.getTable(tableName)
+	if err != nil {
+		t.Fatalf("Failed getting table struct %s\n", err)
+	}
+
+	// large in list
+	in := []string{"APAC"}
+	for i := 0; i < 2500; i++ {
+		in = append(in, fmt.Sprintf("region%d", i))
+	}
+
+	tests := []struct {
+		filter   Filter
+		expected int
+	}{
+		{Filter{Col: "col3_string", Op: NotEqualTo, Val: []string{"AMER"}}, 13},
+		{Filter{Col: "col3_string", Op: NotEqualTo, Val: []string{"AMER", "EMEA"}}, 5},
+		{Filter{Col: "col4_int", Op: Between, Val: []string{"100", "20000"}}, 12},
+		{Filter{Col: "col4_int", Op: Between, Val: []string{"100", "20000"}, Bounds: "()"}, 4},
+		{Filter{Col: "col4_int", Op: Between, Val: []string{"100", "20000"}, Bounds: "[)"}, 11},
+		{Filter{Col: "col3_string", Op: StartsWith, Val: []string{"A"}}, 13},
+		{Filter{Col: "col2_string", Op: StartsWith, Val: []string{"company1"}}, 11},
+		{Filter{Col: "col3_string", Op: Contains, Val: []string{"/"}}, 3},
+		{Filter{Col: "col2_string", Op: Contains, Val: []string{"y2"}}, 5},
+		{Filter{Col: "col2_string", Op: Contains, Val: []string{"*"}}, 0},
+		{Filter{Col: "col3_string", Op: In, Val: in}, 2},
+	}
+	for _, test := range tests {
+		query := Query{Where: &FilterExpr{Filter: test.filter}}
+		err = table.Schema.validateQuery(query)
+		if err != nil {
+			t.Fatalf("Failed validating %v: %s\n", test.filter, err)
+		}
+		keys, _, err := mr.getRecordKeys(table, query)
+		if err != nil {
+			t.Fatalf("Failed getting record keys for %v: %s\n", test.filter, err)
+		}
+		if len(*keys) != test.expected {
+			t.Fatalf("Expected %d record keys for %v, got %d\n", test.expected, test.filter.Op, len(*keys))
+		}
+	}
+
+	// invalid filters
+	for _, f := range []Filter{
+		{Col: "col2_string", Op: Between, Val: []string{"a", "b"}},
+		{Col: "col4_int", Op: Between, Val: []string{"1"}},
+		{Col: "col4_int", Op: Between, Val: []string{"1", "2"}, Bounds: "[["},
+		{Col: "col4_int", Op: StartsWith, Val: []string{"1"}},
+		{Col: "col3_string", Op: EqualTo, Val: []string{"AMER"}, Bounds: "()"},
+		{Col: "col3_string", Op: In},
+	} {
+		err = table.Schema.validateQuery(Query{Filters: []Filter{f}})
+		if err == nil {
+			t.Fatalf("Not failing for invalid filter %v", f)
+		}
+	}
+
+	// unknown ops fail to unmarshal
+	var f Filter
+	err = json.Unmarshal([]byte(`{"col": "col3_string", "op": "blah"}`), &f)
+	if err == nil {
+		t.Fatalf("Not failing for unknown op")
+	}
+}
+
 func TestGetRecord(t *testing.T) {
 	mr := newMiniRedis(t)
 
@@ -441,3 +631,551 @@ func TestGetAllDataPaging(t *testing.T) {
 		t.Fatalf("Number of records does not match")
 	}
 }
+
+func TestGetNullFilteredData(t *testing.T) {
+	mr := newMiniRedis(t)
+
+	schema := Schema{
+		Name: "nulls",
+		Columns: []Column{
+			{Name: "name", DataType: "string"},
+			{Name: "region", DataType: "string", Filterable: true, Nullable: true},
+		},
+	}
+	err := mr.AddSchema(&schema)
+	if err != nil {
+		t.Fatalf("Failed adding schema %s\n", err)
+	}
+	data := "name,region\nacme,EMEA\nglobex,\ninitech,AMER\numbrella,\n"
+	err = mr.BulkLoad(schema.Name, strings.NewReader(data), "csv")
+	if err != nil {
+		t.Fatalf("Failed loading data %s\n", err)
+	}
+
+	query := Query{Filters: []Filter{{Col: "region", Op: IsNull}}}
+	tableData, err := mr.GetData(schema.Name, query)
+	if err != nil {
+		t.Fatalf("Failed getting isnull data %s\n", err)
+	}
+	if len(tableData.Records) != 2 || tableData.Records[0]["name"] != "globex" {
+		t.Fatalf("Expected 2 null records, got %v", tableData.Records)
+	}
+
+	query.Filters[0].Op = IsNotNull
+	tableData, err = mr.GetData(schema.Name, query)
+	if err != nil {
+		t.Fatalf("Failed getting notnull data %s\n", err)
+	}
+	if len(tableData.Records) != 2 || tableData.Records[1]["name"] != "initech" {
+		t.Fatalf("Expected 2 not null records, got %v", tableData.Records)
+	}
+
+	// null checks take no values
+	query.Filters[0].Val = []string{"EMEA"}
+	_, err = mr.GetData(schema.Name, query)
+	if err == nil {
+		t.Fatalf("Not failing for notnull filter with a val")
+	}
+}
+
+func TestGetOrderedData(t *testing.T) {
+	mr := newMiniRedis(t)
+
+	table, err := mr.loadXPPTestData()
+	if err != nil {
+		t.Fatalf("Failed loading xpp test data %s\n", err)
+	}
+
+	names := func(records []map[string]any) []any {
+		n := make([]any, 0, len(records))
+		for _, r := range records {
+			n = append(n, r["col2_string"])
+		}
+		return n
+	}
+
+	// single column desc
+	query := Query{OrderBy: []OrderBy{{Col: "col4_int", Order: "desc"}}, Limit: 3}
+	tableData, err := mr.GetData(table, query)
+	if err != nil {
+		t.Fatalf("Failed getting ordered data %s\n", err)
+	}
+	expected := []any{"company8", "company18", "company4"}
+	if !reflect.DeepEqual(expected, names(tableData.Records)) {
+		t.Fatalf("Expected %v, got %v", expected, names(tableData.Records))
+	}
+
+	// single column with filters and paging
+	query = Query{
+		Filters: []Filter{{Col: "col3_string", Op: EqualTo, Val: []string{"EMEA"}}},
+		OrderBy: []OrderBy{{Col: "col4_int"}},
+		Limit:   2,
+		Offset:  6,
+	}
+	tableData, err = mr.GetData(table, query)
+	if err != nil {
+		t.Fatalf("Failed getting ordered data %s\n", err)
+	}
+	expected = []any{"company19", "company18"}
+	if !reflect.DeepEqual(expected, names(tableData.Records)) || tableData.Metadata.ResultSet.Total != 8 {
+		t.Fatalf("Expected %v, got %v %v", expected, names(tableData.Records), tableData.Metadata.ResultSet)
+	}
+
+	// multiple columns, ties on col4_int are ordered by col1_int desc
+	query = Query{OrderBy: []OrderBy{{Col: "col4_int"}, {Col: "col1_int", Order: "desc"}}, Limit: 3}
+	tableData, err = mr.GetData(table, query)
+	if err != nil {
+		t.Fatalf("Failed getting ordered data %s\n", err)
+	}
+	expected = []any{"company5", "company1", "company11"}
+	if !reflect.DeepEqual(expected, names(tableData.Records)) {
+		t.Fatalf("Expected %v, got %v", expected, names(tableData.Records))
+	}
+	query.Offset = 22
+	tableData, err = mr.GetData(table, query)
+	if err != nil {
+		t.Fatalf("Failed getting ordered data %s\n", err)
+	}
+	if tableData.Metadata.ResultSet.Count != 2 || tableData.Metadata.ResultSet.Total != 24 {
+		t.Fatalf("Paging does not match %v", tableData.Metadata.ResultSet)
+	}
+
+	// the sort is cached for the pages, mutations sort again
+	tableStruct, err := mr.getTable(table)
+	if err != nil {
+		t.Fatalf("Failed getting table struct %s\n", err)
+	}
+	cached, err := mr.Client.Keys(Ctx, tableStruct.formatKeyPrefix()+":sortcache:*").Result()
+	if err != nil || len(cached) != 1 {
+		t.Fatalf("Expected one cached sort, got %v %v", cached, err)
+	}
+	_, err = mr.CreateRecord(table, strings.NewReader(`{"records": [{"col1_int": "1", "col2_string": "company0", "col3_string": "AMER", "col4_int": "-1"}]}`))
+	if err != nil {
+		t.Fatalf("Failed creating record %s\n", err)
+	}
+	query.Offset = 0
+	tableData, err = mr.GetData(table, query)
+	if err != nil {
+		t.Fatalf("Failed getting ordered data %s\n", err)
+	}
+	expected = []any{"company0", "company5", "company1"}
+	if !reflect.DeepEqual(expected, names(tableData.Records)) || tableData.Metadata.ResultSet.Total != 25 {
+		t.Fatalf("Expected %v, got %v %v", expected, names(tableData.Records), tableData.Metadata.ResultSet)
+	}
+
+	// only sortable columns
+	_, err = mr.GetData(table, Query{OrderBy: []OrderBy{{Col: "col2_string"}}})
+	if err == nil {
+		t.Fatalf("Not failing for order by non-sortable column")
+	}
+	_, err = mr.GetData(table, Query{OrderBy: []OrderBy{{Col: "col4_int", Order: "up"}}})
+	if err == nil {
+		t.Fatalf("Not failing for invalid order")
+	}
+}
+
+func TestGetOrderedDataNulls(t *testing.T) {
+	mr := newMiniRedis(t)
+
+	schema := Schema{
+		Name: "nulls",
+		Columns: []Column{
+			{Name: "name", DataType: "string"},
+			{Name: "score", DataType: "int", Filterable: true, Sortable: true, Nullable: true},
+		},
+	}
+	err := mr.AddSchema(&schema)
+	if err != nil {
+		t.Fatalf("Failed adding schema %s\n", err)
+	}
+	data := "name,score\nacme,3\nglobex,\ninitech,1\numbrella,2\n"
+	err = mr.BulkLoad(schema.Name, strings.NewReader(data), "csv")
+	if err != nil {
+		t.Fatalf("Failed loading data %s\n", err)
+	}
+
+	// nulls are last in both orders
+	for order, expected := range map[string][]any{
+		"asc":  {"initech", "umbrella", "acme", "globex"},
+		"desc": {"acme", "umbrella", "initech", "globex"},
+	} {
+		query := Query{OrderBy: []OrderBy{{Col: "score", Order: order}}}
+		tableData, err := mr.GetData(schema.Name, query)
+		if err != nil {
+			t.Fatalf("Failed getting ordered data %s\n", err)
+		}
+		names := make([]any, 0)
+		for _, r := range tableData.Records {
+			names = append(names, r["name"])
+		}
+		if !reflect.DeepEqual(expected, names) {
+			t.Fatalf("Expected %v for %s, got %v", expected, order, names)
+		}
+	}
+
+	// paging across values and nulls
+	query := Query{OrderBy: []OrderBy{{Col: "score"}}, Limit: 2, Offset: 2}
+	tableData, err := mr.GetData(schema.Name, query)
+	if err != nil {
+		t.Fatalf("Failed getting ordered data %s\n", err)
+	}
+	if len(tableData.Records) != 2 || tableData.Records[1]["name"] != "globex" || tableData.Records[1]["score"] != nil {
+		t.Fatalf("Expected acme and globex, got %v", tableData.Records)
+	}
+}
+
+func TestSortRecordKeys(t *testing.T) {
+	mr := newMiniRedis(t)
+
+	schema := Schema{
+		Name: "ties",
+		Columns: []Column{
+			{Name: "grp", DataType: "string", Filterable: true},
+			{Name: "n", DataType: "int", Filterable: true, Sortable: true},
+		},
+	}
+	err := mr.AddSchema(&schema)
+	if err != nil {
+		t.Fatalf("Failed adding schema %s\n", err)
+	}
+	data := "grp,n\n" + strings.Repeat("a,1\n", 12)
+	err = mr.BulkLoad(schema.Name, strings.NewReader(data), "csv")
+	if err != nil {
+		t.Fatalf("Failed loading data %s\n", err)
+	}
+	table, err := mr.getTable(schema.Name)
+	if err != nil {
+		t.Fatalf("Failed getting table %s\n", err)
+	}
+
+	// ties keep the load order, not the order of the record keys as strings
+	key, err := mr.getQueryKey(table, Query{Filters: []Filter{{Col: "grp", Op: EqualTo, Val: []string{"a"}}}})
+	if err != nil {
+		t.Fatalf("Failed getting query key %s\n", err)
+	}
+	keys, err := mr.sortRecordKeys(table, key, []OrderBy{{Col: "n"}, {Col: "grp"}})
+	if err != nil {
+		t.Fatalf("Failed sorting %s\n", err)
+	}
+	expected := make([]string, 0, 12)
+	for i := 0; i < 12; i++ {
+		expected = append(expected, table.formatRecordKey(i))
+	}
+	if !reflect.DeepEqual(expected, keys) {
+		t.Fatalf("Expected %v, got %v", expected, keys)
+	}
+
+	// too many records to sort in memory
+	big := table.formatKeyPrefix() + ":big"
+	members := make([]redis.Z, 0, MaxMultiSortRecords+1)
+	for i := 0; i <= MaxMultiSortRecords; i++ {
+		members = append(members, redis.Z{Score: float64(i), Member: table.formatRecordKey(i)})
+	}
+	err = mr.Client.ZAdd(Ctx, big, members...).Err()
+	if err != nil {
+		t.Fatalf("Failed adding records %s\n", err)
+	}
+	_, err = mr.sortRecordKeys(table, big, []OrderBy{{Col: "n"}, {Col: "grp"}})
+	if err == nil {
+		t.Fatalf("Not failing for more than %d records", MaxMultiSortRecords)
+	}
+}
+
+func TestGetStringOrderedData(t *testing.T) {
+	mr := newMiniRedis(t)
+
+	schema := Schema{
+		Name: "fruits",
+		Columns: []Column{
+			{Name: "name", DataType: "string", Filterable: true, Sortable: true, Nullable: true, Collation: CollationNoCase},
+			{Name: "code", DataType: "string", Filterable: true, Sortable: true},
+		},
+	}
+	err := mr.AddSchema(&schema)
+	if err != nil {
+		t.Fatalf("Failed adding schema %s\n", err)
+	}
+	data := "name,code\nbanana,b\nApple,B\ncherry,a\napple,b\n,a\n"
+	err = mr.BulkLoad(schema.Name, strings.NewReader(data), "csv")
+	if err != nil {
+		t.Fatalf("Failed loading data %s\n", err)
+	}
+
+	getNames := func(query Query) []any {
+		tableData, err := mr.GetData(schema.Name, query)
+		if err != nil {
+			t.Fatalf("Failed getting data %s\n", err)
+		}
+		n := make([]any, 0)
+		for _, r := range tableData.Records {
+			n = append(n, r["name"])
+		}
+		return n
+	}
+
+	tests := []struct {
+		query    Query
+		expected []any
+	}{
+		// nocase ties are broken by bytes
+		{Query{OrderBy: []OrderBy{{Col: "name"}}}, []any{"Apple", "apple", "banana", "cherry", nil}},
+		{Query{OrderBy: []OrderBy{{Col: "name", Order: "desc"}}, Limit: 2}, []any{"cherry", "banana"}},
+		// binary puts upper case first
+		{Query{OrderBy: []OrderBy{{Col: "code"}, {Col: "name", Order: "desc"}}}, []any{"Apple", "cherry", nil, "banana", "apple"}},
+		// ranges follow the collation
+		{Query{Filters: []Filter{{Col: "name", Op: GreaterThanOrEqual, Val: []string{"B"}}}, OrderBy: []OrderBy{{Col: "name"}}}, []any{"banana", "cherry"}},
+		{Query{Filters: []Filter{{Col: "name", Op: LessThan, Val: []string{"banana"}}}}, []any{"Apple", "apple"}},
+		{Query{Filters: []Filter{{Col: "name", Op: Between, Val: []string{"APPLE", "banana"}, Bounds: "(]"}}}, []any{"banana"}},
+		{Query{Filters: []Filter{{Col: "code", Op: GreaterThan, Val: []string{"B"}}}, OrderBy: []OrderBy{{Col: "name"}}}, []any{"apple", "banana", "cherry", nil}},
+	}
+	for _, test := range tests {
+		names := getNames(test.query)
+		if !reflect.DeepEqual(test.expected, names) {
+			t.Fatalf("Expected %v for %v, got %v", test.expected, test.query, names)
+		}
+	}
+
+	// new values are ranked on the next order by
+	_, err = mr.CreateRecord(schema.Name, strings.NewReader(`{"records": [{"name": "aardvark", "code": "z"}]}`))
+	if err != nil {
+		t.Fatalf("Failed creating record %s\n", err)
+	}
+	names := getNames(Query{OrderBy: []OrderBy{{Col: "name"}}, Limit: 1})
+	if !reflect.DeepEqual([]any{"aardvark"}, names) {
+		t.Fatalf("Expected aardvark first, got %v", names)
+	}
+
+	// updated records keep their place in the string order sets
+	table, err := mr.getTable(schema.Name)
+	if err != nil {
+		t.Fatalf("Failed getting table %s\n", err)
+	}
+	keys, _, err := mr.getRecordKeys(table, Query{Filters: []Filter{{Col: "name", Op: EqualTo, Val: []string{"banana"}}}})
+	if err != nil || len(*keys) != 1 {
+		t.Fatalf("Expected one banana record, got %v %v", keys, err)
+	}
+	err = mr.replaceRecord(table, (*keys)[0], map[string]string{"name": "banana", "code": "b"}, map[string]string{"name": "zucchini", "code": "b"})
+	if err != nil {
+		t.Fatalf("Failed replacing record %s\n", err)
+	}
+	names = getNames(Query{OrderBy: []OrderBy{{Col: "name"}}})
+	expected := []any{"aardvark", "Apple", "apple", "cherry", "zucchini", nil}
+	if !reflect.DeepEqual(expected, names) {
+		t.Fatalf("Expected %v, got %v", expected, names)
+	}
+	names = getNames(Query{OrderBy: []OrderBy{{Col: "code"}}, Limit: 2})
+	if !reflect.DeepEqual([]any{"Apple", "cherry"}, names) {
+		t.Fatalf("Expected Apple and cherry first by code, got %v", names)
+	}
+
+	// built order sets are kept and their build keys are gone
+	ttl, err := mr.Client.TTL(Ctx, table.formatOrderKey("name")).Result()
+	if err != nil || ttl != -1 {
+		t.Fatalf("Expected the order set to be kept without a TTL, got %v %v", ttl, err)
+	}
+	builds, err := mr.Client.Keys(Ctx, table.formatOrderStoreKey("*", "build", "*")).Result()
+	if err != nil || len(builds) != 0 {
+		t.Fatalf("Expected no build keys, got %v %v", builds, err)
+	}
+
+	// collations are only valid on strings
+	invalid := Schema{Name: "invalid", Columns: []Column{{Name: "n", DataType: "int", Collation: CollationNoCase}}}
+	err = mr.AddSchema(&invalid)
+	if err == nil {
+		t.Fatalf("Not failing for collation on an int column")
+	}
+	invalid = Schema{Name: "invalid", Columns: []Column{{Name: "n", DataType: "string", Collation: "blah"}}}
+	err = mr.AddSchema(&invalid)
+	if err == nil {
+		t.Fatalf("Not failing for invalid collation")
+	}
+}
+
+func TestGetProjectedData(t *testing.T) {
+	mr := newMiniRedis(t)
+
+	table, err := mr.loadXPPTestData()
+	if err != nil {
+		t.Fatalf("Failed loading xpp test data %s\n", err)
+	}
+
+	query := Query{
+		Filters: []Filter{{Col: "col2_string", Op: EqualTo, Val: []string{"company12"}}},
+		Columns: []string{"col3_string", "col1_int"},
+	}
+	tableData, err := mr.GetData(table, query)
+	if err != nil {
+		t.Fatalf("Failed getting projected data %s\n", err)
+	}
+	expected := []map[string]any{{"col3_string": "AMER", "col1_int": "111155042"}}
+	if !reflect.DeepEqual(expected, tableData.Records) {
+		t.Fatalf("Expected %v, got %v", expected, tableData.Records)
+	}
+
+	// columns must be in the schema
+	query.Columns = []string{"col1_int", "blah"}
+	_, err = mr.GetData(table, query)
+	if err == nil {
+		t.Fatalf("Not failing for column not in schema")
+	}
+	query.Columns = []string{"col1_int", "col1_int"}
+	_, err = mr.GetData(table, query)
+	if err == nil {
+		t.Fatalf("Not failing for repeated column")
+	}
+}
+
+func TestGetCursorData(t *testing.T) {
+	mr := newMiniRedis(t)
+
+	table, err := mr.loadXPPTestData()
+	if err != nil {
+		t.Fatalf("Failed loading xpp test data %s\n", err)
+	}
+
+	// scroll through AMER records ordered by col4_int
+	query := Query{
+		Filters: []Filter{{Col: "col3_string", Op: EqualTo, Val: []string{"AMER"}}},
+		OrderBy: []OrderBy{{Col: "col4_int", Order: "desc"}},
+		Columns: []string{"col2_string"},
+		Scroll:  true,
+		Limit:   5,
+	}
+	tableData, err := mr.GetData(table, query)
+	if err != nil {
+		t.Fatalf("Failed opening cursor %s\n", err)
+	}
+	if tableData.Metadata.Cursor == "" || tableData.Metadata.ResultSet.Total != 11 {
+		t.Fatalf("Expected a cursor over 11 records, got %v", tableData.Metadata)
+	}
+	first := tableData.Records[0]["col2_string"]
+
+	// records created mid scroll don't shift the pages
+	_, err = mr.CreateRecord(table, strings.NewReader(`{"records": [
+		{"col2_string": "company99", "col1_int": "1", "col3_string": "AMER", "col4_int": "99999999"}
+	]}`))
+	if err != nil {
+		t.Fatalf("Failed creating record %s\n", err)
+	}
+
+	seen := len(tableData.Records)
+	pages := 1
+	for tableData.Metadata.Cursor != "" {
+		tableData, err = mr.GetData(table, Query{Cursor: tableData.Metadata.Cursor})
+		if err != nil {
+			t.Fatalf("Failed reading cursor %s\n", err)
+		}
+		for _, r := range tableData.Records {
+			if r["col2_string"] == "company99" || len(r) != 1 {
+				t.Fatalf("Unexpected record in snapshot %v", r)
+			}
+		}
+		seen += len(tableData.Records)
+		pages++
+	}
+	if seen != 11 || pages != 3 {
+		t.Fatalf("Expected 11 records in 3 pages, got %d in %d", seen, pages)
+	}
+
+	// a new scroll sees the new record
+	tableData, err = mr.GetData(table, query)
+	if err != nil {
+		t.Fatalf("Failed opening cursor %s\n", err)
+	}
+	if tableData.Records[0]["col2_string"] != "company99" || first == "company99" {
+		t.Fatalf("Expected company99 first in a new scroll, got %v", tableData.Records[0])
+	}
+
+	// multiple order by columns are snapshotted by position
+	query = Query{OrderBy: []OrderBy{{Col: "col4_int"}, {Col: "col1_int", Order: "desc"}}, Scroll: true, Limit: 20}
+	tableData, err = mr.GetData(table, query)
+	if err != nil {
+		t.Fatalf("Failed opening cursor %s\n", err)
+	}
+	tableData, err = mr.GetData(table, Query{Cursor: tableData.Metadata.Cursor})
+	if err != nil || len(tableData.Records) != 5 || tableData.Records[4]["col2_string"] != "company99" {
+		t.Fatalf("Expected company99 last, got %v %v", tableData, err)
+	}
+
+	// cursors opened through an alias are read through it, not through other aliases
+	err = mr.AddSchema(&Schema{Name: "other", Columns: []Column{{Name: "id", DataType: "string"}}})
+	if err != nil {
+		t.Fatalf("Failed adding schema %s\n", err)
+	}
+	for alias, target := range map[string]string{"live": table, "unrelated": "other"} {
+		err = mr.AddAlias(alias, target)
+		if err != nil {
+			t.Fatalf("Failed adding alias %s\n", err)
+		}
+	}
+	tableData, err = mr.GetData("live", Query{Scroll: true, Limit: 5})
+	if err != nil {
+		t.Fatalf("Failed opening cursor %s\n", err)
+	}
+	_, err = mr.GetData("unrelated", Query{Cursor: tableData.Metadata.Cursor})
+	if err != ErrInvalidCursor {
+		t.Fatalf("Not failing for a cursor read through another alias, got %v", err)
+	}
+	_, err = mr.GetData("live", Query{Cursor: tableData.Metadata.Cursor})
+	if err != nil {
+		t.Fatalf("Failed reading cursor through its alias %s\n", err)
+	}
+
+	// invalid and expired cursors
+	_, err = mr.GetData(table, Query{Cursor: "blah"})
+	if err != ErrInvalidCursor {
+		t.Fatalf("Not failing for invalid cursor")
+	}
+	token, _ := encodeCursor(cursorToken{Table: table, ID: "missing"})
+	_, err = mr.GetData(table, Query{Cursor: token})
+	if err != ErrInvalidCursor {
+		t.Fatalf("Not failing for expired cursor")
+	}
+}
+
+func TestCountData(t *testing.T) {
+	mr := newMiniRedis(t)
+
+	table, err := mr.loadXPPTestData()
+	if err != nil {
+		t.Fatalf("Failed loading xpp test data %s\n", err)
+	}
+
+	data, err := mr.GetData(table, Query{})
+	if err != nil {
+		t.Fatalf("Failed getting data %s\n", err)
+	}
+	count, err := mr.CountData(table, Query{})
+	if err != nil || count != int64(data.Metadata.ResultSet.Total) {
+		t.Fatalf("Expected %d records, got %d %v", data.Metadata.ResultSet.Total, count, err)
+	}
+
+	amer := Query{Filters: []Filter{{Col: "col3_string", Op: EqualTo, Val: []string{"AMER"}}}}
+	count, err = mr.CountData(table, amer)
+	if err != nil || count != 11 {
+		t.Fatalf("Expected 11 AMER records, got %d %v", count, err)
+	}
+	exists, err := mr.ExistsData(table, amer)
+	if err != nil || !exists {
+		t.Fatalf("Expected AMER records to exist, got %v %v", exists, err)
+	}
+
+	missing := Query{Filters: []Filter{{Col: "col3_string", Op: EqualTo, Val: []string{"MARS"}}}}
+	count, err = mr.CountData(table, missing)
+	if err != nil || count != 0 {
+		t.Fatalf("Expected no MARS records, got %d %v", count, err)
+	}
+	exists, err = mr.ExistsData(table, missing)
+	if err != nil || exists {
+		t.Fatalf("Expected no MARS records to exist, got %v %v", exists, err)
+	}
+
+	_, err = mr.CountData(table, Query{Filters: []Filter{{Col: "missing", Op: EqualTo, Val: []string{"a"}}}})
+	if err == nil {
+		t.Fatalf("Not failing for filter on a missing column")
+	}
+	_, err = mr.CountData(table, Query{SearchTerm: "AMER"})
+	if err == nil {
+		t.Fatalf("Not failing for search on a table without searchable columns")
+	}
+}
@@ -6,16 +6,34 @@ package db
 import (
 	"context"
 	"errors"
+	"sync"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// The search module is detected on first use, see hasSearchModule
 type Database struct {
 	Client *redis.Client
+
+	searchMu    sync.Mutex
+	searchKnown bool
+	search      bool
 }
 
 const (
 	MaxWorkers = 8
+	// Max number of keys given to a single SUNIONSTORE or SDIFFSTORE
+	MaxStoreKeys = 1000
+	// COUNT hint for SCAN style commands
+	ScanCount = 1000
+	// Number of matches read per FT.SEARCH page
+	SearchPageSize = 1000
+	// Matches FT.SEARCH pages through when the search module's MAXSEARCHRESULTS can't be read
+	DefaultMaxSearchResults = 10000
+	// Groups kept by an FT.AGGREGATE SORTBY without a limit, RediSearch keeps only 10 unless MAX is given
+	MaxSortedGroups = 1000000
+	// Records a query ordered by multiple columns can match, they are sorted in memory
+	MaxMultiSortRecords = 100000
 )
 
 var (
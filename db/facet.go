@@ -0,0 +1,119 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// A distinct value of a column and the number of records with it
+type Facet struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// The distinct values of a column with their counts, most frequent first
+// Nulls is the number of records where the column is null
+type FacetResponse struct {
+	Col    string  `json:"col"`
+	Values []Facet `json:"values"`
+	Nulls  int64   `json:"nulls"`
+}
+
+// Returns the distinct values of a filterable column with the number of records having each value
+// Values come from the column's registry of values and are counted from their filter sets,
+// if the query has filters, a search term or inner joins the filter sets are intersected with the matching records
+func (db *Database) GetFacets(tableName string, colName string, query Query) (*FacetResponse, error) {
+	table, err := db.getTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+	col, err := table.Schema.getColumn(colName)
+	if err != nil {
+		return nil, err
+	}
+	if !col.Filterable {
+		return nil, errors.New(fmt.Sprintf("can't get facets of non-filterable column %s", colName))
+	}
+	err = table.Schema.validateQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	plans, err := db.planJoins(table, query.Joins, query.Columns)
+	if err != nil {
+		return nil, err
+	}
+	err = db.restrictJoins(table, &query, plans)
+	if err == ErrNil {
+		// no dimension record matches an inner join
+		return &FacetResponse{Col: col.Name, Values: make([]Facet, 0)}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return db.getFacets(table, col, query)
+}
+
+// Returns the facets of a filterable column for a validated query
+func (db *Database) getFacets(table Table, col *Column, query Query) (*FacetResponse, error) {
+	colName := col.Name
+	resp := FacetResponse{Col: colName, Values: make([]Facet, 0)}
+	vals, err := db.Client.ZRange(Ctx, table.formatValuesKey(colName), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	sets := make([]string, 0, len(vals)+1)
+	for _, v := range vals {
+		sets = append(sets, table.formatFilterKey(colName, v))
+	}
+	sets = append(sets, table.formatNullKey(colName))
+
+	counts := make([]*redis.IntCmd, 0, len(sets))
+	pipe := db.Client.Pipeline()
+	if len(query.Filters) == 0 && query.Where == nil && query.search() == nil && len(query.joinSets) == 0 {
+		for _, s := range sets {
+			counts = append(counts, pipe.SCard(Ctx, s))
+		}
+	} else {
+		key, err := db.getQueryKey(table, query)
+		if err == ErrNil {
+			// a filter matched no records
+			return &resp, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// ZINTERSTORE returns the size of the intersection, every value reuses the same destination
+		dst := table.formatFacetStoreKey(colName, time.Now().String())
+		for _, s := range sets {
+			counts = append(counts, pipe.ZInterStore(Ctx, dst, &redis.ZStore{Keys: []string{key, s}}))
+		}
+		pipe.Del(Ctx, dst)
+	}
+	_, err = pipe.Exec(Ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, v := range vals {
+		if n := counts[i].Val(); n > 0 {
+			resp.Values = append(resp.Values, Facet{Value: v, Count: n})
+		}
+	}
+	resp.Nulls = counts[len(vals)].Val()
+
+	sort.SliceStable(resp.Values, func(i, j int) bool {
+		a, b := resp.Values[i], resp.Values[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return col.compareValues(a.Value, b.Value) < 0
+	})
+	return &resp, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetFacets(t *testing.T) {
+	mr := newMiniRedis(t)
+
+	schema := Schema{
+		Name: "sales",
+		Columns: []Column{
+			{Name: "region", DataType: "string", Filterable: true, Nullable: true},
+			{Name: "size", DataType: "int", Filterable: true},
+			{Name: "note", DataType: "string"},
+		},
+	}
+	err := mr.AddSchema(&schema)
+	if err != nil {
+		t.Fatalf("Failed adding schema %s\n", err)
+	}
+	err = mr.BulkLoad("sales", strings.NewReader("region,size,note\nEMEA,1,a\nAMER,2,b\nEMEA,3,c\nAPAC,3,d\n,1,e\n"), "csv")
+	if err != nil {
+		t.Fatalf("Failed loading data %s\n", err)
+	}
+
+	facets, err := mr.GetFacets("sales", "region", Query{})
+	if err != nil {
+		t.Fatalf("Failed getting facets %s\n", err)
+	}
+	expected := []Facet{{"EMEA", 2}, {"AMER", 1}, {"APAC", 1}}
+	if len(facets.Values) != len(expected) || facets.Nulls != 1 {
+		t.Fatalf("Expected facets %v and 1 null, got %v", expected, facets)
+	}
+	for i, f := range expected {
+		if facets.Values[i] != f {
+			t.Fatalf("Expected facets %v, got %v", expected, facets.Values)
+		}
+	}
+
+	// counts are intersected with the filters, values without records are left out
+	query := Query{Filters: []Filter{{Col: "size", Op: EqualTo, Val: []string{"3"}}}}
+	facets, err = mr.GetFacets("sales", "region", query)
+	if err != nil {
+		t.Fatalf("Failed getting filtered facets %s\n", err)
+	}
+	expected = []Facet{{"APAC", 1}, {"EMEA", 1}}
+	if len(facets.Values) != len(expected) || facets.Nulls != 0 {
+		t.Fatalf("Expected facets %v, got %v", expected, facets)
+	}
+	for i, f := range expected {
+		if facets.Values[i] != f {
+			t.Fatalf("Expected facets %v, got %v", expected, facets.Values)
+		}
+	}
+
+	query = Query{Filters: []Filter{{Col: "size", Op: EqualTo, Val: []string{"9"}}}}
+	facets, err = mr.GetFacets("sales", "region", query)
+	if err != nil || len(facets.Values) != 0 {
+		t.Fatalf("Expected no facets, got %v %v", facets, err)
+	}
+
+	_, err = mr.GetFacets("sales", "note", Query{})
+	if err == nil {
+		t.Fatalf("Not failing for facets of a non-filterable column")
+	}
+}
@@ -18,12 +18,42 @@ const (
 	LessThan
 	GreaterThanOrEqual
 	LessThanOrEqual
+	IsNull
+	IsNotNull
+	NotEqualTo
+	Between
+	StartsWith
+	Contains
+	In
 )
 
+// Bounds of a between filter, [ is inclusive and ( is exclusive
+var validBounds = map[string]bool{
+	"":   true, // defaults to inclusive
+	"[]": true,
+	"()": true,
+	"[)": true,
+	"(]": true,
+}
+
+// Escapes glob special characters so contains matches values literally
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
 type Filter struct {
-	Col string   `json:"col"`
-	Op  FilterOp `json:"op"`
-	Val []string `json:"val"`
+	Col    string   `json:"col"`
+	Op     FilterOp `json:"op"`
+	Val    []string `json:"val"`
+	Bounds string   `json:"bounds"`
+}
+
+// A boolean tree of filters
+// Exactly one of And, Or, Not or a leaf Filter (Col is set) must be given
+// ex: {"or": [{"and": [{"col": "region", "val": ["EMEA"]}, {"col": "revenue", "op": "gt", "val": ["100"]}]}, {"col": "tier", "val": ["gold"]}]}
+type FilterExpr struct {
+	And []FilterExpr `json:"and"`
+	Or  []FilterExpr `json:"or"`
+	Not *FilterExpr  `json:"not"`
+	Filter
 }
 
 func strToFilterOp(s string) (FilterOp, error) {
@@ -41,6 +71,20 @@ func strToFilterOp(s string) (FilterOp, error) {
 		return GreaterThanOrEqual, nil
 	case "lte":
 		return LessThanOrEqual, nil
+	case "isnull", "is null":
+		return IsNull, nil
+	case "notnull", "isnotnull", "is not null":
+		return IsNotNull, nil
+	case "ne":
+		return NotEqualTo, nil
+	case "between":
+		return Between, nil
+	case "prefix", "startswith":
+		return StartsWith, nil
+	case "contains":
+		return Contains, nil
+	case "in":
+		return In, nil
 	default:
 		return EqualTo, errors.New("op is not a correct keyword")
 	}
@@ -55,7 +99,7 @@ func (op *FilterOp) UnmarshalJSON(data []byte) error {
 	}
 
 	*op, err = strToFilterOp(s)
-	return nil
+	return err
 }
 
 // Converts URL Query to Filters, to be deprecated
@@ -81,14 +125,52 @@ func (schema *Schema) validateFilters(filters []Filter) error {
 			if f.Col == col.Name {
 				found = true
 
-				// If op is gt or lt, column must be sortable
-				if f.Op != EqualTo {
+				if f.Bounds != "" && f.Op != Between {
+					return errors.New("bounds can only be set on between ops")
+				}
+
+				switch f.Op {
+				case GreaterThan, LessThan, GreaterThanOrEqual, LessThanOrEqual:
+					// If op is gt or lt, column must be sortable
 					if !col.Sortable {
 						return errors.New(fmt.Sprintf("can't perform gt or lt on non-sortable column %s", f.Col))
 					}
 					if len(f.Val) != 1 {
 						return errors.New("gt and lt ops must have only 1 val")
 					}
+				case Between:
+					if !col.Sortable {
+						return errors.New(fmt.Sprintf("can't perform between on non-sortable column %s", f.Col))
+					}
+					if len(f.Val) != 2 {
+						return errors.New("between op must have 2 vals")
+					}
+					if !validBounds[f.Bounds] {
+						return errors.New(fmt.Sprintf("invalid bounds %s, must be one of [], (), [) or (]", f.Bounds))
+					}
+				case NotEqualTo, In:
+					if !col.Filterable {
+						return errors.New(fmt.Sprintf("can't perform ne or in on non-filterable column %s", f.Col))
+					}
+					if len(f.Val) == 0 {
+						return errors.New("ne and in ops must have at least 1 val")
+					}
+				case StartsWith, Contains:
+					// matched against the column's registry of values
+					if !col.Filterable || col.DataType != "string" {
+						return errors.New(fmt.Sprintf("can't perform prefix or contains on column %s, must be a filterable string", f.Col))
+					}
+					if len(f.Val) != 1 {
+						return errors.New("prefix and contains ops must have only 1 val")
+					}
+				case IsNull, IsNotNull:
+					// null sets are only kept for filterable columns
+					if !col.Filterable {
+						return errors.New(fmt.Sprintf("can't perform null checks on non-filterable column %s", f.Col))
+					}
+					if len(f.Val) != 0 {
+						return errors.New("isnull and notnull ops take no val")
+					}
 				}
 
 				break
@@ -101,3 +183,45 @@ func (schema *Schema) validateFilters(filters []Filter) error {
 
 	return nil
 }
+
+// validates every node of a filter tree and the filters in its leaves
+func (schema *Schema) validateFilterExpr(expr *FilterExpr) error {
+	nodes := 0
+	if expr.And != nil {
+		nodes++
+	}
+	if expr.Or != nil {
+		nodes++
+	}
+	if expr.Not != nil {
+		nodes++
+	}
+	if expr.Col != "" {
+		nodes++
+	}
+	if nodes != 1 {
+		return errors.New("filter expression must have exactly one of and, or, not or col")
+	}
+
+	switch {
+	case expr.Not != nil:
+		return schema.validateFilterExpr(expr.Not)
+	case expr.Col != "":
+		return schema.validateFilters([]Filter{expr.Filter})
+	}
+
+	children := expr.And
+	if expr.Or != nil {
+		children = expr.Or
+	}
+	if len(children) == 0 {
+		return errors.New("and and or filter expressions must not be empty")
+	}
+	for i := range children {
+		err := schema.validateFilterExpr(&children[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,13 +3,21 @@
 
 package db
 
-import "fmt"
+import (
+	"crypto/sha1"
+	"fmt"
+)
 
 var (
 	// Redis key for all schema keys
 	allSchemasKey = fmt.Sprintf("%s:schemas", Prefix)
 )
 
+const (
+	// Longest list of filter values kept as is in a temporary key
+	MaxKeyValsLength = 512
+)
+
 func (table *Table) formatKeyPrefix() string {
 	return fmt.Sprintf("%s:%s:%d", Prefix, table.Name, table.Version)
 }
@@ -47,6 +55,11 @@ func formatSchemaKey(name string) string {
 	return fmt.Sprintf("%s:%s:schema", Prefix, name)
 }
 
+// Returns key to the hash of alias name -> table name
+func formatAliasesKey() string {
+	return fmt.Sprintf("%s:aliases", Prefix)
+}
+
 // Returns key for a table's last load
 func (table *Table) formatLastLoadKey() string {
 	return fmt.Sprintf("%s:%s:lastload", Prefix, table.Name)
@@ -56,14 +69,83 @@ func (table *Table) formatAllRecordKeys() string {
 	return fmt.Sprintf("%s:all", table.formatKeyPrefix())
 }
 
+// Returns key to the plain set of all records, used as the universe for set differences
+func (table *Table) formatAllRecordSetKey() string {
+	return fmt.Sprintf("%s:allset", table.formatKeyPrefix())
+}
+
+// Returns key to the set of records where col is null
+func (table *Table) formatNullKey(col string) string {
+	return fmt.Sprintf("%s:null:%s", table.formatKeyPrefix(), col)
+}
+
+// Returns key to the sorted set of every distinct value of a filterable column
+// all members have score 0 so they are ordered lexicographically
+func (table *Table) formatValuesKey(col string) string {
+	return fmt.Sprintf("%s:values:%s", table.formatKeyPrefix(), col)
+}
+
+// Returns key to the column stats computed when the table version was loaded
+func (table *Table) formatProfileKey() string {
+	return fmt.Sprintf("%s:profile", table.formatKeyPrefix())
+}
+
+// Returns key to the HyperLogLog of the values a column was loaded with
+func (table *Table) formatDistinctKey(col string) string {
+	return fmt.Sprintf("%s:distinct:%s", table.formatKeyPrefix(), col)
+}
+
+// Returns key to the sorted set of records scored by the value of a sortable column
+func (table *Table) formatOrderKey(col string) string {
+	return fmt.Sprintf("%s:order:%s", table.formatKeyPrefix(), col)
+}
+
+// Return key for records ordered by a column, segment is vals or nulls
+// {Prefix}:{table}:{version}:orderstore:{col}:{segment}:{t}
+func (table *Table) formatOrderStoreKey(col string, segment string, t string) string {
+	return fmt.Sprintf("%s:orderstore:%s:%s:%s", table.formatKeyPrefix(), col, segment, t)
+}
+
+// Returns key to a segment of a cursor's snapshot
+func (table *Table) formatCursorKey(id string, segment int) string {
+	return fmt.Sprintf("%s:cursor:%s:%d", table.formatKeyPrefix(), id, segment)
+}
+
+// Returns key to the state of a cursor
+func (table *Table) formatCursorStateKey(id string) string {
+	return fmt.Sprintf("%s:cursor:%s:state", table.formatKeyPrefix(), id)
+}
+
+// Returns key to the counter of record mutations of a table version
+func (table *Table) formatGenerationKey() string {
+	return fmt.Sprintf("%s:generation", table.formatKeyPrefix())
+}
+
+// Returns key to the cached result of a query, it is only valid for a single generation
+// {Prefix}:{table}:{version}:querycache:{generation}:{hash}
+func (table *Table) formatQueryCacheKey(generation int64, hash string) string {
+	return fmt.Sprintf("%s:querycache:%d:%s", table.formatKeyPrefix(), generation, hash)
+}
+
+// Returns key to the cached sort of a query's records by multiple columns, it is only valid for a single generation
+// {Prefix}:{table}:{version}:sortcache:{generation}:{hash}
+func (table *Table) formatSortCacheKey(generation int64, hash string) string {
+	return fmt.Sprintf("%s:sortcache:%d:%s", table.formatKeyPrefix(), generation, hash)
+}
+
 // Return key for a Union Store from filters
-// {Prefix}:{table}:{version}:unionstore:{col}:{_vals[0]__vals[1]...__vals[n]_}:{t}
-func (table *Table) formatUnionStoreKey(col string, vals []string, t string) string {
-	key := fmt.Sprintf("%s:unionstore:%s", table.formatKeyPrefix(), col)
-	for _, v := range vals {
-		key += fmt.Sprintf("_%s_", v)
+// {Prefix}:{table}:{version}:unionstore:{col}:{op}{bounds}{_vals[0]__vals[1]...__vals[n]_}:{t}
+// long value lists, like large in filters, are replaced by their sha1
+func (table *Table) formatUnionStoreKey(f Filter, t string) string {
+	key := fmt.Sprintf("%s:unionstore:%s:%d%s", table.formatKeyPrefix(), f.Col, f.Op, f.Bounds)
+	vals := ""
+	for _, v := range f.Val {
+		vals += fmt.Sprintf("_%s_", v)
 	}
-	key += ":" + t
+	if len(vals) > MaxKeyValsLength {
+		vals = fmt.Sprintf("_%x_", sha1.Sum([]byte(vals)))
+	}
+	key += vals + ":" + t
 	return key
 }
 
@@ -78,6 +160,30 @@ func (table *Table) formatInterStoreKey(unionKeys []string, t string) string {
 	return key
 }
 
+// Return key for the join values and records that restrict a query with inner joins
+// {Prefix}:{table}:{version}:joinstore:{segment}:{t}
+func (table *Table) formatJoinStoreKey(segment string, t string) string {
+	return fmt.Sprintf("%s:joinstore:%s:%s", table.formatKeyPrefix(), segment, t)
+}
+
+// Return key for a node of a filter tree, nodes are numbered by id
+// {Prefix}:{table}:{version}:exprstore:{id}:{t}
+func (table *Table) formatExprStoreKey(id int, t string) string {
+	return fmt.Sprintf("%s:exprstore:%d:%s", table.formatKeyPrefix(), id, t)
+}
+
+// Return key the facet counts of a column are intersected into
+// {Prefix}:{table}:{version}:facetstore:{col}:{t}
+func (table *Table) formatFacetStoreKey(col string, t string) string {
+	return fmt.Sprintf("%s:facetstore:%s:%s", table.formatKeyPrefix(), col, t)
+}
+
+// Return key the order set of a column is intersected into for its stats
+// {Prefix}:{table}:{version}:statsstore:{col}:{segment}:{t}
+func (table *Table) formatStatsStoreKey(col string, segment string, t string) string {
+	return fmt.Sprintf("%s:statsstore:%s:%s:%s", table.formatKeyPrefix(), col, segment, t)
+}
+
 // returns key to the set of record ids
 func (table *Table) formatSearchIndexStoreKey(searchTerm, t string) string {
 	return fmt.Sprintf("%s:searchstore:%s:%s", table.formatKeyPrefix(), searchTerm, t)
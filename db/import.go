@@ -0,0 +1,658 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Options applied to a schema imported from another definition language
+// Those formats don't describe how columns are indexed, so flags are set by column name
+type ImportOptions struct {
+	// Overrides the table name from the definition, required if the definition has none
+	Name       string
+	Filterable []string
+	Sortable   []string
+	Searchable []string
+}
+
+var (
+	// CREATE TABLE [IF NOT EXISTS] name (
+	createTableRegex = regexp.MustCompile(`(?is)^\s*create\s+(?:(?:global\s+|local\s+)?(?:temporary|temp|unlogged)\s+)?table\s+(?:if\s+not\s+exists\s+)?([^\s(]+)\s*\(`)
+
+	// Table level constraints in a CREATE TABLE
+	tableConstraintRegex = regexp.MustCompile(`(?i)^(constraint|primary\s+key|unique|check|foreign\s+key|exclude|like)\b`)
+
+	// DEFAULT value in a column definition, either a quoted string or a single token
+	ddlDefaultRegex = regexp.MustCompile(`(?i)^default\s+('(?:[^']|'')*'|[^\s,]+)`)
+
+	// DEFAULT keyword in a masked column definition
+	ddlDefaultKeywordRegex = regexp.MustCompile(`(?i)\bdefault\s`)
+)
+
+// Maps a SQL column type to a datatype
+func sqlDataType(sqlType string) (string, error) {
+	t := strings.ToLower(sqlType)
+	// arrays are stored as their text representation
+	if strings.HasSuffix(t, "]") {
+		return "string", nil
+	}
+	// strip length and precision
+	if i := strings.IndexByte(t, '('); i >= 0 {
+		t = strings.TrimSpace(t[:i])
+	}
+
+	switch t {
+	case "smallint", "integer", "int", "int2", "int4", "int8", "bigint",
+		"smallserial", "serial", "bigserial", "serial2", "serial4", "serial8", "tinyint", "mediumint":
+		return "int", nil
+	case "real", "float", "float4", "float8", "double", "double precision", "numeric", "decimal", "money":
+		return "float", nil
+	case "boolean", "bool":
+		return "bool", nil
+	case "date", "timestamp", "timestamptz", "datetime",
+		"timestamp with time zone", "timestamp without time zone":
+		return "date", nil
+	case "text", "varchar", "character varying", "char", "character", "bpchar", "uuid",
+		"json", "jsonb", "time", "timetz", "time with time zone", "time without time zone",
+		"interval", "inet", "cidr", "citext", "string":
+		return "string", nil
+	}
+	return "", errors.New(fmt.Sprintf("unsupported sql type %s", sqlType))
+}
+
+// Removes identifier quoting and any schema qualifier, ex: "public"."sales" -> sales
+func unquoteIdentifier(s string) string {
+	parts := strings.Split(s, ".")
+	return strings.Trim(parts[len(parts)-1], "\"`[]")
+}
+
+// Splits s on commas that are not inside parentheses or quotes
+func splitTopLevel(s string) []string {
+	parts := make([]string, 0)
+	depth := 0
+	var quote rune
+	start := 0
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// Blanks quoted literals and parenthesized text of a column definition, keeping byte offsets,
+// so a DEFAULT 'not null' or a CHECK clause is not read as a constraint
+func ddlMask(s string) string {
+	b := []byte(s)
+	depth := 0
+	var quote byte
+	for i, c := range b {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+			b[i] = ' '
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			b[i] = ' '
+		case c == '(':
+			depth++
+			b[i] = ' '
+		case c == ')':
+			depth--
+			b[i] = ' '
+		case depth > 0:
+			b[i] = ' '
+		}
+	}
+	return string(b)
+}
+
+// Returns the lower case words of a column definition outside of quoted literals and parentheses
+func ddlWords(s string) []string {
+	return strings.Fields(strings.ToLower(ddlMask(s)))
+}
+
+// Returns the DEFAULT value of a column definition, the keyword is only looked up
+// outside of quoted literals and parentheses, ex: not in CHECK (x <> 'default 1')
+func ddlDefault(s string) (string, bool) {
+	loc := ddlDefaultKeywordRegex.FindStringIndex(ddlMask(s))
+	if loc == nil {
+		return "", false
+	}
+	m := ddlDefaultRegex.FindStringSubmatch(s[loc[0]:])
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// Returns true if the words hold the keywords one after the other
+func hasKeywords(words []string, keywords ...string) bool {
+	for i := 0; i+len(keywords) <= len(words); i++ {
+		found := true
+		for k, kw := range keywords {
+			if words[i+k] != kw {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// Splits a column definition into its name and the rest of the definition
+func splitColumnDefinition(def string) (string, string) {
+	def = strings.TrimSpace(def)
+	if def == "" {
+		return "", ""
+	}
+	if q := def[0]; q == '"' || q == '`' {
+		if end := strings.IndexByte(def[1:], q); end >= 0 {
+			return def[1 : end+1], strings.TrimSpace(def[end+2:])
+		}
+	}
+	fields := strings.Fields(def)
+	return fields[0], strings.TrimSpace(def[len(fields[0]):])
+}
+
+// Returns the sql type at the start of a column definition
+// Multi word types (ex: double precision) are matched before single word types
+func sqlColumnType(rest string) string {
+	lower := strings.ToLower(rest)
+	for _, t := range []string{
+		"double precision", "character varying", "timestamp with time zone", "timestamp without time zone",
+		"time with time zone", "time without time zone",
+	} {
+		if strings.HasPrefix(lower, t) {
+			return rest[:len(t)]
+		}
+	}
+	end := strings.IndexFunc(rest, func(r rune) bool { return r == ' ' || r == '\t' || r == '\n' })
+	if end < 0 {
+		end = len(rest)
+	}
+	// keep precision, ex: numeric(10, 2)
+	if p := strings.IndexByte(rest, '('); p >= 0 && p <= end {
+		if c := strings.IndexByte(rest, ')'); c > p {
+			end = c + 1
+		}
+	}
+	return rest[:end]
+}
+
+// Parses a single CREATE TABLE statement into a schema
+// Columns are nullable unless declared NOT NULL or PRIMARY KEY, constant defaults are kept
+func parseDDL(ddl string) (*Schema, error) {
+	match := createTableRegex.FindStringSubmatchIndex(ddl)
+	if match == nil {
+		return nil, errors.New("expected a CREATE TABLE statement")
+	}
+	name := unquoteIdentifier(ddl[match[2]:match[3]])
+
+	// Find the matching closing parenthesis of the column list
+	body := ddl[match[1]:]
+	depth := 1
+	end := -1
+	var quote rune
+	for i, r := range body {
+		if quote != 0 {
+			if r == quote {
+				quote = 0
+			}
+			continue
+		}
+		if r == '\'' || r == '"' || r == '`' {
+			quote = r
+		} else if r == '(' {
+			depth++
+		} else if r == ')' {
+			depth--
+			if depth == 0 {
+				end = i
+				break
+			}
+		}
+	}
+	if end < 0 {
+		return nil, errors.New("unterminated CREATE TABLE column list")
+	}
+
+	schema := Schema{Name: name}
+	for _, def := range splitTopLevel(body[:end]) {
+		def = strings.TrimSpace(def)
+		if def == "" || tableConstraintRegex.MatchString(def) {
+			continue
+		}
+
+		colName, rest := splitColumnDefinition(def)
+		sqlType := sqlColumnType(rest)
+		dt, err := sqlDataType(sqlType)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("column %s: %s", colName, err))
+		}
+
+		words := ddlWords(rest)
+		col := Column{
+			Name:     colName,
+			DataType: dt,
+			Nullable: !hasKeywords(words, "not", "null") && !hasKeywords(words, "primary", "key"),
+		}
+
+		// Only constant defaults are kept, ex: DEFAULT 0 or DEFAULT 'n/a'::text
+		if val, ok := ddlDefault(rest); ok {
+			if i := strings.Index(val, "::"); i >= 0 {
+				val = val[:i]
+			}
+			if strings.HasPrefix(val, "'") {
+				val = strings.ReplaceAll(strings.Trim(val, "'"), "''", "'")
+				col.Default = &val
+			} else if !strings.EqualFold(val, "null") && !strings.Contains(val, "(") &&
+				!strings.HasPrefix(strings.ToLower(val), "current_") {
+				col.Default = &val
+			}
+		}
+		schema.Columns = append(schema.Columns, col)
+	}
+
+	if len(schema.Columns) == 0 {
+		return nil, errors.New(fmt.Sprintf("no columns found for table %s", name))
+	}
+	return &schema, nil
+}
+
+type avroField struct {
+	Name    string          `json:"name"`
+	Type    json.RawMessage `json:"type"`
+	Default json.RawMessage `json:"default"`
+}
+
+type avroRecord struct {
+	Type   string      `json:"type"`
+	Name   string      `json:"name"`
+	Fields []avroField `json:"fields"`
+}
+
+// Maps an avro type to a datatype, unions with null are nullable
+func avroDataType(raw json.RawMessage) (string, bool, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return "", false, errors.New("missing type")
+	}
+
+	switch raw[0] {
+	case '"':
+		var t string
+		err := json.Unmarshal(raw, &t)
+		if err != nil {
+			return "", false, err
+		}
+		switch t {
+		case "int", "long":
+			return "int", false, nil
+		case "float", "double":
+			return "float", false, nil
+		case "boolean":
+			return "bool", false, nil
+		case "string", "bytes", "enum", "fixed":
+			return "string", false, nil
+		}
+		return "", false, errors.New(fmt.Sprintf("unsupported avro type %s", t))
+	case '[':
+		var union []json.RawMessage
+		err := json.Unmarshal(raw, &union)
+		if err != nil {
+			return "", false, err
+		}
+		dt := ""
+		nullable := false
+		for _, u := range union {
+			if string(bytes.TrimSpace(u)) == `"null"` {
+				nullable = true
+				continue
+			}
+			if dt != "" {
+				return "", false, errors.New("avro unions of more than one non null type are not supported")
+			}
+			dt, _, err = avroDataType(u)
+			if err != nil {
+				return "", false, err
+			}
+		}
+		if dt == "" {
+			return "", false, errors.New("avro union has no non null type")
+		}
+		return dt, nullable, nil
+	case '{':
+		var complexType struct {
+			Type        string `json:"type"`
+			LogicalType string `json:"logicalType"`
+		}
+		err := json.Unmarshal(raw, &complexType)
+		if err != nil {
+			return "", false, err
+		}
+		switch complexType.LogicalType {
+		case "date", "timestamp-millis", "timestamp-micros", "local-timestamp-millis", "local-timestamp-micros":
+			return "date", false, nil
+		case "decimal":
+			return "float", false, nil
+		case "uuid", "time-millis", "time-micros":
+			return "string", false, nil
+		}
+		switch complexType.Type {
+		case "record", "array", "map":
+			return "", false, errors.New(fmt.Sprintf("nested avro type %s is not supported", complexType.Type))
+		}
+		return avroDataType(json.RawMessage(fmt.Sprintf("%q", complexType.Type)))
+	}
+	return "", false, errors.New(fmt.Sprintf("invalid avro type %s", raw))
+}
+
+// Returns the symbols of an avro enum type, including an enum in a union with null
+func avroEnumSymbols(raw json.RawMessage) []string {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return nil
+	}
+	if raw[0] == '[' {
+		var union []json.RawMessage
+		if json.Unmarshal(raw, &union) != nil {
+			return nil
+		}
+		for _, u := range union {
+			if symbols := avroEnumSymbols(u); symbols != nil {
+				return symbols
+			}
+		}
+		return nil
+	}
+
+	var enumType struct {
+		Type    string   `json:"type"`
+		Symbols []string `json:"symbols"`
+	}
+	if raw[0] != '{' || json.Unmarshal(raw, &enumType) != nil || enumType.Type != "enum" {
+		return nil
+	}
+	return enumType.Symbols
+}
+
+// Formats a json default as a column default, null and nested values have no default
+func jsonDefault(raw json.RawMessage) *string {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" || raw[0] == '{' || raw[0] == '[' {
+		return nil
+	}
+	var s string
+	if raw[0] == '"' {
+		if json.Unmarshal(raw, &s) != nil {
+			return nil
+		}
+	} else {
+		s = string(raw)
+	}
+	return &s
+}
+
+// Parses an avro record schema into a schema
+func parseAvro(data []byte) (*Schema, error) {
+	var record avroRecord
+	err := json.Unmarshal(data, &record)
+	if err != nil {
+		return nil, err
+	}
+	if record.Type != "record" {
+		return nil, errors.New("expected an avro record schema")
+	}
+
+	schema := Schema{Name: record.Name}
+	for _, field := range record.Fields {
+		dt, nullable, err := avroDataType(field.Type)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("field %s: %s", field.Name, err))
+		}
+		schema.Columns = append(schema.Columns, Column{
+			Name:     field.Name,
+			DataType: dt,
+			Nullable: nullable,
+			Default:  jsonDefault(field.Default),
+			Enum:     avroEnumSymbols(field.Type),
+		})
+	}
+	return &schema, nil
+}
+
+type jsonSchemaProperty struct {
+	Type      json.RawMessage `json:"type"`
+	Format    string          `json:"format"`
+	Enum      []any           `json:"enum"`
+	Default   json.RawMessage `json:"default"`
+	Minimum   *float64        `json:"minimum"`
+	Maximum   *float64        `json:"maximum"`
+	MaxLength *int            `json:"maxLength"`
+	Pattern   string          `json:"pattern"`
+}
+
+// Maps a JSON Schema property to a datatype, properties that allow null are nullable
+func jsonSchemaDataType(prop jsonSchemaProperty) (string, bool, error) {
+	types := make([]string, 0)
+	raw := bytes.TrimSpace(prop.Type)
+	switch {
+	case len(raw) == 0 && len(prop.Enum) > 0:
+		types = append(types, "string")
+	case len(raw) > 0 && raw[0] == '[':
+		err := json.Unmarshal(raw, &types)
+		if err != nil {
+			return "", false, err
+		}
+	case len(raw) > 0:
+		var t string
+		err := json.Unmarshal(raw, &t)
+		if err != nil {
+			return "", false, err
+		}
+		types = append(types, t)
+	default:
+		return "", false, errors.New("missing type")
+	}
+
+	dt := ""
+	nullable := false
+	for _, t := range types {
+		if t == "null" {
+			nullable = true
+			continue
+		}
+		if dt != "" {
+			return "", false, errors.New("properties with more than one non null type are not supported")
+		}
+		switch t {
+		case "integer":
+			dt = "int"
+		case "number":
+			dt = "float"
+		case "boolean":
+			dt = "bool"
+		case "string":
+			dt = "string"
+			if prop.Format == "date" || prop.Format == "date-time" {
+				dt = "date"
+			}
+		default:
+			return "", false, errors.New(fmt.Sprintf("unsupported json schema type %s", t))
+		}
+	}
+	if dt == "" {
+		return "", false, errors.New("property has no non null type")
+	}
+	return dt, nullable, nil
+}
+
+// Returns the keys of a json object in the order they are defined
+func orderedJSONKeys(raw json.RawMessage) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, errors.New("expected a json object")
+	}
+
+	keys := make([]string, 0)
+	for dec.More() {
+		tok, err = dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, tok.(string))
+
+		var skip json.RawMessage
+		err = dec.Decode(&skip)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// Parses a JSON Schema object document into a schema, properties keep their defined order
+// Properties that are not required are nullable
+func parseJSONSchema(data []byte) (*Schema, error) {
+	var doc struct {
+		Title      string                        `json:"title"`
+		Type       string                        `json:"type"`
+		Properties map[string]jsonSchemaProperty `json:"properties"`
+		Required   []string                      `json:"required"`
+	}
+	err := json.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Type != "object" || len(doc.Properties) == 0 {
+		return nil, errors.New("expected a json schema object with properties")
+	}
+
+	var raw struct {
+		Properties json.RawMessage `json:"properties"`
+	}
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := orderedJSONKeys(raw.Properties)
+	if err != nil {
+		return nil, err
+	}
+
+	required := make(map[string]bool, len(doc.Required))
+	for _, r := range doc.Required {
+		required[r] = true
+	}
+
+	schema := Schema{Name: doc.Title}
+	for _, key := range keys {
+		prop := doc.Properties[key]
+		dt, nullable, err := jsonSchemaDataType(prop)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("property %s: %s", key, err))
+		}
+		col := Column{
+			Name:      key,
+			DataType:  dt,
+			Nullable:  nullable || !required[key],
+			Default:   jsonDefault(prop.Default),
+			Min:       prop.Minimum,
+			Max:       prop.Maximum,
+			MaxLength: prop.MaxLength,
+			Pattern:   prop.Pattern,
+		}
+		for _, e := range prop.Enum {
+			if e != nil {
+				col.Enum = append(col.Enum, fmt.Sprint(e))
+			}
+		}
+		schema.Columns = append(schema.Columns, col)
+	}
+	return &schema, nil
+}
+
+// Sets flag on every column in names, returns an error if a column is not in the schema
+func (schema *Schema) setColumnFlags(names []string, set func(col *Column)) error {
+	for _, name := range names {
+		col, err := schema.getColumn(name)
+		if err != nil {
+			return err
+		}
+		set(col)
+	}
+	return nil
+}
+
+// Converts a schema definition from another format into a Schema
+// format options are ("sql", "avro", "jsonschema")
+func ImportSchema(data []byte, format string, opts ImportOptions) (*Schema, error) {
+	var schema *Schema
+	var err error
+
+	switch format {
+	case "sql":
+		schema, err = parseDDL(string(data))
+	case "avro":
+		schema, err = parseAvro(data)
+	case "jsonschema":
+		schema, err = parseJSONSchema(data)
+	default:
+		return nil, errors.New("invalid schema format")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Name != "" {
+		schema.Name = opts.Name
+	}
+	if schema.Name == "" {
+		return nil, errors.New("schema has no name")
+	}
+
+	err = schema.setColumnFlags(opts.Filterable, func(col *Column) { col.Filterable = true })
+	if err != nil {
+		return nil, err
+	}
+	// sortable columns must also be filterable
+	err = schema.setColumnFlags(opts.Sortable, func(col *Column) { col.Filterable = true; col.Sortable = true })
+	if err != nil {
+		return nil, err
+	}
+	err = schema.setColumnFlags(opts.Searchable, func(col *Column) { col.Searchable = true })
+	if err != nil {
+		return nil, err
+	}
+
+	return schema, nil
+}
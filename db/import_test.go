@@ -0,0 +1,161 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImportSchemaSQL(t *testing.T) {
+	ddl := `CREATE TABLE IF NOT EXISTS public."sales" (
+		id bigserial PRIMARY KEY,
+		customer varchar(255) NOT NULL,
+		region text DEFAULT 'n/a'::text,
+		revenue numeric(12, 2) DEFAULT 0,
+		price double precision,
+		active boolean NOT NULL DEFAULT true,
+		created_at timestamp with time zone DEFAULT now(),
+		note text DEFAULT 'not null' CHECK (note IS NOT NULL OR id > 0),
+		code text CHECK (code <> 'default 1'),
+		label text COLLATE "default",
+		CONSTRAINT sales_customer_fk FOREIGN KEY (customer) REFERENCES customers (name)
+	);`
+
+	schema, err := ImportSchema([]byte(ddl), "sql", ImportOptions{
+		Filterable: []string{"region"},
+		Sortable:   []string{"revenue"},
+		Searchable: []string{"customer"},
+	})
+	if err != nil {
+		t.Fatalf("Failed importing ddl %s\n", err)
+	}
+
+	na := "n/a"
+	zero := "0"
+	yes := "true"
+	notNull := "not null"
+	expected := Schema{
+		Name: "sales",
+		Columns: []Column{
+			{Name: "id", DataType: "int"},
+			{Name: "customer", DataType: "string", Searchable: true},
+			{Name: "region", DataType: "string", Filterable: true, Nullable: true, Default: &na},
+			{Name: "revenue", DataType: "float", Filterable: true, Sortable: true, Nullable: true, Default: &zero},
+			{Name: "price", DataType: "float", Nullable: true},
+			{Name: "active", DataType: "bool", Default: &yes},
+			{Name: "created_at", DataType: "date", Nullable: true},
+			{Name: "note", DataType: "string", Nullable: true, Default: &notNull},
+			{Name: "code", DataType: "string", Nullable: true},
+			{Name: "label", DataType: "string", Nullable: true},
+		},
+	}
+	if !reflect.DeepEqual(expected, *schema) {
+		t.Fatalf("Expected %v, got %v", expected, *schema)
+	}
+
+	// flags on missing columns
+	_, err = ImportSchema([]byte(ddl), "sql", ImportOptions{Filterable: []string{"blah"}})
+	if err == nil {
+		t.Fatalf("Not failing for flag on a column that does not exist")
+	}
+
+	// unsupported types
+	_, err = ImportSchema([]byte("CREATE TABLE t (geo geometry)"), "sql", ImportOptions{})
+	if err == nil {
+		t.Fatalf("Not failing for unsupported sql type")
+	}
+}
+
+func TestImportSchemaAvro(t *testing.T) {
+	avro := `{
+		"type": "record",
+		"name": "customers",
+		"namespace": "com.example",
+		"fields": [
+			{"name": "id", "type": "long"},
+			{"name": "name", "type": "string"},
+			{"name": "tier", "type": ["null", "string"], "default": null},
+			{"name": "score", "type": "double", "default": 1.5},
+			{"name": "signup", "type": {"type": "int", "logicalType": "date"}},
+			{"name": "kind", "type": {"type": "enum", "name": "Kind", "symbols": ["A", "B"]}}
+		]
+	}`
+
+	schema, err := ImportSchema([]byte(avro), "avro", ImportOptions{})
+	if err != nil {
+		t.Fatalf("Failed importing avro %s\n", err)
+	}
+
+	score := "1.5"
+	expected := Schema{
+		Name: "customers",
+		Columns: []Column{
+			{Name: "id", DataType: "int"},
+			{Name: "name", DataType: "string"},
+			{Name: "tier", DataType: "string", Nullable: true},
+			{Name: "score", DataType: "float", Default: &score},
+			{Name: "signup", DataType: "date"},
+			{Name: "kind", DataType: "string", Enum: []string{"A", "B"}},
+		},
+	}
+	if !reflect.DeepEqual(expected, *schema) {
+		t.Fatalf("Expected %v, got %v", expected, *schema)
+	}
+
+	// nested records are not supported
+	nested := `{"type": "record", "name": "n", "fields": [{"name": "a", "type": {"type": "record", "name": "b", "fields": []}}]}`
+	_, err = ImportSchema([]byte(nested), "avro", ImportOptions{})
+	if err == nil {
+		t.Fatalf("Not failing for nested avro record")
+	}
+}
+
+func TestImportSchemaJSONSchema(t *testing.T) {
+	jsonSchema := `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"zip": {"type": "string"},
+			"count": {"type": "integer", "default": 0},
+			"ratio": {"type": ["number", "null"]},
+			"updated": {"type": "string", "format": "date-time"},
+			"status": {"enum": ["open", "closed"]},
+			"code": {"type": "string", "pattern": "[A-Z]{3}", "maxLength": 3},
+			"pct": {"type": "number", "minimum": 0, "maximum": 100}
+		},
+		"required": ["zip", "count", "ratio"]
+	}`
+
+	// json schema has no title, name must be given
+	_, err := ImportSchema([]byte(jsonSchema), "jsonschema", ImportOptions{})
+	if err == nil {
+		t.Fatalf("Not failing for schema with no name")
+	}
+
+	schema, err := ImportSchema([]byte(jsonSchema), "jsonschema", ImportOptions{Name: "zips"})
+	if err != nil {
+		t.Fatalf("Failed importing json schema %s\n", err)
+	}
+
+	zero := "0"
+	three := 3
+	min := 0.0
+	max := 100.0
+	expected := Schema{
+		Name: "zips",
+		Columns: []Column{
+			{Name: "zip", DataType: "string"},
+			{Name: "count", DataType: "int", Default: &zero},
+			{Name: "ratio", DataType: "float", Nullable: true},
+			{Name: "updated", DataType: "date", Nullable: true},
+			{Name: "status", DataType: "string", Nullable: true, Enum: []string{"open", "closed"}},
+			{Name: "code", DataType: "string", Nullable: true, Pattern: "[A-Z]{3}", MaxLength: &three},
+			{Name: "pct", DataType: "float", Nullable: true, Min: &min, Max: &max},
+		},
+	}
+	if !reflect.DeepEqual(expected, *schema) {
+		t.Fatalf("Expected %v, got %v", expected, *schema)
+	}
+}
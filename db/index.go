@@ -27,15 +27,31 @@ There will be some fields that don't want to search on for the general search ca
 3. IMPORTANT: Figure out how to enable testing for RediSearch!!!!!!
 */
 
-// Returns the redis data_type for the index's schema
+// Returns the redis data_type for the index's schema, empty if the column is not indexed
+// Searchable strings are full-text searched, other filterable strings are matched exactly as tags
 func (col *Column) columnIndexFieldType() string {
+	if !col.Searchable && !col.Filterable {
+		return ""
+	}
 	if col.DataType == "int" || col.DataType == "float" {
 		return "NUMERIC"
 	}
+	if !col.Searchable {
+		return "TAG"
+	}
 	return "TEXT"
 }
 
+// Separates the values of a TAG field, tags are single values so it is a character that doesn't occur in data
+const tagSeparator = "\x1f"
+
 func (db *Database) createIndexToPipe(table Table, pipe *redis.Pipeliner) error {
+	_, err := (*pipe).Do(Ctx, table.createIndexArgs()...).Result()
+	return err
+}
+
+// Returns the FT.CREATE command of the table's index
+func (table *Table) createIndexArgs() []any {
 	args := []any{
 		"FT.CREATE",
 		table.formatTableIndex(),
@@ -48,38 +64,129 @@ func (db *Database) createIndexToPipe(table Table, pipe *redis.Pipeliner) error
 	}
 
 	for _, col := range table.Schema.Columns {
-		if col.Searchable {
-			args = append(args, col.Name, col.columnIndexFieldType())
+		fieldType := col.columnIndexFieldType()
+		if fieldType == "" {
+			continue
+		}
+		args = append(args, col.Name, fieldType)
 
-			if col.Sortable {
-				args = append(args, "SORTABLE")
-			}
+		if fieldType == "TAG" {
+			// the default separator is a comma, which would split values like "a, b" into several tags
+			args = append(args, "SEPARATOR", tagSeparator, "CASESENSITIVE")
+		}
+		if col.Sortable {
+			args = append(args, "SORTABLE")
 		}
 	}
-
-	_, err := (*pipe).Do(Ctx, args...).Result()
-	return err
+	return args
 }
 
 // performs a search on the index and stores record keys in returned string
-func (db *Database) searchIndexStore(table Table, searchTerm string) (string, error) {
+// All matches are read page by page into a sorted set scored by their rank, so the best match comes first
+func (db *Database) searchIndexStore(table Table, search *Search) (string, error) {
 	t := time.Now().String()
-	args := []any{
-		"FT.SEARCH",
-		table.formatTableIndex(),
-		fmt.Sprintf("%q", searchTerm), // %q adds "" around variable
-		"NOCONTENT",
+	searchQuery := search.queryString()
+	searchStoreKey := table.formatSearchIndexStoreKey(searchQuery, t)
+
+	offset := 0
+	for {
+		args := []any{
+			"FT.SEARCH",
+			table.formatTableIndex(),
+			searchQuery,
+			"NOCONTENT",
+			"LIMIT",
+			offset,
+			SearchPageSize,
+		}
+
+		// do the search
+		res, err := db.Client.Do(Ctx, args...).Result()
+		if err != nil {
+			return "", err
+		}
+		results, ok := res.([]any)
+		if !ok || len(results) == 0 {
+			return "", errors.New(fmt.Sprintf("unexpected search results for %s", search.Term))
+		}
+		total, _ := results[0].(int64)
+		keys := results[1:]
+
+		// FT.SEARCH can't page past MAXSEARCHRESULTS, fail before reading a partial result
+		if offset == 0 && total > int64(len(keys)) {
+			if max := db.getMaxSearchResults(); max >= 0 && total > max {
+				return "", errors.New(fmt.Sprintf("search %s matches %d records, more than the %d the search module returns, narrow the search or raise MAXSEARCHRESULTS", search.Term, total, max))
+			}
+		}
+
+		// Add record keys to a sorted set, scored by rank
+		if len(keys) > 0 {
+			members := make([]redis.Z, 0, len(keys))
+			for i, k := range keys {
+				members = append(members, redis.Z{Score: float64(offset + i), Member: k})
+			}
+			_, err = db.Client.ZAdd(Ctx, searchStoreKey, members...).Result()
+			if err != nil {
+				return "", err
+			}
+		}
+
+		offset += len(keys)
+		if len(keys) < SearchPageSize || int64(offset) >= total {
+			break
+		}
 	}
+	return searchStoreKey, db.expireTempKeys(searchStoreKey)
+}
 
-	// do the search
-	res, _ := db.Client.Do(Ctx, args...).Result()
+// Returns the MAXSEARCHRESULTS of the search module, the number of matches FT.SEARCH can page through
+// -1 is unlimited, the default is used if the setting can't be read
+func (db *Database) getMaxSearchResults() int64 {
+	res, err := db.Client.Do(Ctx, "FT.CONFIG", "GET", "MAXSEARCHRESULTS").Result()
+	if err != nil {
+		return DefaultMaxSearchResults
+	}
+	return parseMaxSearchResults(res)
+}
+
+// Parses the reply of FT.CONFIG GET MAXSEARCHRESULTS, a list of name and value pairs
+func parseMaxSearchResults(res any) int64 {
+	pairs, ok := res.([]any)
+	if !ok || len(pairs) == 0 {
+		return DefaultMaxSearchResults
+	}
+	pair, ok := pairs[0].([]any)
+	if !ok || len(pair) < 2 {
+		return DefaultMaxSearchResults
+	}
+	val, _ := pair[1].(string)
+	if strings.ToLower(val) == "unlimited" {
+		return -1
+	}
+	max, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return DefaultMaxSearchResults
+	}
+	return max
+}
 
-	keys := res.([]any)
-	searchStoreKey := table.formatSearchIndexStoreKey(searchTerm, t)
+// Returns the key to the records of key that match the search, ordered by relevance
+func (db *Database) getSearchRecordKeys(table Table, key string, search *Search) (string, error) {
+	searchStoreKey, err := db.searchIndexStore(table, search)
+	if err != nil {
+		return "", err
+	}
 
-	// Add record keys to a set
-	_, err := db.Client.SAdd(Ctx, searchStoreKey, keys[1:]).Result()
-	return searchStoreKey, err
+	// Run a ZINTERSTORE with the search keys, only the rank of the search is kept as score
+	_, err = db.Client.ZInterStore(Ctx, searchStoreKey,
+		&redis.ZStore{
+			Keys:    []string{key, searchStoreKey},
+			Weights: []float64{0, 1},
+		}).Result()
+	if err != nil {
+		return "", err
+	}
+	return searchStoreKey, db.expireTempKeys(searchStoreKey)
 }
 
 func (db *Database) AggregateData(tableName string, aggReq AggRequest) ([]map[string]string, error) {
@@ -87,25 +194,16 @@ func (db *Database) AggregateData(tableName string, aggReq AggRequest) ([]map[st
 	if err != nil {
 		return nil, err
 	}
-	args := []any{
-		`FT.AGGREGATE`,
-		table.formatTableIndex(),
-		"*",
-		"groupby"}
-
-	args = append(args, len(aggReq.Groupby))
-
-	for _, val := range aggReq.Groupby {
-		args = append(args, fmt.Sprintf("@%s", val))
+	err = table.Schema.validateAggRequest(&aggReq)
+	if err != nil {
+		return nil, err
 	}
-
-	args = append(args, "reduce", aggReq.Operation)
-	if strings.ToLower(aggReq.Operation) == "count" {
-		args = append(args, "0", "as", fmt.Sprintf("%s_result", aggReq.Operation))
-	} else {
-		args = append(args, "1",
-			fmt.Sprintf("@%s", aggReq.Column), "as",
-			fmt.Sprintf("%s_result", aggReq.Operation))
+	if !db.hasSearchModule() {
+		return db.aggregateNative(table, &aggReq)
+	}
+	args, err := table.aggregateArgs(&aggReq)
+	if err != nil {
+		return nil, err
 	}
 
 	res, err := db.Client.Do(context.Background(), args...).Result()
@@ -127,6 +225,9 @@ func (db *Database) AggregateData(tableName string, aggReq AggRequest) ([]map[st
 		}
 		resSlice = append(resSlice, resMap)
 	}
+	if aggReq.Bucket != nil {
+		return table.finishTimeBuckets(resSlice, &aggReq)
+	}
 	return resSlice, nil
 }
 
@@ -135,65 +236,84 @@ func (db *Database) DeleteRecord(tableName string, reqBody RecGetDelRequest) (in
 	if err != nil {
 		return 0, err
 	}
+	conditions, err := table.Schema.conditionsQuery(reqBody.Conditions)
+	if err != nil {
+		return 0, err
+	}
 	args := []any{
 		`FT.SEARCH`,
 		table.formatTableIndex(),
+		conditions,
 	}
 
-	var sb strings.Builder
-	for _, condition := range reqBody.Conditions {
-		sb.WriteString(fmt.Sprintf("@%s:%s", condition.Column, condition.Value))
-	}
-	args = append(args, sb.String())
 	res, err := db.Client.Do(context.Background(), args...).Result()
 	if err != nil {
 		return 0, err
 	}
 	results := res.([]interface{})
-	if results[0].(int64) == 0 {
+	recordKeys, records := table.Schema.exactMatches(results[1:], reqBody.Conditions)
+	if len(recordKeys) == 0 {
 		return 0, errors.New("no records exists, correct the delete conditions")
 	}
-	results = results[1:]
 	delRecCount := int64(0)
-	for in, _ := range results {
-		if in < len(results)-1 && in%2 == 0 {
-			hk := results[in].(string)
-			res := results[in+1]
-			resOne := res.([]interface{})
-			resMap := make(map[string]string)
-			for index, _ := range resOne {
-				if index%2 == 0 && index < len(resOne)-1 {
-					resMap[resOne[index].(string)] = resOne[index+1].(string)
-				}
-			}
-			delHashMembers := make([]string, 0)
-			for k, _ := range resMap {
-				delHashMembers = append(delHashMembers, k)
-			}
+	for i, hk := range recordKeys {
+		delHashMembers := make([]string, 0)
+		for k, _ := range records[i] {
+			delHashMembers = append(delHashMembers, k)
+		}
 
-			err = deleteRecords(db, table, delHashMembers, resMap, hk)
-			if err != nil {
-				return 0, err
-			}
-			delRecCount++
+		err = deleteRecords(db, table, delHashMembers, records[i], hk)
+		if err != nil {
+			return 0, err
 		}
+		delRecCount++
 	}
 	return delRecCount, nil
 }
 
 func deleteRecords(db *Database, table Table, delKeys []string, resMap map[string]string, hk string) error {
 	var err error
-	for index := 0; index < len(delKeys); index++ {
-		if table.Schema.Columns[index].Filterable {
-			key := table.Schema.Columns[index].Name
-			filterKey := table.formatFilterKey(key, resMap[key])
-			_, err = db.Client.SRem(Ctx, filterKey, hk).Result()
+	for _, col := range table.Schema.Columns {
+		if !col.Filterable {
+			continue
+		}
+		if col.Sortable {
+			_, err = db.Client.ZRem(Ctx, table.formatOrderKey(col.Name), hk).Result()
+			if err != nil {
+				return err
+			}
+		}
+		val, ok := resMap[col.Name]
+		if !ok {
+			// null values are only tracked in the null set
+			_, err = db.Client.SRem(Ctx, table.formatNullKey(col.Name), hk).Result()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		filterKey := table.formatFilterKey(col.Name, val)
+		_, err = db.Client.SRem(Ctx, filterKey, hk).Result()
+		if err != nil {
+			return err
+		}
+		// Only drop the value from the registry and sorted set once no other record has it
+		n, err := db.Client.SCard(Ctx, filterKey).Result()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			_, err = db.Client.ZRem(Ctx, table.formatValuesKey(col.Name), val).Result()
 			if err != nil {
 				return err
 			}
-			if table.Schema.Columns[index].Sortable {
-				sortKey := table.formatSortableKey(key)
-				_, err = db.Client.ZRem(Ctx, sortKey, filterKey).Result()
+			if col.Sortable {
+				// string values are kept by their collation member
+				member := filterKey
+				if col.DataType == "string" {
+					member = col.lexMember(val)
+				}
+				_, err = db.Client.ZRem(Ctx, table.formatSortableKey(col.Name), member).Result()
 				if err != nil {
 					return err
 				}
@@ -205,11 +325,15 @@ func deleteRecords(db *Database, table Table, delKeys []string, resMap map[strin
 	if err != nil {
 		return err
 	}
+	_, err = db.Client.SRem(Ctx, table.formatAllRecordSetKey(), hk).Result()
+	if err != nil {
+		return err
+	}
 	_, err = db.Client.HDel(context.Background(), hk, delKeys...).Result()
 	if err != nil {
 		return err
 	}
-	return nil
+	return db.Client.Incr(Ctx, table.formatGenerationKey()).Err()
 }
 
 func (db *Database) UpdateRecord(tableName string, reqBody RecUpdateRequest) (int64, error) {
@@ -217,108 +341,155 @@ func (db *Database) UpdateRecord(tableName string, reqBody RecUpdateRequest) (in
 	if err != nil {
 		return 0, err
 	}
+	conditions, err := table.Schema.conditionsQuery(reqBody.Conditions)
+	if err != nil {
+		return 0, err
+	}
 	args := []any{
 		`FT.SEARCH`,
 		table.formatTableIndex(),
+		conditions,
 	}
 
-	var sb strings.Builder
-	for _, condition := range reqBody.Conditions {
-		sb.WriteString(fmt.Sprintf("@%s:%s", condition.Column, condition.Value))
-	}
-	args = append(args, sb.String())
 	res, err := db.Client.Do(context.Background(), args...).Result()
 	if err != nil {
 		return 0, err
 	}
 	results := res.([]interface{})
-	numRec := results[0].(int64)
-	if numRec == 0 {
+	recordKeys, records := table.Schema.exactMatches(results[1:], reqBody.Conditions)
+	if len(recordKeys) == 0 {
 		return 0, errors.New("no records found, check your search criteria")
 	}
 
-	results = results[1:]
-	updateRecCount := int64(0)
-	for in, _ := range results {
-		if in < len(results)-1 && in%2 == 0 {
-			recordKey := results[in].(string)
-			res := results[in+1]
-			resOne := res.([]interface{})
-			oldData := make(map[string]string)
-			for index, _ := range resOne {
-				if index%2 == 0 && index < len(resOne)-1 {
-					oldData[resOne[index].(string)] = resOne[index+1].(string)
-				}
-			}
-			changeData := make(map[string]string)
-			changes := reqBody.Changes
-			updatedData := make(map[string]string)
-			for k, v := range oldData {
+	changeData := make(map[string]string)
+	for _, change := range reqBody.Changes {
+		changeData[change.Column] = change.Value
+	}
+
+	// Validate every updated record before changing any of them
+	checker, err := newConstraintChecker(&table.Schema)
+	if err != nil {
+		return 0, err
+	}
+	updates := make([]map[string]string, len(records))
+	for i, oldData := range records {
+		updatedData := make(map[string]string)
+		for k, v := range oldData {
+			updatedData[k] = v
+		}
+		for k, v := range changeData {
+			// null columns are missing from the record but can still be set
+			if _, err := table.Schema.getColumn(k); err == nil {
 				updatedData[k] = v
 			}
-			for _, change := range changes {
-				changeData[change.Column] = change.Value
-			}
+		}
+		checker.checkRecord(i, recordKeys[i], updatedData)
+		updates[i] = updatedData
+	}
+	err = checker.errs.err()
+	if err != nil {
+		return 0, err
+	}
 
-			for k, v := range changeData {
-				_, ok := updatedData[k]
-				if ok {
-					updatedData[k] = v
-				}
-			}
+	updateRecCount := int64(0)
+	for i, recordKey := range recordKeys {
+		err = db.replaceRecord(table, recordKey, records[i], updates[i])
+		if err != nil {
+			return 0, err
+		}
+		updateRecCount++
+	}
+	return updateRecCount, nil
+}
 
-			delKeys := make([]string, 0)
-			for k, _ := range oldData {
-				delKeys = append(delKeys, k)
-			}
+// Replaces the values of a record, oldData is the record as stored and updatedData its new values
+// The record is deleted from its filter, null and order sets and added back with the new values
+func (db *Database) replaceRecord(table Table, recordKey string, oldData map[string]string, updatedData map[string]string) error {
+	delKeys := make([]string, 0)
+	for k, _ := range oldData {
+		delKeys = append(delKeys, k)
+	}
 
-			// Clean Delete
-			err = deleteRecords(db, table, delKeys, oldData, recordKey)
-			if err != nil {
-				return 0, err
-			}
-			header := make([]string, 0)
-			row := make([]string, 0)
-			for key, val := range updatedData {
-				header = append(header, key)
-				row = append(row, val)
-			}
-			csvData := [][]string{
-				header, row,
-			}
+	// Clean Delete
+	err := deleteRecords(db, table, delKeys, oldData, recordKey)
+	if err != nil {
+		return err
+	}
+	header := make([]string, 0)
+	row := make([]string, 0)
+	for key, val := range updatedData {
+		header = append(header, key)
+		row = append(row, val)
+	}
+	csvData := [][]string{
+		header, row,
+	}
 
-			buffer := new(bytes.Buffer)
-			csvWriter := csv.NewWriter(buffer)
-			err = csvWriter.WriteAll(csvData)
-			if err != nil {
-				return 0, err
-			}
+	buffer := new(bytes.Buffer)
+	csvWriter := csv.NewWriter(buffer)
+	err = csvWriter.WriteAll(csvData)
+	if err != nil {
+		return err
+	}
 
-			r := csv.NewReader(buffer)
-			headerMap, schemaMap, err := parseCSVHeader(r, table.Schema)
-			if err != nil {
-				return 0, err
-			}
-			pipe := db.Client.TxPipeline()
-			parts := strings.Split(recordKey, ":")
-			strSeq := parts[len(parts)-1]
-			seq, err := strconv.Atoi(strSeq)
-			if err != nil {
-				return 0, err
-			}
-			record, err := r.Read()
-			if err != nil {
-				return 0, err
-			}
-			recordToPipe(table, &pipe, record, seq, headerMap, schemaMap)
-			_, err = pipe.Exec(Ctx)
-			if err != nil {
-				return 0, err
-			}
-			updateRecCount++
+	r := csv.NewReader(buffer)
+	headerMap, schemaMap, err := parseCSVHeader(r, table.Schema)
+	if err != nil {
+		return err
+	}
+	pipe := db.Client.TxPipeline()
+	parts := strings.Split(recordKey, ":")
+	strSeq := parts[len(parts)-1]
+	seq, err := strconv.Atoi(strSeq)
+	if err != nil {
+		return err
+	}
+	record, err := r.Read()
+	if err != nil {
+		return err
+	}
+	// values come from the stored record, where null columns are left out, so none of them is null
+	opts := LoadOptions{nulls: make([]bool, len(record))}
+	recordToPipe(table, &pipe, record, seq, headerMap, schemaMap, opts)
+	// string order sets aren't updated per record, deleteRecords dropped the record from them
+	for c := range table.Schema.Columns {
+		invalidateStringOrderToPipe(table, &pipe, &table.Schema.Columns[c])
+	}
+	invalidateQueryCacheToPipe(table, &pipe)
+	_, err = pipe.Exec(Ctx)
+	return err
+}
+
+// Converts the FT.SEARCH results after the count into the record keys and records that exactly match the conditions
+// Conditions on text columns are searched as phrases, so records that only contain the value are left out before
+// they are changed
+func (schema *Schema) exactMatches(results []interface{}, conditions []Condition) ([]string, []map[string]string) {
+	keys, records := searchResultsToRecords(results)
+	matchedKeys := make([]string, 0, len(keys))
+	matched := make([]map[string]string, 0, len(records))
+	for i, record := range records {
+		if schema.matchesTextConditions(record, conditions) {
+			matchedKeys = append(matchedKeys, keys[i])
+			matched = append(matched, record)
 		}
 	}
-	return updateRecCount, nil
+	return matchedKeys, matched
+}
+
+// Converts the FT.SEARCH results after the count into record keys and records
+func searchResultsToRecords(results []interface{}) ([]string, []map[string]string) {
+	keys := make([]string, 0, len(results)/2)
+	records := make([]map[string]string, 0, len(results)/2)
+	for in := 0; in < len(results)-1; in += 2 {
+		fields := results[in+1].([]interface{})
+		record := make(map[string]string)
+		for index := 0; index < len(fields)-1; index += 2 {
+			record[fields[index].(string)] = fields[index+1].(string)
+		}
+		keys = append(keys, results[in].(string))
+		records = append(records, record)
+	}
+	return keys, records
 }
 
 func (db *Database) GetRecord(tableName string, reqBody RecGetDelRequest) ([]map[string]string, error) {
@@ -326,16 +497,16 @@ func (db *Database) GetRecord(tableName string, reqBody RecGetDelRequest) ([]map
 	if err != nil {
 		return nil, err
 	}
+	conditions, err := table.Schema.conditionsQuery(reqBody.Conditions)
+	if err != nil {
+		return nil, err
+	}
 	args := []any{
 		`FT.SEARCH`,
 		table.formatTableIndex(),
+		conditions,
 	}
 
-	var sb strings.Builder
-	for _, condition := range reqBody.Conditions {
-		sb.WriteString(fmt.Sprintf("@%s:%s", condition.Column, condition.Value))
-	}
-	args = append(args, sb.String())
 	res, err := db.Client.Do(context.Background(), args...).Result()
 	if err != nil {
 		return nil, err
@@ -191,7 +191,7 @@ func TestIndex_SearchIndexStore(t *testing.T) {
 		t.Errorf("Failed to load data due to error : %s", err.Error())
 	}
 
-	_, err = db.searchIndexStore(table, "AMER")
+	_, err = db.searchIndexStore(table, &Search{Term: "AMER"})
 	if err != nil {
 		t.Errorf("Search failed with erro %s", err.Error())
 	}
@@ -357,3 +357,84 @@ func TestIndex_GetRecord(t *testing.T) {
 		}
 	}
 }
+
+func TestIndex_GetSearchData(t *testing.T) {
+	defer cleanData()
+	if err := setUp(); err != nil {
+		t.Errorf("Test setup failed with err : %s", err.Error())
+	}
+	if err := loadData(); err != nil {
+		t.Errorf("Failed to load data due to error : %s", err.Error())
+	}
+
+	res, err := db.GetData(TableName, Query{SearchTerm: "AMER"})
+	if err != nil {
+		t.Errorf("GetData with search term failed due to error : %s", err.Error())
+	}
+	if len(res.Records) != 1 || res.Records[0]["col2_string"] != "VMW" {
+		t.Errorf("Expected to get the VMW record but got %v", res.Records)
+	}
+
+	// search results are intersected with the filters
+	res, err = db.GetData(TableName, Query{
+		SearchTerm: "AMER",
+		Filters:    []Filter{{Col: "col3_string", Op: EqualTo, Val: []string{"EMEA"}}},
+	})
+	if err != nil && err != ErrNil {
+		t.Errorf("GetData with search term and filters failed due to error : %s", err.Error())
+	}
+	if err == nil && len(res.Records) != 0 {
+		t.Errorf("Expected no records but got %v", res.Records)
+	}
+}
+
+func TestIndex_GetHighlightedSearchData(t *testing.T) {
+	defer cleanData()
+	if err := setUp(); err != nil {
+		t.Errorf("Test setup failed with err : %s", err.Error())
+	}
+	if err := loadData(); err != nil {
+		t.Errorf("Failed to load data due to error : %s", err.Error())
+	}
+
+	search := &Search{Term: "AM", Columns: []string{"col3_string"}, Mode: SearchPrefix, Highlight: true}
+	res, err := db.GetData(TableName, Query{Search: search})
+	if err != nil {
+		t.Errorf("GetData with search failed due to error : %s", err.Error())
+	}
+	if len(res.Records) != 1 || len(res.Highlights) != 1 {
+		t.Errorf("Expected 1 highlighted record but got %v %v", res.Records, res.Highlights)
+	}
+	if res.Highlights[0]["col3_string"] != HighlightOpenTag+"AMER"+HighlightCloseTag {
+		t.Errorf("Expected AMER to be highlighted but got %v", res.Highlights[0])
+	}
+}
+
+func TestIndex_AggregateReducers(t *testing.T) {
+	defer cleanData()
+	if err := setUp(); err != nil {
+		t.Errorf("Test setup failed with err : %s", err.Error())
+	}
+	if err := loadData(); err != nil {
+		t.Errorf("Failed to load data due to error : %s", err.Error())
+	}
+
+	aggReq := AggRequest{
+		Groupby: []string{"col3_string"},
+		Reducers: []Reducer{
+			{Op: ReduceCount},
+			{Op: ReduceMax, Col: "col4_int", As: "max"},
+		},
+		Query:   &Query{Filters: []Filter{{Col: "col4_int", Op: GreaterThan, Val: []string{"5"}}}},
+		Having:  []Filter{{Col: "max", Op: GreaterThan, Val: []string{"20"}}},
+		OrderBy: []OrderBy{{Col: "max", Order: "desc"}},
+		Limit:   10,
+	}
+	res, err := db.AggregateData(TableName, aggReq)
+	if err != nil {
+		t.Errorf("Aggregation failed due to error %s", err.Error())
+	}
+	if len(res) != 1 || res[0]["col3_string"] != "AMER" || res[0]["max"] != "50" || res[0]["count"] != "1" {
+		t.Errorf("Expected only the AMER group but got %v", res)
+	}
+}
@@ -0,0 +1,415 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/parquet-go"
+)
+
+const (
+	// Max number of rows read from a sample when inferring a schema
+	InferSampleRows = 10000
+
+	// Columns with more distinct values than this are not suggested as filterable
+	InferMaxFilterableDistinct = 1000
+
+	// Columns where distinct values / non null rows is above this ratio are not suggested as filterable
+	InferMaxFilterableRatio = 0.5
+)
+
+var (
+	// Layouts a value must match to be inferred as a date
+	dateLayouts = []string{
+		"2006-01-02",
+		"2006-01-02 15:04:05",
+		"2006-01-02T15:04:05",
+		time.RFC3339,
+		time.RFC3339Nano,
+	}
+)
+
+// Tracks the values seen for a single column while sampling
+type columnProfile struct {
+	name     string
+	nulls    int
+	values   int
+	distinct map[string]struct{}
+
+	// Candidate datatypes, a candidate is dropped once a value doesn't parse
+	isInt   bool
+	isFloat bool
+	isBool  bool
+	isDate  bool
+
+	// datatype given by a typed source (ex: parquet), if empty it is inferred from the values
+	datatype string
+}
+
+func newColumnProfile(name string) *columnProfile {
+	return &columnProfile{
+		name:     name,
+		distinct: make(map[string]struct{}),
+		isInt:    true,
+		isFloat:  true,
+		isBool:   true,
+		isDate:   true,
+	}
+}
+
+func isDate(val string) bool {
+	for _, layout := range dateLayouts {
+		if _, err := time.Parse(layout, val); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Adds a sampled value to the profile
+func (p *columnProfile) observe(val string, null bool) {
+	if null {
+		p.nulls++
+		return
+	}
+	p.values++
+
+	// Stop tracking once the column is too distinct to be filterable
+	if len(p.distinct) <= InferMaxFilterableDistinct {
+		p.distinct[val] = struct{}{}
+	}
+
+	if p.isInt {
+		if _, err := strconv.ParseInt(val, 10, 64); err != nil {
+			p.isInt = false
+		}
+	}
+	if p.isFloat {
+		if _, err := strconv.ParseFloat(val, 64); err != nil {
+			p.isFloat = false
+		}
+	}
+	if p.isBool {
+		if !strings.EqualFold(val, "true") && !strings.EqualFold(val, "false") {
+			p.isBool = false
+		}
+	}
+	if p.isDate && !isDate(val) {
+		p.isDate = false
+	}
+}
+
+// Returns the inferred datatype of the column
+func (p *columnProfile) dataType() string {
+	if p.datatype != "" {
+		return p.datatype
+	}
+	switch {
+	case p.values == 0:
+		return "string"
+	case p.isInt:
+		return "int"
+	case p.isFloat:
+		return "float"
+	case p.isBool:
+		return "bool"
+	case p.isDate:
+		return "date"
+	}
+	return "string"
+}
+
+// Suggests a column from the profile
+// Columns are filterable when they have a low enough cardinality, bools are always filterable
+// Filterable numeric columns are also sortable so they can be range filtered, sorting builds on the filter sets
+// Other strings are searchable
+func (p *columnProfile) toColumn() Column {
+	col := Column{
+		Name:     p.name,
+		DataType: p.dataType(),
+		Nullable: p.nulls > 0,
+	}
+
+	distinct := len(p.distinct)
+	if col.DataType == "bool" {
+		col.Filterable = true
+	} else if p.values > 0 && distinct <= InferMaxFilterableDistinct &&
+		float64(distinct)/float64(p.values) <= InferMaxFilterableRatio {
+		col.Filterable = true
+	}
+	if numericDataType(col.DataType) && col.Filterable {
+		col.Sortable = true
+	}
+	if col.DataType == "string" && !col.Filterable {
+		col.Searchable = true
+	}
+	return col
+}
+
+// Profiles the header and up to InferSampleRows rows of csv data
+func csvToProfiles(f io.Reader, nullToken string) ([]*columnProfile, error) {
+	r := csv.NewReader(f)
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, errors.New("empty csv")
+	} else if err != nil {
+		return nil, err
+	}
+
+	profiles := make([]*columnProfile, len(header))
+	for i, name := range header {
+		profiles[i] = newColumnProfile(name)
+	}
+
+	for n := 0; n < InferSampleRows; n++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		for i, val := range record {
+			profiles[i].observe(val, val == nullToken)
+		}
+	}
+	return profiles, nil
+}
+
+// Reads a json object keeping the order of its keys
+// Returns the keys and the values formatted as strings, nil values are null
+func readOrderedJSONObject(raw json.RawMessage) ([]string, []*string, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, nil, errors.New("json records must be objects")
+	}
+
+	keys := make([]string, 0)
+	vals := make([]*string, 0)
+	for dec.More() {
+		tok, err = dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key := tok.(string)
+
+		var v any
+		err = dec.Decode(&v)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var s *string
+		switch val := v.(type) {
+		case nil:
+		case string:
+			s = &val
+		case json.Number:
+			str := val.String()
+			s = &str
+		case bool:
+			str := strconv.FormatBool(val)
+			s = &str
+		default:
+			// nested values are kept as their json encoding
+			b, _ := json.Marshal(val)
+			str := string(b)
+			s = &str
+		}
+		keys = append(keys, key)
+		vals = append(vals, s)
+	}
+	return keys, vals, nil
+}
+
+// Reads json records from either an array of objects or an object with a "records" array
+func readJSONRecords(f io.Reader) ([]json.RawMessage, error) {
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("empty json")
+	}
+
+	var records []json.RawMessage
+	if data[0] == '[' {
+		err = json.Unmarshal(data, &records)
+		return records, err
+	}
+
+	var body struct {
+		Records []json.RawMessage `json:"records"`
+	}
+	err = json.Unmarshal(data, &body)
+	return body.Records, err
+}
+
+// Profiles up to InferSampleRows json records, columns are ordered by first appearance
+func jsonToProfiles(f io.Reader, nullToken string) ([]*columnProfile, error) {
+	records, err := readJSONRecords(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("no json records found")
+	}
+
+	profiles := make([]*columnProfile, 0)
+	profileMap := make(map[string]*columnProfile)
+	for n, raw := range records {
+		if n >= InferSampleRows {
+			break
+		}
+		keys, vals, err := readOrderedJSONObject(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		seen := make(map[string]bool, len(keys))
+		for i, key := range keys {
+			p, ok := profileMap[key]
+			if !ok {
+				p = newColumnProfile(key)
+				// Column was missing from all of the previous records
+				p.nulls = n
+				profileMap[key] = p
+				profiles = append(profiles, p)
+			}
+			seen[key] = true
+			if vals[i] == nil {
+				p.observe("", true)
+			} else {
+				p.observe(*vals[i], *vals[i] == nullToken)
+			}
+		}
+		// missing keys are null
+		for _, p := range profiles {
+			if !seen[p.name] {
+				p.observe("", true)
+			}
+		}
+	}
+	return profiles, nil
+}
+
+// Maps a parquet column type to a datatype
+func parquetDataType(t parquet.Type) string {
+	if lt := t.LogicalType(); lt != nil {
+		switch {
+		case lt.Date != nil, lt.Timestamp != nil:
+			return "date"
+		case lt.Decimal != nil:
+			return "float"
+		case lt.UTF8 != nil, lt.Enum != nil, lt.Json != nil, lt.UUID != nil:
+			return "string"
+		}
+	}
+	switch t.Kind() {
+	case parquet.Boolean:
+		return "bool"
+	case parquet.Int32, parquet.Int64:
+		return "int"
+	case parquet.Int96:
+		return "date"
+	case parquet.Float, parquet.Double:
+		return "float"
+	}
+	return "string"
+}
+
+// Profiles up to InferSampleRows rows of a parquet file, only flat schemas are supported
+// Datatypes are taken from the parquet schema instead of being inferred from the values
+func parquetToProfiles(f io.Reader) ([]*columnProfile, error) {
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	file, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	fields := file.Schema().Fields()
+	profiles := make([]*columnProfile, len(fields))
+	for i, field := range fields {
+		if !field.Leaf() {
+			return nil, errors.New(fmt.Sprintf("nested parquet column %s is not supported", field.Name()))
+		}
+		profiles[i] = newColumnProfile(field.Name())
+		profiles[i].datatype = parquetDataType(field.Type())
+	}
+
+	reader := parquet.NewReader(file)
+	defer reader.Close()
+
+	rows := make([]parquet.Row, 100)
+	total := 0
+	for total < InferSampleRows {
+		n, err := reader.ReadRows(rows)
+		for _, row := range rows[:n] {
+			for _, v := range row {
+				profiles[v.Column()].observe(v.String(), v.IsNull())
+			}
+		}
+		total += n
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return profiles, nil
+}
+
+// Infers a schema named name from a sample in f
+// format signifies how data is stored in f, options are ("csv", "json", "parquet")
+// Cells matching nullToken are treated as null, as they are on load
+func InferSchema(name string, f io.Reader, format string, nullToken string) (*Schema, error) {
+	var profiles []*columnProfile
+	var err error
+
+	switch format {
+	case "csv":
+		profiles, err = csvToProfiles(f, nullToken)
+	case "json":
+		profiles, err = jsonToProfiles(f, nullToken)
+	case "parquet":
+		profiles, err = parquetToProfiles(f)
+	default:
+		return nil, errors.New("invalid file format")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	schema := Schema{
+		Name:    name,
+		Columns: make([]Column, 0, len(profiles)),
+	}
+	for _, p := range profiles {
+		schema.Columns = append(schema.Columns, p.toColumn())
+	}
+
+	err = validateSchema(&schema)
+	if err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
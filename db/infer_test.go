@@ -0,0 +1,104 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInferSchemaCSV(t *testing.T) {
+	f, err := os.Open("testData/test_data_small.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	schema, err := InferSchema("table1", f, "csv", "")
+	if err != nil {
+		t.Fatalf("Failed inferring schema %s\n", err)
+	}
+
+	expected := Schema{
+		Name: "table1",
+		Columns: []Column{
+			{Name: "col2_string", DataType: "string", Searchable: true},
+			{Name: "col1_int", DataType: "int"},
+			{Name: "col3_string", DataType: "string", Filterable: true},
+			{Name: "col4_int", DataType: "float"},
+		},
+	}
+	if !reflect.DeepEqual(expected, *schema) {
+		t.Fatalf("Expected %v, got %v", expected, *schema)
+	}
+
+	// inferred schema can be loaded as is
+	mr := newMiniRedis(t)
+	err = mr.AddSchema(schema)
+	if err != nil {
+		t.Fatalf("Failed adding inferred schema %s\n", err)
+	}
+	f.Seek(0, 0)
+	err = mr.BulkLoad(schema.Name, f, "csv")
+	if err != nil {
+		t.Fatalf("Failed loading with inferred schema %s\n", err)
+	}
+}
+
+func TestInferSchemaJSON(t *testing.T) {
+	data := `{"records": [
+		{"id": 1, "active": true, "joined": "2023-01-02", "score": 1.5, "level": 1},
+		{"id": 2, "active": false, "joined": "2023-02-03", "score": 2, "note": "late", "level": 1},
+		{"id": 3, "active": true, "joined": null, "score": 3, "level": 1}
+	]}`
+	schema, err := InferSchema("json", strings.NewReader(data), "json", "")
+	if err != nil {
+		t.Fatalf("Failed inferring schema %s\n", err)
+	}
+
+	expected := []Column{
+		// unique numbers would make a filter set per record
+		{Name: "id", DataType: "int"},
+		{Name: "active", DataType: "bool", Filterable: true},
+		{Name: "joined", DataType: "date", Nullable: true},
+		{Name: "score", DataType: "float"},
+		{Name: "level", DataType: "int", Filterable: true, Sortable: true},
+		{Name: "note", DataType: "string", Nullable: true, Searchable: true},
+	}
+	if !reflect.DeepEqual(expected, schema.Columns) {
+		t.Fatalf("Expected %v, got %v", expected, schema.Columns)
+	}
+
+	// not an array of objects
+	_, err = InferSchema("json", strings.NewReader(`[1, 2]`), "json", "")
+	if err == nil {
+		t.Fatalf("Not failing for json records that are not objects")
+	}
+}
+
+func TestInferSchemaParquet(t *testing.T) {
+	// name string, region string, amount double, count optional int64
+	f, err := os.Open("testData/test_sample.parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	schema, err := InferSchema("pq", f, "parquet", "")
+	if err != nil {
+		t.Fatalf("Failed inferring schema %s\n", err)
+	}
+
+	expected := []Column{
+		{Name: "name", DataType: "string", Searchable: true},
+		{Name: "region", DataType: "string", Filterable: true},
+		{Name: "amount", DataType: "float"},
+		{Name: "count", DataType: "int", Nullable: true},
+	}
+	if !reflect.DeepEqual(expected, schema.Columns) {
+		t.Fatalf("Expected %v, got %v", expected, schema.Columns)
+	}
+}
@@ -0,0 +1,389 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Kinds of joins, inner joins only return records with a matching dimension record
+const (
+	JoinInner = "inner"
+	JoinLeft  = "left"
+)
+
+// Enriches the records of a query with the columns of the matching record of a dimension table
+// A record matches the dimension record whose Col equals the record's On, Col defaults to On
+// Filters and Where select the dimension records that can match, Columns are added to the records
+// named Prefix + column, Prefix defaults to "{table}."
+// Col is expected to be unique, if several dimension records match the first loaded is used
+type Join struct {
+	Table   string      `json:"table"`
+	On      string      `json:"on"`
+	Col     string      `json:"col"`
+	Columns []string    `json:"columns"`
+	Prefix  string      `json:"prefix"`
+	Type    string      `json:"type"`
+	Filters []Filter    `json:"filters"`
+	Where   *FilterExpr `json:"where"`
+}
+
+// A validated join with the dimension table it reads from
+// key is the sorted set of dimension records matching the join's filters, empty if none match
+type joinPlan struct {
+	join    Join
+	dim     Table
+	col     *Column
+	columns []string
+	key     string
+}
+
+func (j *Join) dimCol() string {
+	if j.Col != "" {
+		return j.Col
+	}
+	return j.On
+}
+
+func (j *Join) prefix(dim Table) string {
+	if j.Prefix != "" {
+		return j.Prefix
+	}
+	return dim.Name + "."
+}
+
+func (j *Join) isLeft() bool {
+	return strings.ToLower(j.Type) == JoinLeft
+}
+
+// Validates the joins of a query on table and returns their plans
+// columns are the columns the query returns, joined columns can't take their names
+func (db *Database) planJoins(table Table, joins []Join, columns []string) ([]joinPlan, error) {
+	outputs := make(map[string]bool)
+	if len(columns) == 0 {
+		for _, col := range table.Schema.Columns {
+			outputs[col.Name] = true
+		}
+	}
+	for _, col := range columns {
+		outputs[col] = true
+	}
+
+	plans := make([]joinPlan, 0, len(joins))
+	for _, j := range joins {
+		on, err := table.Schema.getColumn(j.On)
+		if err != nil {
+			return nil, err
+		}
+		switch strings.ToLower(j.Type) {
+		case "", JoinInner:
+			// inner joins filter the records by their join column
+			if !on.Filterable {
+				return nil, errors.New(fmt.Sprintf("can't inner join on non-filterable column %s", j.On))
+			}
+		case JoinLeft:
+		default:
+			return nil, errors.New(fmt.Sprintf("invalid join type %s, must be inner or left", j.Type))
+		}
+
+		dim, err := db.getTable(j.Table)
+		if err == ErrNil {
+			return nil, errors.New(fmt.Sprintf("join table %s not found", j.Table))
+		}
+		if err != nil {
+			return nil, err
+		}
+		col, err := dim.Schema.getColumn(j.dimCol())
+		if err != nil {
+			return nil, err
+		}
+		if !col.Filterable {
+			return nil, errors.New(fmt.Sprintf("can't join on non-filterable column %s of %s", col.Name, dim.Name))
+		}
+		err = dim.Schema.validateColumns(j.Columns)
+		if err != nil {
+			return nil, err
+		}
+		err = dim.Schema.validateFilters(j.Filters)
+		if err != nil {
+			return nil, err
+		}
+		if j.Where != nil {
+			err = dim.Schema.validateFilterExpr(j.Where)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		plan := joinPlan{join: j, dim: dim, col: col, columns: j.Columns}
+		if len(plan.columns) == 0 {
+			for _, c := range dim.Schema.Columns {
+				plan.columns = append(plan.columns, c.Name)
+			}
+		}
+		for _, c := range plan.columns {
+			name := j.prefix(dim) + c
+			if outputs[name] {
+				return nil, errors.New(fmt.Sprintf("joined column %s is already returned, set a prefix", name))
+			}
+			outputs[name] = true
+		}
+
+		plan.key, err = db.getQueryKey(dim, Query{Filters: j.Filters, Where: j.Where})
+		if err == ErrNil {
+			// a filter matched no dimension records
+			plan.key = ""
+		} else if err != nil {
+			return nil, err
+		}
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+// Restricts the query to the records with a matching dimension record for every inner join
+// The join values both tables have are intersected from their value registries or, when the join
+// has filters, read from the matching dimension records ScanCount at a time. The filter sets of
+// those values are then unioned MaxStoreKeys at a time into a set of records the query is restricted to,
+// so the values are never all read by the connector
+// Returns ErrNil if no dimension record matches
+func (db *Database) restrictJoins(table Table, query *Query, plans []joinPlan) error {
+	t := time.Now().String()
+	for i, p := range plans {
+		if p.join.isLeft() {
+			continue
+		}
+		if p.key == "" {
+			return ErrNil
+		}
+		vals, err := db.storeJoinValues(table, p, fmt.Sprintf("%s:values:%d", p.join.On, i), t)
+		if err != nil {
+			return err
+		}
+		set, n, err := db.storeJoinRecords(table, p, vals, fmt.Sprintf("%s:records:%d", p.join.On, i), t)
+		db.deleteTempKeys(vals)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNil
+		}
+		query.joinSets = append(query.joinSets, set)
+	}
+	return nil
+}
+
+// Stores the values of the join column of the matching dimension records that the table also has
+// Values are kept in a sorted set with score 0, like the value registries
+func (db *Database) storeJoinValues(table Table, p joinPlan, segment string, t string) (string, error) {
+	dst := table.formatJoinStoreKey(segment, t)
+	tableVals := table.formatValuesKey(p.join.On)
+	dimVals := p.dim.formatValuesKey(p.col.Name)
+	if len(p.join.Filters) > 0 || p.join.Where != nil {
+		// values of the matching dimension records
+		dimVals = table.formatJoinStoreKey(segment+":dim", t)
+		defer db.deleteTempKeys(dimVals)
+		for start := int64(0); ; start += ScanCount {
+			keys, err := db.Client.ZRange(Ctx, p.key, start, start+ScanCount-1).Result()
+			if err != nil {
+				return dst, err
+			}
+			pipe := db.Client.Pipeline()
+			cmds := make([]*redis.StringCmd, len(keys))
+			for i, k := range keys {
+				cmds[i] = pipe.HGet(Ctx, k, p.col.Name)
+			}
+			members := make([]redis.Z, 0, len(keys))
+			if len(keys) > 0 {
+				_, err = pipe.Exec(Ctx)
+				if err != nil && err != redis.Nil {
+					return dst, err
+				}
+			}
+			for _, cmd := range cmds {
+				if v, err := cmd.Result(); err == nil {
+					members = append(members, redis.Z{Member: v})
+				}
+			}
+			if len(members) > 0 {
+				pipe = db.Client.Pipeline()
+				pipe.ZAdd(Ctx, dimVals, members...)
+				pipe.Expire(Ctx, dimVals, TempKeyTTL)
+				_, err = pipe.Exec(Ctx)
+				if err != nil {
+					return dst, err
+				}
+			}
+			if len(keys) < ScanCount {
+				break
+			}
+		}
+	}
+	_, err := db.Client.ZInterStore(Ctx, dst, &redis.ZStore{Keys: []string{tableVals, dimVals}}).Result()
+	if err != nil {
+		return dst, err
+	}
+	return dst, db.expireTempKeys(dst)
+}
+
+// Stores the records of the table whose join column has one of vals and returns their number
+func (db *Database) storeJoinRecords(table Table, p joinPlan, vals string, segment string, t string) (string, int64, error) {
+	dst := table.formatJoinStoreKey(segment, t)
+	var n int64
+	for start := int64(0); ; start += MaxStoreKeys {
+		batch, err := db.Client.ZRange(Ctx, vals, start, start+MaxStoreKeys-1).Result()
+		if err != nil {
+			return dst, 0, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		keys := make([]string, 0, len(batch)+1)
+		if start > 0 {
+			keys = append(keys, dst)
+		}
+		for _, v := range batch {
+			keys = append(keys, table.formatFilterKey(p.join.On, v))
+		}
+		n, err = db.Client.SUnionStore(Ctx, dst, keys...).Result()
+		if err != nil {
+			return dst, 0, err
+		}
+		if len(batch) < MaxStoreKeys {
+			break
+		}
+	}
+	return dst, n, db.expireTempKeys(dst)
+}
+
+// Stores the records of key that are in every join set, in the order of key
+func (db *Database) intersectJoinSets(table Table, key string, sets []string) (string, error) {
+	dst := table.formatJoinStoreKey("query", time.Now().String())
+	weights := make([]float64, len(sets)+1)
+	weights[0] = 1
+	_, err := db.Client.ZInterStore(Ctx, dst, &redis.ZStore{
+		Keys:    append([]string{key}, sets...),
+		Weights: weights,
+	}).Result()
+	if err != nil {
+		return "", err
+	}
+	return dst, db.expireTempKeys(dst)
+}
+
+// Adds the joined columns to the records of keys, records without a matching dimension record get nulls
+func (db *Database) joinRecords(plans []joinPlan, keys []string, records []map[string]any) error {
+	for _, p := range plans {
+		prefix := p.join.prefix(p.dim)
+		for _, r := range records {
+			for _, c := range p.columns {
+				r[prefix+c] = nil
+			}
+		}
+		if p.key == "" || len(keys) == 0 {
+			continue
+		}
+
+		// join values of the records
+		pipe := db.Client.Pipeline()
+		onCmds := make([]*redis.StringCmd, len(keys))
+		for i, k := range keys {
+			onCmds[i] = pipe.HGet(Ctx, k, p.join.On)
+		}
+		_, err := pipe.Exec(Ctx)
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		vals := make([]string, 0, len(keys))
+		seen := make(map[string]bool, len(keys))
+		for _, cmd := range onCmds {
+			if v, err := cmd.Result(); err == nil && !seen[v] {
+				seen[v] = true
+				vals = append(vals, v)
+			}
+		}
+
+		dimKeys, err := db.lookupJoinKeys(p, vals)
+		if err != nil {
+			return err
+		}
+
+		// columns of the matching dimension records
+		pipe = db.Client.Pipeline()
+		dimCmds := make(map[string]*redis.MapStringStringCmd, len(dimKeys))
+		for _, k := range dimKeys {
+			if _, ok := dimCmds[k]; !ok {
+				dimCmds[k] = pipe.HGetAll(Ctx, k)
+			}
+		}
+		_, err = pipe.Exec(Ctx)
+		if err != nil {
+			return err
+		}
+
+		for i, cmd := range onCmds {
+			v, err := cmd.Result()
+			if err != nil {
+				continue
+			}
+			k, ok := dimKeys[v]
+			if !ok {
+				continue
+			}
+			row := p.dim.Schema.recordToRow(dimCmds[k].Val(), p.columns)
+			for c, val := range row {
+				records[i][prefix+c] = val
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the dimension record matching each join value
+// Candidates are the members of the value's filter set, the one with the lowest score in the plan's key,
+// the first loaded that matches the join's filters, is used
+func (db *Database) lookupJoinKeys(p joinPlan, vals []string) (map[string]string, error) {
+	pipe := db.Client.Pipeline()
+	memberCmds := make([]*redis.StringSliceCmd, len(vals))
+	for i, v := range vals {
+		memberCmds[i] = pipe.SMembers(Ctx, p.dim.formatFilterKey(p.col.Name, v))
+	}
+	_, err := pipe.Exec(Ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe = db.Client.Pipeline()
+	scoreCmds := make([][]*redis.FloatCmd, len(vals))
+	for i, cmd := range memberCmds {
+		for _, m := range cmd.Val() {
+			scoreCmds[i] = append(scoreCmds[i], pipe.ZScore(Ctx, p.key, m))
+		}
+	}
+	_, err = pipe.Exec(Ctx)
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	dimKeys := make(map[string]string, len(vals))
+	for i, v := range vals {
+		best := -1.0
+		for j, cmd := range scoreCmds[i] {
+			score, err := cmd.Result()
+			if err != nil {
+				continue
+			}
+			if best < 0 || score < best {
+				best = score
+				dimKeys[v] = memberCmds[i].Val()[j]
+			}
+		}
+	}
+	return dimKeys, nil
+}
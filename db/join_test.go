@@ -0,0 +1,183 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func loadJoinTestData(t *testing.T, mr *Database) {
+	schemas := []Schema{
+		{
+			Name: "orders",
+			Columns: []Column{
+				{Name: "id", DataType: "int", Filterable: true, Sortable: true},
+				{Name: "customer", DataType: "string", Filterable: true, Nullable: true},
+				{Name: "amount", DataType: "float", Filterable: true, Sortable: true},
+			},
+		},
+		{
+			Name: "customers",
+			Columns: []Column{
+				{Name: "customer_id", DataType: "string", Filterable: true},
+				{Name: "name", DataType: "string"},
+				{Name: "tier", DataType: "string", Filterable: true},
+			},
+		},
+	}
+	data := []string{
+		"id,customer,amount\n1,c1,10\n2,c2,20\n3,c1,30\n4,c9,40\n5,,50\n",
+		"customer_id,name,tier\nc1,Ann,gold\nc2,Bob,silver\nc3,Cid,gold\n",
+	}
+	for i := range schemas {
+		err := mr.AddSchema(&schemas[i])
+		if err != nil {
+			t.Fatalf("Failed adding schema %s\n", err)
+		}
+		err = mr.BulkLoad(schemas[i].Name, strings.NewReader(data[i]), "csv")
+		if err != nil {
+			t.Fatalf("Failed loading data %s\n", err)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	mr := newMiniRedis(t)
+	loadJoinTestData(t, mr)
+
+	// inner join, records without a customer are left out
+	query := Query{
+		Columns: []string{"id"},
+		Joins:   []Join{{Table: "customers", On: "customer", Col: "customer_id", Columns: []string{"name", "tier"}}},
+	}
+	data, err := mr.GetData("orders", query)
+	if err != nil {
+		t.Fatalf("Failed getting data %s\n", err)
+	}
+	expected := []map[string]any{
+		{"id": "1", "customers.name": "Ann", "customers.tier": "gold"},
+		{"id": "2", "customers.name": "Bob", "customers.tier": "silver"},
+		{"id": "3", "customers.name": "Ann", "customers.tier": "gold"},
+	}
+	if !reflect.DeepEqual(data.Records, expected) || data.Metadata.ResultSet.Total != 3 {
+		t.Fatalf("Expected %v, got %v %+v", expected, data.Records, data.Metadata)
+	}
+
+	// facets and stats agree with the data
+	facets, err := mr.GetFacets("orders", "customer", query)
+	if err != nil {
+		t.Fatalf("Failed getting facets %s\n", err)
+	}
+	expectedFacets := []Facet{{Value: "c1", Count: 2}, {Value: "c2", Count: 1}}
+	if !reflect.DeepEqual(facets.Values, expectedFacets) || facets.Nulls != 0 {
+		t.Fatalf("Expected %v, got %+v", expectedFacets, facets)
+	}
+	stats, err := mr.GetNumericStats("orders", "amount", query, 0)
+	if err != nil {
+		t.Fatalf("Failed getting stats %s\n", err)
+	}
+	if stats.Count != 3 || *stats.Max != 30 {
+		t.Fatalf("Expected stats of 3 records up to 30, got %+v", stats)
+	}
+
+	// filters on both sides
+	query = Query{
+		Columns: []string{"id"},
+		Filters: []Filter{{Col: "amount", Op: GreaterThan, Val: []string{"15"}}},
+		Joins: []Join{{
+			Table: "customers", On: "customer", Col: "customer_id", Columns: []string{"name"}, Prefix: "c_",
+			Filters: []Filter{{Col: "tier", Op: EqualTo, Val: []string{"gold"}}},
+		}},
+	}
+	data, err = mr.GetData("orders", query)
+	if err != nil {
+		t.Fatalf("Failed getting data %s\n", err)
+	}
+	expected = []map[string]any{{"id": "3", "c_name": "Ann"}}
+	if !reflect.DeepEqual(data.Records, expected) {
+		t.Fatalf("Expected %v, got %v", expected, data.Records)
+	}
+	n, err := mr.CountData("orders", query)
+	if err != nil || n != 1 {
+		t.Fatalf("Expected a count of 1, got %d %v", n, err)
+	}
+
+	// left join keeps every record, the dimension filters only select the matches
+	query = Query{
+		Columns: []string{"id"},
+		Joins: []Join{{
+			Table: "customers", On: "customer", Col: "customer_id", Columns: []string{"name"}, Type: JoinLeft,
+			Filters: []Filter{{Col: "tier", Op: EqualTo, Val: []string{"silver"}}},
+		}},
+	}
+	data, err = mr.GetData("orders", query)
+	if err != nil {
+		t.Fatalf("Failed getting data %s\n", err)
+	}
+	expected = []map[string]any{
+		{"id": "1", "customers.name": nil},
+		{"id": "2", "customers.name": "Bob"},
+		{"id": "3", "customers.name": nil},
+		{"id": "4", "customers.name": nil},
+		{"id": "5", "customers.name": nil},
+	}
+	if !reflect.DeepEqual(data.Records, expected) {
+		t.Fatalf("Expected %v, got %v", expected, data.Records)
+	}
+
+	// no dimension record matches an inner join
+	query = Query{Joins: []Join{{Table: "customers", On: "customer", Col: "customer_id", Filters: []Filter{{Col: "tier", Op: EqualTo, Val: []string{"bronze"}}}}}}
+	data, err = mr.GetData("orders", query)
+	if err != nil || len(data.Records) != 0 {
+		t.Fatalf("Expected no records, got %v %v", data, err)
+	}
+	n, err = mr.CountData("orders", query)
+	if err != nil || n != 0 {
+		t.Fatalf("Expected a count of 0, got %d %v", n, err)
+	}
+
+	// joined columns are added to every cursor page
+	query = Query{
+		Columns: []string{"id"},
+		Scroll:  true,
+		Limit:   2,
+		Joins:   []Join{{Table: "customers", On: "customer", Col: "customer_id", Columns: []string{"name"}}},
+	}
+	data, err = mr.GetData("orders", query)
+	if err != nil || data.Metadata.Cursor == "" {
+		t.Fatalf("Failed opening cursor %v %v", data, err)
+	}
+	data, err = mr.GetData("orders", Query{Cursor: data.Metadata.Cursor})
+	if err != nil {
+		t.Fatalf("Failed reading cursor %s\n", err)
+	}
+	expected = []map[string]any{{"id": "3", "customers.name": "Ann"}}
+	if !reflect.DeepEqual(data.Records, expected) {
+		t.Fatalf("Expected %v, got %v", expected, data.Records)
+	}
+
+	valid := Join{Table: "customers", On: "customer", Col: "customer_id", Columns: []string{"name"}}
+	invalid := [][]Join{
+		{{Table: "missing", On: "customer"}},
+		{{Table: "customers", On: "missing", Col: "customer_id"}},
+		{{Table: "customers", On: "customer", Col: "name"}},
+		{{Table: "customers", On: "customer", Col: "customer_id", Columns: []string{"missing"}}},
+		{{Table: "customers", On: "customer", Col: "customer_id", Type: "outer"}},
+		{{Table: "customers", On: "customer", Col: "customer_id", Filters: []Filter{{Col: "tier", Op: GreaterThan, Val: []string{"gold"}}}}},
+		// joined columns must not take the name of another column
+		{valid, valid},
+	}
+	for _, joins := range invalid {
+		_, err = mr.GetData("orders", Query{Joins: joins})
+		if err == nil || err == ErrNil {
+			t.Fatalf("Expected an error for joins %+v, got %v", joins, err)
+		}
+	}
+	_, err = mr.GetData("orders", Query{Joins: []Join{valid}})
+	if err != nil {
+		t.Fatalf("Failed getting data %s\n", err)
+	}
+}
@@ -8,11 +8,9 @@ import (
 	"encoding/csv"
 	"encoding/json"
 	"errors"
-	"flag"
 	"fmt"
 	"io"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -72,6 +70,18 @@ func (db *Database) updateLastLoad(table Table, load *Load) error {
 	return err
 }
 
+// Field of the last load hash holding the version of the last successful load
+const currentVersionField = "current"
+
+// Returns the version of the last successful load of table, ErrNil if no load succeeded
+func (db *Database) getCurrentVersion(table Table) (int, error) {
+	version, err := db.Client.HGet(Ctx, table.formatLastLoadKey(), currentVersionField).Int()
+	if err == redis.Nil {
+		return 0, ErrNil
+	}
+	return version, err
+}
+
 // returns the next version number, if no loads yet, returns 0
 func (db *Database) getNextTableVersion(table Table) (int, error) {
 	var version int
@@ -89,8 +99,14 @@ func (db *Database) getNextTableVersion(table Table) (int, error) {
 }
 
 // Adds a recordKey to the sorted set based on the value of the column
-func addSortableValToPipe(table Table, pipe *redis.Pipeliner, filterKey string, col string, val string) error {
-	sortedKey := table.formatSortableKey(col)
+// String values are added with score 0 so they are ordered lexicographically by their collation
+func addSortableValToPipe(table Table, pipe *redis.Pipeliner, filterKey string, col *Column, val string) error {
+	sortedKey := table.formatSortableKey(col.Name)
+
+	if col.DataType == "string" {
+		(*pipe).ZAdd(Ctx, sortedKey, redis.Z{Member: col.lexMember(val)})
+		return nil
+	}
 
 	score, err := strconv.ParseFloat(val, 64)
 	if err != nil {
@@ -105,8 +121,50 @@ func addSortableValToPipe(table Table, pipe *redis.Pipeliner, filterKey string,
 	return nil
 }
 
+// Options that control how raw cells are loaded
+type LoadOptions struct {
+	// Cell value that is loaded as null, defaults to the empty string
+	NullToken string
+
+	// Null cells of the record when the source marks them itself (ex: JSON nulls), the null token is then unused
+	nulls []bool
+}
+
+// Returns true if the i-th cell of the record is null
+func (opts LoadOptions) isNull(i int, val string) bool {
+	if opts.nulls != nil {
+		return opts.nulls[i]
+	}
+	return val == opts.NullToken
+}
+
+// Adds a single cell of a record to the pipe, null cells are added to the column's null set
+func cellToPipe(table Table, pipe *redis.Pipeliner, recordKey string, col *Column, val string, null bool, recordVals *[]string) {
+	val, ok := col.resolveValue(val, null)
+	if !ok {
+		if col.Filterable {
+			(*pipe).SAdd(Ctx, table.formatNullKey(col.Name), recordKey)
+		}
+		return
+	}
+	*recordVals = append(*recordVals, col.Name, val)
+
+	if col.Filterable {
+		filterKey := table.formatFilterKey(col.Name, val)
+		(*pipe).SAdd(Ctx, filterKey, recordKey)
+		(*pipe).ZAdd(Ctx, table.formatValuesKey(col.Name), redis.Z{Member: val})
+
+		if col.Sortable {
+			addSortableValToPipe(table, pipe, filterKey, col, val)
+			addOrderValToPipe(table, pipe, recordKey, col, val)
+		}
+	}
+}
+
 // Parses record into redis hash according to the schema, also creates filter key for columns that are filterable
-func recordToPipe(table Table, pipe *redis.Pipeliner, record []string, seq int, headerMap map[int]string, schemaMap map[string]int) {
+// Schema columns missing from the record are loaded as null cells if they are nullable or have a default
+// Returns the column names and values of the record, null columns are left out
+func recordToPipe(table Table, pipe *redis.Pipeliner, record []string, seq int, headerMap map[int]string, schemaMap map[string]int, opts LoadOptions) []string {
 	// Format Record Key
 	recordKey := table.formatRecordKey(seq)
 
@@ -114,20 +172,19 @@ func recordToPipe(table Table, pipe *redis.Pipeliner, record []string, seq int,
 	var recordVals []string
 	for i, val := range record {
 		// Get column name based on index
-		col := headerMap[i]
-		recordVals = append(recordVals, col, val)
-
-		if table.Schema.Columns[schemaMap[col]].Filterable {
-			filterKey := table.formatFilterKey(col, val)
-			(*pipe).SAdd(Ctx, filterKey, recordKey)
-
-			if table.Schema.Columns[schemaMap[col]].Sortable {
-				addSortableValToPipe(table, pipe, filterKey, col, val)
-			}
+		col := &table.Schema.Columns[schemaMap[headerMap[i]]]
+		cellToPipe(table, pipe, recordKey, col, val, opts.isNull(i, val), &recordVals)
+	}
+	for i := range table.Schema.Columns {
+		col := &table.Schema.Columns[i]
+		if _, ok := schemaMap[col.Name]; !ok && (col.Nullable || col.Default != nil) {
+			cellToPipe(table, pipe, recordKey, col, "", true, &recordVals)
 		}
 	}
 	// Adding Values to record key
-	(*pipe).HSet(Ctx, recordKey, recordVals)
+	if len(recordVals) > 0 {
+		(*pipe).HSet(Ctx, recordKey, recordVals)
+	}
 
 	// Adding record key to set of all records
 	sortedMember := redis.Z{
@@ -135,10 +192,13 @@ func recordToPipe(table Table, pipe *redis.Pipeliner, record []string, seq int,
 		Member: recordKey,
 	}
 	(*pipe).ZAdd(Ctx, table.formatAllRecordKeys(), sortedMember)
+	(*pipe).SAdd(Ctx, table.formatAllRecordSetKey(), recordKey)
+	return recordVals
 }
 
 // parses csv data into a redis Pipeliner that loads all data and adds filter keys
-func csvToPipe(f io.Reader, table Table, pipe *redis.Pipeliner) error {
+// Rows violating column constraints are reported in a ValidationError and nothing is loaded
+func csvToPipe(f io.Reader, table Table, pipe *redis.Pipeliner, opts LoadOptions) error {
 	r := csv.NewReader(f)
 	seq := 0
 
@@ -147,6 +207,12 @@ func csvToPipe(f io.Reader, table Table, pipe *redis.Pipeliner) error {
 		return err
 	}
 
+	checker, err := newConstraintChecker(&table.Schema)
+	if err != nil {
+		return err
+	}
+	profiler := newTableProfiler(table)
+
 	// https://levelup.gitconnected.com/easy-reading-and-writing-of-csv-files-in-go-7e5b15a73c79
 	for {
 		record, err := r.Read()
@@ -156,10 +222,18 @@ func csvToPipe(f io.Reader, table Table, pipe *redis.Pipeliner) error {
 			return err
 		}
 
-		recordToPipe(table, pipe, record, seq, headerMap, schemaMap)
+		// once a row is invalid the load fails, so remaining rows are only checked
+		if checker.checkCSVRecord(seq, record, headerMap, schemaMap, opts) && checker.errs.Total == 0 {
+			recordVals := recordToPipe(table, pipe, record, seq, headerMap, schemaMap, opts)
+			profiler.addToPipe(pipe, recordVals)
+		}
 		seq++
 	}
-	return nil
+	err = checker.errs.err()
+	if err != nil {
+		return err
+	}
+	return profiler.finishToPipe(pipe)
 }
 
 // Parses the first line of the csv.Reader
@@ -197,6 +271,11 @@ func parseCSVHeader(r *csv.Reader, schema Schema) (map[int]string, map[string]in
 // Loads in data from f for table. If a load is already running for table, it fails.
 // format signifies how data is stored in f, options are ("csv")
 func (db *Database) BulkLoad(tableName string, f io.Reader, format string) error {
+	return db.BulkLoadWithOptions(tableName, f, format, LoadOptions{})
+}
+
+// Same as BulkLoad, with opts controlling how cells are parsed
+func (db *Database) BulkLoadWithOptions(tableName string, f io.Reader, format string, opts LoadOptions) error {
 	starttime := time.Now().String()
 
 	table, err := db.getTable(tableName)
@@ -229,7 +308,7 @@ func (db *Database) BulkLoad(tableName string, f io.Reader, format string) error
 	pipe := db.Client.TxPipeline()
 
 	if format == "csv" {
-		err = csvToPipe(f, table, &pipe)
+		err = csvToPipe(f, table, &pipe, opts)
 		if err != nil {
 			return err
 		}
@@ -237,9 +316,8 @@ func (db *Database) BulkLoad(tableName string, f io.Reader, format string) error
 		return errors.New("invalid file format")
 	}
 
-	// create new index
-	if flag.Lookup("test.v") == nil ||
-		strings.HasPrefix(flag.Lookup("test.run").Value.String(), "TestIndex") {
+	// create new index, unless redis has no search module
+	if db.hasSearchModule() {
 		// create new index
 		err = db.createIndexToPipe(table, &pipe)
 		if err != nil {
@@ -247,6 +325,9 @@ func (db *Database) BulkLoad(tableName string, f io.Reader, format string) error
 		}
 	}
 
+	// the loaded version becomes current with its records
+	pipe.HSet(Ctx, table.formatLastLoadKey(), currentVersionField, table.Version)
+
 	_, err = pipe.Exec(Ctx)
 	if err != nil {
 		return err
@@ -277,13 +358,26 @@ func (db *Database) CreateRecord(tableName string, f io.Reader) (int64, error) {
 		header,
 	}
 	records := reqBody["records"].([]interface{})
+	nulls := make([][]bool, 0, len(records))
 	for _, record := range records {
 		assertedRec := record.(map[string]interface{})
 		rec := make([]string, 0)
+		recNulls := make([]bool, 0, len(header))
 		for _, h := range header {
-			rec = append(rec, assertedRec[h].(string))
+			// JSON nulls and missing keys are loaded as null cells, empty strings are values
+			var v string
+			switch val := assertedRec[h].(type) {
+			case nil:
+			case string:
+				v = val
+			default:
+				v = fmt.Sprint(val)
+			}
+			rec = append(rec, v)
+			recNulls = append(recNulls, assertedRec[h] == nil)
 		}
 		csvData = append(csvData, rec)
+		nulls = append(nulls, recNulls)
 	}
 	buffer := new(bytes.Buffer)
 	csvWriter := csv.NewWriter(buffer)
@@ -300,6 +394,10 @@ func (db *Database) CreateRecord(tableName string, f io.Reader) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
+	checker, err := newConstraintChecker(&table.Schema)
+	if err != nil {
+		return 0, err
+	}
 	pipe := db.Client.TxPipeline()
 	res, err := db.Client.ZRevRangeWithScores(Ctx,
 		table.formatAllRecordKeys(), 0, 0).Result()
@@ -318,10 +416,21 @@ func (db *Database) CreateRecord(tableName string, f io.Reader) (int64, error) {
 		} else if err != nil {
 			return 0, err
 		}
-		recordToPipe(table, &pipe, record, seq, headerMap, schemaMap)
+		opts := LoadOptions{nulls: nulls[recCount]}
+		if checker.checkCSVRecord(int(recCount), record, headerMap, schemaMap, opts) {
+			recordToPipe(table, &pipe, record, seq, headerMap, schemaMap, opts)
+		}
 		seq++
 		recCount++
 	}
+	err = checker.errs.err()
+	if err != nil {
+		return 0, err
+	}
+	for i := range table.Schema.Columns {
+		invalidateStringOrderToPipe(table, &pipe, &table.Schema.Columns[i])
+	}
+	invalidateQueryCacheToPipe(table, &pipe)
 	_, err = pipe.Exec(Ctx)
 	if err != nil {
 		return 0, err
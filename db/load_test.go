@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -277,3 +278,111 @@ func TestBulkLoadSmall(t *testing.T) {
 		t.Fatalf("Second load not set to 1")
 	}
 }
+
+func TestBulkLoadNullable(t *testing.T) {
+	mr := newMiniRedis(t)
+
+	def := "unknown"
+	schema := Schema{
+		Name: "nulls",
+		Columns: []Column{
+			{Name: "name", DataType: "string"},
+			{Name: "region", DataType: "string", Filterable: true, Nullable: true},
+			{Name: "tier", DataType: "string", Filterable: true, Default: &def},
+			{Name: "revenue", DataType: "float", Filterable: true, Sortable: true, Nullable: true},
+		},
+	}
+	err := mr.AddSchema(&schema)
+	if err != nil {
+		t.Fatalf("Failed adding schema %s\n", err)
+	}
+
+	data := "name,region,tier,revenue\n" +
+		"acme,EMEA,gold,100\n" +
+		"globex,NULL,NULL,NULL\n" +
+		",AMER,silver,5\n"
+	err = mr.BulkLoadWithOptions(schema.Name, strings.NewReader(data), "csv", LoadOptions{NullToken: "NULL"})
+	if err != nil {
+		t.Fatalf("Failed loading nullable data %s\n", err)
+	}
+
+	table, err := mr.getTable(schema.Name)
+	if err != nil {
+		t.Fatalf("Failed getting table struct %s\n", err)
+	}
+
+	// null columns are left out of the hash, defaults are written
+	expected := map[string]string{
+		"name": "globex",
+		"tier": "unknown",
+	}
+	record, err := mr.Client.HGetAll(Ctx, table.formatRecordKey(1)).Result()
+	if err != nil {
+		t.Fatalf("Failed getting record %s\n", err)
+	}
+	if !reflect.DeepEqual(expected, record) {
+		t.Fatalf("Expected %v, got %v", expected, record)
+	}
+
+	// empty strings are values when the null token is set
+	name, err := mr.Client.HGet(Ctx, table.formatRecordKey(2), "name").Result()
+	if err != nil || name != "" {
+		t.Fatalf("Expected empty name, got %q, %v", name, err)
+	}
+
+	// null records are tracked in the null set only
+	isMember, err := mr.Client.SIsMember(Ctx, table.formatNullKey("region"), table.formatRecordKey(1)).Result()
+	if err != nil || !isMember {
+		t.Fatalf("Expected record 1 in region null set")
+	}
+	n, err := mr.Client.SCard(Ctx, table.formatFilterKey("region", "NULL")).Result()
+	if err != nil || n != 0 {
+		t.Fatalf("Null token added to filter set")
+	}
+
+	// null records are returned with nil values
+	tableData, err := mr.GetData(schema.Name, Query{})
+	if err != nil {
+		t.Fatalf("Failed getting data %s\n", err)
+	}
+	if tableData.Records[1]["region"] != nil || tableData.Records[1]["revenue"] != nil {
+		t.Fatalf("Expected null columns to be nil, got %v", tableData.Records[1])
+	}
+
+	// created records tell JSON nulls from empty strings whatever the null token
+	_, err = mr.CreateRecord(schema.Name, strings.NewReader(`{"records": [{"name": "initech", "region": "", "tier": null}, {"name": "hooli", "region": null}]}`))
+	if err != nil {
+		t.Fatalf("Failed creating records %s\n", err)
+	}
+	isMember, err = mr.Client.SIsMember(Ctx, table.formatFilterKey("region", ""), table.formatRecordKey(3)).Result()
+	if err != nil || !isMember {
+		t.Fatalf("Expected the empty region of record 3 to be a value")
+	}
+	isMember, err = mr.Client.SIsMember(Ctx, table.formatNullKey("region"), table.formatRecordKey(4)).Result()
+	if err != nil || !isMember {
+		t.Fatalf("Expected record 4 in region null set")
+	}
+	tier, err := mr.Client.HGet(Ctx, table.formatRecordKey(3), "tier").Result()
+	if err != nil || tier != def {
+		t.Fatalf("Expected the default tier for a JSON null, got %q, %v", tier, err)
+	}
+
+	// updating a column keeps the empty strings of the others
+	old, err := mr.Client.HGetAll(Ctx, table.formatRecordKey(3)).Result()
+	if err != nil {
+		t.Fatalf("Failed getting record %s\n", err)
+	}
+	updated := map[string]string{"name": "initrode", "region": "", "tier": def}
+	err = mr.replaceRecord(table, table.formatRecordKey(3), old, updated)
+	if err != nil {
+		t.Fatalf("Failed replacing record %s\n", err)
+	}
+	record, err = mr.Client.HGetAll(Ctx, table.formatRecordKey(3)).Result()
+	if err != nil || !reflect.DeepEqual(updated, record) {
+		t.Fatalf("Expected %v, got %v, %v", updated, record, err)
+	}
+	isMember, err = mr.Client.SIsMember(Ctx, table.formatNullKey("region"), table.formatRecordKey(3)).Result()
+	if err != nil || isMember {
+		t.Fatalf("Expected the empty region of record 3 to stay a value")
+	}
+}
@@ -0,0 +1,368 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Returns true if redis has the search module, it is checked with FT._LIST until redis gives a definite answer
+// Without it tables are not indexed and aggregations are computed natively
+// Other errors, like timeouts, are assumed to come from the module so the next search command returns them
+func (db *Database) hasSearchModule() bool {
+	db.searchMu.Lock()
+	defer db.searchMu.Unlock()
+	if db.searchKnown {
+		return db.search
+	}
+	err := db.Client.Do(Ctx, "FT._LIST").Err()
+	if err == nil {
+		db.search, db.searchKnown = true, true
+	} else if strings.Contains(strings.ToLower(err.Error()), "unknown command") {
+		db.search, db.searchKnown = false, true
+	} else {
+		return true
+	}
+	return db.search
+}
+
+// Running state of a reducer over the values of a group
+// stddev uses Welford's online algorithm so values don't need to be kept
+type reducerState struct {
+	n        int64
+	sum      float64
+	min      float64
+	max      float64
+	mean     float64
+	m2       float64
+	distinct map[string]bool
+}
+
+// Adds a value of the reducer's column to the state, nulls and values that aren't numbers are skipped
+func (s *reducerState) add(r *Reducer, val *string) {
+	switch r.Op {
+	case ReduceCount:
+		s.n++
+		return
+	case ReduceCountDistinct:
+		if val == nil {
+			return
+		}
+		if s.distinct == nil {
+			s.distinct = make(map[string]bool)
+		}
+		s.distinct[*val] = true
+		return
+	}
+
+	if val == nil {
+		return
+	}
+	f, err := strconv.ParseFloat(*val, 64)
+	if err != nil {
+		return
+	}
+	if s.n == 0 || f < s.min {
+		s.min = f
+	}
+	if s.n == 0 || f > s.max {
+		s.max = f
+	}
+	s.n++
+	s.sum += f
+	delta := f - s.mean
+	s.mean += delta / float64(s.n)
+	s.m2 += delta * (f - s.mean)
+}
+
+// Returns the reduced value, formatted like RediSearch does
+func (s *reducerState) result(r *Reducer) string {
+	format := func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+	switch r.Op {
+	case ReduceCount:
+		return strconv.FormatInt(s.n, 10)
+	case ReduceCountDistinct:
+		return strconv.Itoa(len(s.distinct))
+	case ReduceSum:
+		return format(s.sum)
+	}
+	if s.n == 0 {
+		return ""
+	}
+	switch r.Op {
+	case ReduceAvg:
+		return format(s.sum / float64(s.n))
+	case ReduceMin:
+		return format(s.min)
+	case ReduceMax:
+		return format(s.max)
+	case ReduceStddev:
+		// sample standard deviation
+		if s.n < 2 {
+			return "0"
+		}
+		return format(math.Sqrt(s.m2 / float64(s.n-1)))
+	}
+	return ""
+}
+
+// The group by values of a group and the states of its reducers
+type aggGroup struct {
+	vals   []*string
+	states []reducerState
+}
+
+// Returns the key of a group, null and empty values are kept apart
+func aggGroupKey(vals []*string) string {
+	var sb strings.Builder
+	for _, v := range vals {
+		if v == nil {
+			sb.WriteString("\x00")
+		} else {
+			sb.WriteString("\x01" + *v)
+		}
+		sb.WriteString("\x00")
+	}
+	return sb.String()
+}
+
+// Aggregates without the search module
+// The records of the query are read from its filter sets in batches of ScanCount with a pipelined HMGET
+// of the grouped and reduced columns, only the state of each group is kept in memory
+// Quantiles need every value and are not supported, neither is full-text search
+func (db *Database) aggregateNative(table Table, aggReq *AggRequest) ([]map[string]string, error) {
+	reducers := aggReq.reducers()
+	for _, r := range reducers {
+		switch r.Op {
+		case ReduceCount, ReduceCountDistinct, ReduceSum, ReduceAvg, ReduceMin, ReduceMax, ReduceStddev:
+		default:
+			// quantiles and the other reducers of the legacy operation
+			return nil, aggregationError("%s needs the search module", r.Op)
+		}
+	}
+	query := Query{}
+	if aggReq.Query != nil {
+		query = *aggReq.Query
+		if query.search() != nil {
+			return nil, aggregationError("search needs the search module")
+		}
+	}
+
+	// counts grouped by a filterable column are the sizes of its filter sets
+	if len(aggReq.Groupby) == 1 && aggReq.Bucket == nil && onlyCountReducers(reducers) {
+		col, err := table.Schema.getColumn(aggReq.Groupby[0])
+		if err != nil {
+			return nil, err
+		}
+		if col.Filterable {
+			return db.aggregateFacets(table, col, query, aggReq)
+		}
+	}
+
+	key, err := db.getQueryKey(table, query)
+	if err == ErrNil {
+		// a filter matched no records
+		return make([]map[string]string, 0), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// columns read from each record, the group by columns first and then the bucket column
+	cols := append([]string{}, aggReq.Groupby...)
+	var bucketCol *Column
+	if aggReq.Bucket != nil {
+		bucketCol, err = table.Schema.getColumn(aggReq.Bucket.Col)
+		if err != nil {
+			return nil, err
+		}
+		cols = append(cols, bucketCol.Name)
+	}
+	groupCols := len(cols)
+	reducerCols := make([]int, len(reducers))
+	for i, r := range reducers {
+		reducerCols[i] = -1
+		if r.Col != "" {
+			reducerCols[i] = len(cols)
+			cols = append(cols, r.Col)
+		}
+	}
+
+	groups := make(map[string]*aggGroup)
+	order := make([]string, 0)
+	for start := int64(0); ; start += ScanCount {
+		keys, err := db.Client.ZRange(Ctx, key, start, start+ScanCount-1).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) == 0 {
+			break
+		}
+
+		pipe := db.Client.Pipeline()
+		cmds := make([]*redis.SliceCmd, 0, len(keys))
+		for _, k := range keys {
+			cmds = append(cmds, pipe.HMGet(Ctx, k, cols...))
+		}
+		_, err = pipe.Exec(Ctx)
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+
+		for _, cmd := range cmds {
+			vals := make([]*string, len(cols))
+			for i, v := range cmd.Val() {
+				if s, ok := v.(string); ok {
+					vals[i] = &s
+				}
+			}
+
+			groupVals := vals[:groupCols]
+			if bucketCol != nil {
+				groupVals[len(aggReq.Groupby)] = aggReq.Bucket.bucketValue(bucketCol, groupVals[len(aggReq.Groupby)])
+			}
+			gk := aggGroupKey(groupVals)
+			g, ok := groups[gk]
+			if !ok {
+				g = &aggGroup{vals: groupVals, states: make([]reducerState, len(reducers))}
+				groups[gk] = g
+				order = append(order, gk)
+			}
+			for i := range reducers {
+				var val *string
+				if reducerCols[i] >= 0 {
+					val = vals[reducerCols[i]]
+				}
+				g.states[i].add(&reducers[i], val)
+			}
+		}
+
+		if len(keys) < ScanCount {
+			break
+		}
+	}
+
+	// groups are returned in the order they were first seen, null group values are left out
+	rows := make([]map[string]string, 0, len(groups))
+	for _, gk := range order {
+		g := groups[gk]
+		row := make(map[string]string, len(cols))
+		for i, col := range aggReq.Groupby {
+			if g.vals[i] != nil {
+				row[col] = *g.vals[i]
+			}
+		}
+		if bucketCol != nil && g.vals[len(aggReq.Groupby)] != nil {
+			row[aggReq.Bucket.name()] = *g.vals[len(aggReq.Groupby)]
+		}
+		for i := range reducers {
+			row[reducers[i].name()] = g.states[i].result(&reducers[i])
+		}
+		rows = append(rows, row)
+	}
+	if bucketCol != nil {
+		return table.finishTimeBuckets(rows, aggReq)
+	}
+	return finishAggregation(rows, aggReq), nil
+}
+
+// Returns true if every reducer is a count
+func onlyCountReducers(reducers []Reducer) bool {
+	for _, r := range reducers {
+		if r.Op != ReduceCount {
+			return false
+		}
+	}
+	return true
+}
+
+// Counts the records of each value of a filterable column from the facets of the column
+func (db *Database) aggregateFacets(table Table, col *Column, query Query, aggReq *AggRequest) ([]map[string]string, error) {
+	facets, err := db.getFacets(table, col, query)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]string, 0, len(facets.Values)+1)
+	addRow := func(row map[string]string, n int64) {
+		for _, r := range aggReq.reducers() {
+			row[r.name()] = strconv.FormatInt(n, 10)
+		}
+		rows = append(rows, row)
+	}
+	for _, f := range facets.Values {
+		addRow(map[string]string{col.Name: f.Value}, f.Count)
+	}
+	if facets.Nulls > 0 {
+		addRow(map[string]string{}, facets.Nulls)
+	}
+	return finishAggregation(rows, aggReq), nil
+}
+
+// Applies the having conditions, order by and limit of a request to the aggregated rows
+func finishAggregation(rows []map[string]string, aggReq *AggRequest) []map[string]string {
+	kept := make([]map[string]string, 0, len(rows))
+	for _, row := range rows {
+		keep := true
+		for _, h := range aggReq.Having {
+			val, ok := row[h.Col]
+			if !ok {
+				keep = false
+				break
+			}
+			c := compareFloatStrings(val, h.Val[0])
+			switch h.Op {
+			case EqualTo:
+				keep = c == 0
+			case NotEqualTo:
+				keep = c != 0
+			case GreaterThan:
+				keep = c > 0
+			case GreaterThanOrEqual:
+				keep = c >= 0
+			case LessThan:
+				keep = c < 0
+			case LessThanOrEqual:
+				keep = c <= 0
+			}
+			if !keep {
+				break
+			}
+		}
+		if keep {
+			kept = append(kept, row)
+		}
+	}
+
+	sort.SliceStable(kept, func(i, j int) bool {
+		for _, o := range aggReq.OrderBy {
+			c := compareFloatStrings(kept[i][o.Col], kept[j][o.Col])
+			if o.isDesc() {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	if aggReq.Limit > 0 {
+		start := aggReq.Offset
+		if start > len(kept) {
+			start = len(kept)
+		}
+		stop := len(kept)
+		if start+aggReq.Limit < stop {
+			stop = start + aggReq.Limit
+		}
+		kept = kept[start:stop]
+	}
+	return kept
+}
@@ -0,0 +1,127 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func loadNativeAggTestData(t *testing.T, mr *Database) {
+	schema := Schema{
+		Name: "sales",
+		Columns: []Column{
+			{Name: "region", DataType: "string", Filterable: true, Nullable: true},
+			{Name: "rep", DataType: "string", Searchable: true},
+			{Name: "amount", DataType: "float", Filterable: true, Sortable: true},
+		},
+	}
+	err := mr.AddSchema(&schema)
+	if err != nil {
+		t.Fatalf("Failed adding schema %s\n", err)
+	}
+	csv := "region,rep,amount\nEMEA,ann,10\nEMEA,bob,30\nAMER,ann,5\nAMER,cid,5\nAMER,ann,20\n,dan,1\n"
+	err = mr.BulkLoad("sales", strings.NewReader(csv), "csv")
+	if err != nil {
+		t.Fatalf("Failed loading data %s\n", err)
+	}
+}
+
+func TestHasSearchModule(t *testing.T) {
+	mr := miniredis.RunT(t)
+	db := &Database{Client: redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})}
+
+	// connection errors aren't an answer, redis is asked again
+	mr.Close()
+	if !db.hasSearchModule() || db.searchKnown {
+		t.Fatalf("Expected the search module to be assumed and checked again")
+	}
+	err := mr.Restart()
+	if err != nil {
+		t.Fatalf("Failed restarting miniredis %s\n", err)
+	}
+	if db.hasSearchModule() || !db.searchKnown {
+		t.Fatalf("Expected miniredis to have no search module once it answers")
+	}
+}
+
+func TestAggregateNative(t *testing.T) {
+	mr := newMiniRedis(t)
+	loadNativeAggTestData(t, mr)
+
+	if mr.hasSearchModule() {
+		t.Fatalf("Expected miniredis to have no search module")
+	}
+
+	aggReq := AggRequest{
+		Groupby: []string{"region"},
+		Reducers: []Reducer{
+			{Op: ReduceCount},
+			{Op: ReduceSum, Col: "amount", As: "total"},
+			{Op: ReduceAvg, Col: "amount"},
+			{Op: ReduceMin, Col: "amount"},
+			{Op: ReduceMax, Col: "amount"},
+			{Op: ReduceStddev, Col: "amount"},
+			{Op: ReduceCountDistinct, Col: "rep"},
+		},
+		OrderBy: []OrderBy{{Col: "total", Order: "desc"}},
+	}
+	res, err := mr.AggregateData("sales", aggReq)
+	if err != nil {
+		t.Fatalf("Failed aggregating %s\n", err)
+	}
+	expected := []map[string]string{
+		{"region": "EMEA", "count": "2", "total": "40", "avg_amount": "20", "min_amount": "10", "max_amount": "30", "stddev_amount": "14.142135623730951", "count_distinct_rep": "2"},
+		{"region": "AMER", "count": "3", "total": "30", "avg_amount": "10", "min_amount": "5", "max_amount": "20", "stddev_amount": "8.660254037844387", "count_distinct_rep": "2"},
+		{"count": "1", "total": "1", "avg_amount": "1", "min_amount": "1", "max_amount": "1", "stddev_amount": "0", "count_distinct_rep": "1"},
+	}
+	if len(res) != len(expected) {
+		t.Fatalf("Expected %d groups, got %v", len(expected), res)
+	}
+	for i, row := range expected {
+		if len(res[i]) != len(row) {
+			t.Fatalf("Expected group %v, got %v", row, res[i])
+		}
+		for k, v := range row {
+			if res[i][k] != v {
+				t.Fatalf("Expected %s %s in group %v, got %v", k, v, row, res[i])
+			}
+		}
+	}
+
+	// filters, having and limit
+	aggReq = AggRequest{
+		Groupby:  []string{"rep"},
+		Reducers: []Reducer{{Op: ReduceSum, Col: "amount", As: "total"}},
+		Query:    &Query{Filters: []Filter{{Col: "region", Op: IsNotNull}}},
+		Having:   []Filter{{Col: "total", Op: GreaterThanOrEqual, Val: []string{"5"}}},
+		OrderBy:  []OrderBy{{Col: "total"}},
+		Limit:    2,
+	}
+	res, err = mr.AggregateData("sales", aggReq)
+	if err != nil {
+		t.Fatalf("Failed aggregating %s\n", err)
+	}
+	if len(res) != 2 || res[0]["rep"] != "cid" || res[1]["rep"] != "bob" || res[1]["total"] != "30" {
+		t.Fatalf("Expected cid and bob, got %v", res)
+	}
+
+	// counts by a filterable column come from its filter sets
+	legacy := AggRequest{Operation: "count", Column: "amount", Groupby: []string{"region"}}
+	res, err = mr.AggregateData("sales", legacy)
+	if err != nil {
+		t.Fatalf("Failed aggregating %s\n", err)
+	}
+	if len(res) != 3 || res[0]["region"] != "AMER" || res[0]["count_result"] != "3" || res[2]["count_result"] != "1" {
+		t.Fatalf("Expected counts by region, got %v", res)
+	}
+
+	_, err = mr.AggregateData("sales", AggRequest{Reducers: []Reducer{{Op: ReduceQuantile, Col: "amount", Quantile: 0.5}}})
+	if err == nil {
+		t.Fatalf("Not failing for quantile without the search module")
+	}
+}
@@ -0,0 +1,327 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Sorts results by a sortable column, order is asc (default) or desc
+// Null values always come last
+type OrderBy struct {
+	Col   string `json:"col"`
+	Order string `json:"order"`
+}
+
+func (o OrderBy) isDesc() bool {
+	return strings.ToLower(o.Order) == "desc"
+}
+
+// A sorted set of record keys that is paged in order, or in reverse if Desc
+type orderedKey struct {
+	Key  string
+	Desc bool
+}
+
+// validates the order by columns
+func (schema *Schema) validateOrderBy(orderBy []OrderBy) error {
+	seen := make(map[string]bool)
+	for _, o := range orderBy {
+		sortable, err := schema.isSortable(o.Col)
+		if err != nil {
+			return err
+		}
+		if !sortable {
+			return errors.New(fmt.Sprintf("can't order by non-sortable column %s", o.Col))
+		}
+		switch strings.ToLower(o.Order) {
+		case "", "asc", "desc":
+		default:
+			return errors.New(fmt.Sprintf("invalid order %s, must be asc or desc", o.Order))
+		}
+		if seen[o.Col] {
+			return errors.New(fmt.Sprintf("column %s is ordered by more than once", o.Col))
+		}
+		seen[o.Col] = true
+	}
+	return nil
+}
+
+// Adds a record to the column's order set, scored by its value
+// String columns are scored by rank when they are ordered by, see ensureStringOrder
+func addOrderValToPipe(table Table, pipe *redis.Pipeliner, recordKey string, col *Column, val string) error {
+	if col.DataType == "string" {
+		return nil
+	}
+	score, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return err
+	}
+	(*pipe).ZAdd(Ctx, table.formatOrderKey(col.Name), redis.Z{Score: score, Member: recordKey})
+	return nil
+}
+
+// Returns the sorted sets that make up the records of key ordered by a single column
+// Records are scored by value with a ZINTERSTORE against the column's order set,
+// followed by the records where the column is null in load order
+func (db *Database) storeOrderedSegments(table Table, key string, o OrderBy) ([]orderedKey, error) {
+	t := time.Now().String()
+
+	col, err := table.Schema.getColumn(o.Col)
+	if err != nil {
+		return nil, err
+	}
+	if col.DataType == "string" {
+		err = db.ensureStringOrder(table, col)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	valsKey := table.formatOrderStoreKey(o.Col, "vals", t)
+	_, err = db.Client.ZInterStore(Ctx, valsKey, &redis.ZStore{
+		Keys:    []string{key, table.formatOrderKey(o.Col)},
+		Weights: []float64{0, 1},
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	nullsKey := table.formatOrderStoreKey(o.Col, "nulls", t)
+	_, err = db.Client.ZInterStore(Ctx, nullsKey, &redis.ZStore{
+		Keys:    []string{key, table.formatNullKey(o.Col)},
+		Weights: []float64{1, 0},
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	err = db.expireTempKeys(valsKey, nullsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return []orderedKey{{Key: valsKey, Desc: o.isDesc()}, {Key: nullsKey}}, nil
+}
+
+// Returns the paged records of the segments as if they were a single sorted set
+// If limit = -1 then no limit
+func (db *Database) getPagedSegmentKeys(segments []orderedKey, limit int, offset int) (*[]string, ResultSet, error) {
+	keys := make([]string, 0)
+	total := 0
+	for _, seg := range segments {
+		n, err := db.Client.ZCard(Ctx, seg.Key).Result()
+		if err != nil {
+			return nil, ResultSet{}, err
+		}
+
+		// page within this segment
+		start := int64(offset - total)
+		if start < 0 {
+			start = 0
+		}
+		total += int(n)
+		if start >= n || (limit > 0 && len(keys) >= limit) {
+			continue
+		}
+		stop := int64(-1)
+		if limit > 0 {
+			stop = start + int64(limit-len(keys)) - 1
+		}
+
+		var segKeys []string
+		if seg.Desc {
+			segKeys, err = db.Client.ZRevRange(Ctx, seg.Key, start, stop).Result()
+		} else {
+			segKeys, err = db.Client.ZRange(Ctx, seg.Key, start, stop).Result()
+		}
+		if err != nil {
+			return nil, ResultSet{}, err
+		}
+		keys = append(keys, segKeys...)
+	}
+
+	resultSet := ResultSet{
+		Count:  len(keys),
+		Offset: offset,
+		Limit:  limit,
+		Total:  total,
+	}
+	return &keys, resultSet, nil
+}
+
+// Compares two numbers given as strings, falls back to comparing the strings if they don't parse
+func compareFloatStrings(a, b string) int {
+	fa, errA := strconv.ParseFloat(a, 64)
+	fb, errB := strconv.ParseFloat(b, 64)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+	if fa < fb {
+		return -1
+	} else if fa > fb {
+		return 1
+	}
+	return 0
+}
+
+// Compares two values of an order by column, nulls are always last
+func compareOrderValues(col *Column, a, b *string, desc bool) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+
+	c := col.compareValues(*a, *b)
+	if desc {
+		return -c
+	}
+	return c
+}
+
+// Sorts all records of key by multiple columns, key can have at most MaxMultiSortRecords records
+// The values of the order by columns are fetched with pipelined HMGETs of ScanCount records and sorted in memory,
+// ties keep their load order
+func (db *Database) sortRecordKeys(table Table, key string, orderBy []OrderBy) ([]string, error) {
+	n, err := db.Client.ZCard(Ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if n > MaxMultiSortRecords {
+		return nil, errors.New(fmt.Sprintf("%d records match, ordering by multiple columns is limited to %d, filter the query or order by a single column", n, MaxMultiSortRecords))
+	}
+	keys, err := db.Client.ZRange(Ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	cols := make([]string, 0, len(orderBy))
+	columns := make([]*Column, 0, len(orderBy))
+	for _, o := range orderBy {
+		col, err := table.Schema.getColumn(o.Col)
+		if err != nil {
+			return nil, err
+		}
+		cols = append(cols, o.Col)
+		columns = append(columns, col)
+	}
+
+	values := make(map[string][]*string, len(keys))
+	// the load order of the records, their score in the set of all records
+	seqs := make(map[string]float64, len(keys))
+	for start := 0; start < len(keys); start += ScanCount {
+		batch := keys[start:]
+		if len(batch) > ScanCount {
+			batch = batch[:ScanCount]
+		}
+		pipe := db.Client.Pipeline()
+		cmds := make([]*redis.SliceCmd, 0, len(batch))
+		seqCmds := make([]*redis.FloatCmd, 0, len(batch))
+		for _, k := range batch {
+			cmds = append(cmds, pipe.HMGet(Ctx, k, cols...))
+			seqCmds = append(seqCmds, pipe.ZScore(Ctx, table.formatAllRecordKeys(), k))
+		}
+		_, err = pipe.Exec(Ctx)
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		for i, cmd := range cmds {
+			vals := make([]*string, len(cols))
+			for j, v := range cmd.Val() {
+				if s, ok := v.(string); ok {
+					vals[j] = &s
+				}
+			}
+			values[batch[i]] = vals
+			seqs[batch[i]] = seqCmds[i].Val()
+		}
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, b := values[keys[i]], values[keys[j]]
+		for c, o := range orderBy {
+			if cmp := compareOrderValues(columns[c], a[c], b[c], o.isDesc()); cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return seqs[keys[i]] < seqs[keys[j]]
+	})
+	return keys, nil
+}
+
+// Returns the key to the records of key sorted by multiple columns, scored by their position
+// The sort is cached like query results, for the table generation, so paging through the
+// results sorts them once and reads every page with a ZRANGE
+func (db *Database) storeSortedRecordKeys(table Table, key string, orderBy []OrderBy) (string, error) {
+	generation, err := db.Client.Get(Ctx, table.formatGenerationKey()).Int64()
+	if err != nil && err != redis.Nil {
+		return "", err
+	}
+	data, err := json.Marshal(map[string]any{"key": key, "orderBy": orderBy})
+	if err != nil {
+		return "", err
+	}
+	cacheKey := table.formatSortCacheKey(generation, fmt.Sprintf("%x", sha1.Sum(data)))
+
+	// a successful EXPIRE is a hit and keeps the result for another TTL
+	hit, err := db.Client.Expire(Ctx, cacheKey, QueryCacheTTL).Result()
+	if err != nil || hit {
+		return cacheKey, err
+	}
+
+	keys, err := db.sortRecordKeys(table, key, orderBy)
+	if err != nil {
+		return "", err
+	}
+	// the sort is stored under a temporary key and renamed so readers never see part of it
+	dst := cacheKey + ":" + time.Now().String()
+	for i, chunk := range chunkKeys(keys) {
+		members := make([]redis.Z, 0, len(chunk))
+		for j, k := range chunk {
+			members = append(members, redis.Z{Score: float64(i*MaxStoreKeys + j), Member: k})
+		}
+		pipe := db.Client.Pipeline()
+		pipe.ZAdd(Ctx, dst, members...)
+		pipe.Expire(Ctx, dst, QueryCacheTTL)
+		_, err = pipe.Exec(Ctx)
+		if err != nil {
+			return "", err
+		}
+	}
+	if len(keys) == 0 {
+		return cacheKey, nil
+	}
+	return cacheKey, db.Client.Rename(Ctx, dst, cacheKey).Err()
+}
+
+// Returns the paged record keys of key sorted by the order by columns
+// A single column is sorted in redis from its order set, multiple columns are sorted once
+// and cached, see storeSortedRecordKeys
+func (db *Database) getOrderedRecordKeys(table Table, key string, query Query) (*[]string, ResultSet, error) {
+	if len(query.OrderBy) == 1 {
+		segments, err := db.storeOrderedSegments(table, key, query.OrderBy[0])
+		if err != nil {
+			return nil, ResultSet{}, err
+		}
+		return db.getPagedSegmentKeys(segments, query.Limit, query.Offset)
+	}
+
+	sorted, err := db.storeSortedRecordKeys(table, key, query.OrderBy)
+	if err != nil {
+		return nil, ResultSet{}, err
+	}
+	return db.getPagedSegmentKeys([]orderedKey{{Key: sorted}}, query.Limit, query.Offset)
+}
@@ -0,0 +1,163 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"encoding/json"
+	"unicode/utf8"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Stats of a column computed while its table version was loaded
+// Distinct is estimated with a HyperLogLog, Min and Max are left out when every value is null,
+// MinLength and MaxLength count the characters of string columns
+type ColumnProfile struct {
+	Col       string  `json:"col"`
+	DataType  string  `json:"dataType"`
+	Nulls     int64   `json:"nulls"`
+	Distinct  int64   `json:"distinct"`
+	Min       *string `json:"min,omitempty"`
+	Max       *string `json:"max,omitempty"`
+	MinLength *int    `json:"minLength,omitempty"`
+	MaxLength *int    `json:"maxLength,omitempty"`
+}
+
+// Stats of the columns of a table version, they describe the records as loaded
+// and are not updated by later changes to the records
+type TableProfile struct {
+	Table   string          `json:"table"`
+	Version int             `json:"version"`
+	Rows    int64           `json:"rows"`
+	Columns []ColumnProfile `json:"columns"`
+}
+
+// Computes the profile of a table while its records are loaded
+// Values are added to the HyperLogLog of their column in batches of ScanCount
+type tableProfiler struct {
+	table   Table
+	profile TableProfile
+	index   map[string]int
+	pending [][]interface{}
+}
+
+func newTableProfiler(table Table) *tableProfiler {
+	p := tableProfiler{
+		table:   table,
+		profile: TableProfile{Table: table.Name, Version: table.Version, Columns: make([]ColumnProfile, len(table.Schema.Columns))},
+		index:   make(map[string]int, len(table.Schema.Columns)),
+		pending: make([][]interface{}, len(table.Schema.Columns)),
+	}
+	for i, col := range table.Schema.Columns {
+		p.profile.Columns[i] = ColumnProfile{Col: col.Name, DataType: col.DataType}
+		p.index[col.Name] = i
+	}
+	return &p
+}
+
+// Adds a loaded record to the profile, recordVals are its column names and values without the null columns
+func (p *tableProfiler) addToPipe(pipe *redis.Pipeliner, recordVals []string) {
+	p.profile.Rows++
+	seen := make([]bool, len(p.profile.Columns))
+	for i := 0; i+1 < len(recordVals); i += 2 {
+		idx, ok := p.index[recordVals[i]]
+		if !ok {
+			continue
+		}
+		seen[idx] = true
+		col := &p.table.Schema.Columns[idx]
+		prof := &p.profile.Columns[idx]
+		val := recordVals[i+1]
+
+		if prof.Min == nil || col.compareValues(val, *prof.Min) < 0 {
+			v := val
+			prof.Min = &v
+		}
+		if prof.Max == nil || col.compareValues(val, *prof.Max) > 0 {
+			v := val
+			prof.Max = &v
+		}
+		if col.DataType == "string" {
+			n := utf8.RuneCountInString(val)
+			if prof.MinLength == nil || n < *prof.MinLength {
+				prof.MinLength = &n
+			}
+			if prof.MaxLength == nil || n > *prof.MaxLength {
+				m := n
+				prof.MaxLength = &m
+			}
+		}
+
+		p.pending[idx] = append(p.pending[idx], val)
+		if len(p.pending[idx]) >= ScanCount {
+			p.flushToPipe(pipe, idx)
+		}
+	}
+	for i := range seen {
+		if !seen[i] {
+			p.profile.Columns[i].Nulls++
+		}
+	}
+}
+
+// Adds the pending values of a column to its HyperLogLog
+func (p *tableProfiler) flushToPipe(pipe *redis.Pipeliner, idx int) {
+	if len(p.pending[idx]) == 0 {
+		return
+	}
+	(*pipe).PFAdd(Ctx, p.table.formatDistinctKey(p.profile.Columns[idx].Col), p.pending[idx]...)
+	p.pending[idx] = p.pending[idx][:0]
+}
+
+// Adds the remaining values to the HyperLogLogs and saves the profile
+func (p *tableProfiler) finishToPipe(pipe *redis.Pipeliner) error {
+	for i := range p.pending {
+		p.flushToPipe(pipe, i)
+	}
+	profile, err := json.Marshal(p.profile)
+	if err != nil {
+		return err
+	}
+	(*pipe).Set(Ctx, p.table.formatProfileKey(), profile, 0)
+	return nil
+}
+
+// Returns the column stats of a table version computed when it was loaded, version -1 is the current version
+// Returns ErrNil if the version has no stats
+func (db *Database) GetTableProfile(tableName string, version int) (*TableProfile, error) {
+	table, err := db.getTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+	if version >= 0 {
+		table.Version = version
+	}
+
+	data, err := db.Client.Get(Ctx, table.formatProfileKey()).Result()
+	if err == redis.Nil {
+		return nil, ErrNil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var profile TableProfile
+	err = json.Unmarshal([]byte(data), &profile)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := db.Client.Pipeline()
+	counts := make([]*redis.IntCmd, len(profile.Columns))
+	for i, col := range profile.Columns {
+		counts[i] = pipe.PFCount(Ctx, table.formatDistinctKey(col.Col))
+	}
+	_, err = pipe.Exec(Ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range profile.Columns {
+		profile.Columns[i].Distinct = counts[i].Val()
+	}
+	return &profile, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTableProfile(t *testing.T) {
+	mr := newMiniRedis(t)
+	schema := Schema{
+		Name: "people",
+		Columns: []Column{
+			{Name: "name", DataType: "string", Filterable: true},
+			{Name: "age", DataType: "int", Filterable: true, Nullable: true},
+			{Name: "city", DataType: "string", Nullable: true},
+			{Name: "joined", DataType: "date", Nullable: true},
+		},
+	}
+	err := mr.AddSchema(&schema)
+	if err != nil {
+		t.Fatalf("Failed adding schema %s\n", err)
+	}
+
+	_, err = mr.GetTableProfile("people", -1)
+	if err != ErrNil {
+		t.Fatalf("Expected no stats before a load, got %v", err)
+	}
+
+	csv := "name,age,city\nann,9,Zürich\nbob,10,Oslo\nbob,,\ncid,100,Oslo\n"
+	err = mr.BulkLoad("people", strings.NewReader(csv), "csv")
+	if err != nil {
+		t.Fatalf("Failed loading data %s\n", err)
+	}
+	profile, err := mr.GetTableProfile("people", -1)
+	if err != nil {
+		t.Fatalf("Failed getting stats %s\n", err)
+	}
+	if profile.Table != "people" || profile.Version != 0 || profile.Rows != 4 || len(profile.Columns) != 4 {
+		t.Fatalf("Expected stats of 4 rows and 4 columns, got %+v", profile)
+	}
+
+	str := func(p *string) string {
+		if p == nil {
+			return "<nil>"
+		}
+		return *p
+	}
+	num := func(p *int) string {
+		if p == nil {
+			return "<nil>"
+		}
+		return fmt.Sprint(*p)
+	}
+	expected := []string{
+		"name string nulls=0 distinct=3 min=ann max=cid len=3..3",
+		"age int nulls=1 distinct=3 min=9 max=100 len=<nil>..<nil>",
+		"city string nulls=1 distinct=2 min=Oslo max=Zürich len=4..6",
+		"joined date nulls=4 distinct=0 min=<nil> max=<nil> len=<nil>..<nil>",
+	}
+	for i, col := range profile.Columns {
+		got := fmt.Sprintf("%s %s nulls=%d distinct=%d min=%s max=%s len=%s..%s",
+			col.Col, col.DataType, col.Nulls, col.Distinct, str(col.Min), str(col.Max), num(col.MinLength), num(col.MaxLength))
+		if got != expected[i] {
+			t.Fatalf("Expected %s, got %s", expected[i], got)
+		}
+	}
+
+	// every version keeps its own stats
+	err = mr.BulkLoad("people", strings.NewReader("name,joined\ndan,2023-01-02\n"), "csv")
+	if err != nil {
+		t.Fatalf("Failed loading data %s\n", err)
+	}
+	profile, err = mr.GetTableProfile("people", -1)
+	if err != nil || profile.Version != 1 || profile.Rows != 1 || str(profile.Columns[3].Min) != "2023-01-02" || profile.Columns[1].Nulls != 1 {
+		t.Fatalf("Expected stats of version 1, got %+v %v", profile, err)
+	}
+	profile, err = mr.GetTableProfile("people", 0)
+	if err != nil || profile.Version != 0 || profile.Rows != 4 {
+		t.Fatalf("Expected stats of version 0, got %+v %v", profile, err)
+	}
+	_, err = mr.GetTableProfile("people", 5)
+	if err != ErrNil {
+		t.Fatalf("Expected no stats for version 5, got %v", err)
+	}
+
+	// a failed load has no stats, the last successful load stays current
+	err = mr.BulkLoad("people", strings.NewReader("name,nickname\neve,evie\n"), "csv")
+	if err == nil {
+		t.Fatalf("Expected load to fail")
+	}
+	_, err = mr.GetTableProfile("people", 2)
+	if err != ErrNil {
+		t.Fatalf("Expected no stats for a failed load, got %v", err)
+	}
+	profile, err = mr.GetTableProfile("people", -1)
+	if err != nil || profile.Version != 1 {
+		t.Fatalf("Expected stats of version 1, got %+v %v", profile, err)
+	}
+}
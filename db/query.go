@@ -8,12 +8,22 @@ import (
 	"fmt"
 )
 
+// Scroll snapshots the results and returns a cursor to the next page, read with Cursor
 type Query struct {
 	Filters    []Filter          `json:"filters" binding:"dive"`
+	Where      *FilterExpr       `json:"where"`
+	OrderBy    []OrderBy         `json:"orderBy"`
+	Columns    []string          `json:"columns"`
+	Scroll     bool              `json:"scroll"`
+	Cursor     string            `json:"cursor"`
 	SearchTerm string            `json:"searchTerm"`
+	Search     *Search           `json:"search"`
 	Limit      int               `json:"limit"`
 	Offset     int               `json:"offset"`
 	Updates    map[string]string `json:"updates"`
+	Joins      []Join            `json:"joins"`
+	// sets of record keys the results are restricted to, one per inner join
+	joinSets []string
 }
 
 func (schema *Schema) validateQuery(query Query) error {
@@ -23,9 +33,48 @@ func (schema *Schema) validateQuery(query Query) error {
 	if query.Offset < 0 {
 		return errors.New("invalid offset")
 	}
+	err := schema.validateOrderBy(query.OrderBy)
+	if err != nil {
+		return err
+	}
+	err = schema.validateColumns(query.Columns)
+	if err != nil {
+		return err
+	}
+	if query.SearchTerm != "" && query.Search != nil {
+		return errors.New("only one of searchTerm and search can be given")
+	}
+	if search := query.search(); search != nil {
+		err := schema.validateSearch(search)
+		if err != nil {
+			return err
+		}
+	}
+	if query.Where != nil {
+		err := schema.validateFilterExpr(query.Where)
+		if err != nil {
+			return err
+		}
+	}
 	return schema.validateFilters(query.Filters)
 }
 
+// Validates the projected columns are in the schema and not repeated
+func (schema *Schema) validateColumns(columns []string) error {
+	seen := make(map[string]bool, len(columns))
+	for _, col := range columns {
+		_, err := schema.getColumn(col)
+		if err != nil {
+			return err
+		}
+		if seen[col] {
+			return errors.New(fmt.Sprintf("column %s is requested more than once", col))
+		}
+		seen[col] = true
+	}
+	return nil
+}
+
 // Validates the update map
 // For now this just checks to make sure the column is in the schema
 func (db *Database) validateUpdateValues(schema *Schema, values *map[string]string) error {
@@ -7,6 +7,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
 )
 
 type Column struct {
@@ -18,6 +21,26 @@ type Column struct {
 	// If true, column is added to RediSearch Index's schema
 	// Searches will include this column
 	Searchable bool `json:"searchable"`
+
+	// If true, null cells are stored as null instead of as a value
+	// Null values are left out of the record hash and kept in a null set if filterable
+	Nullable bool `json:"nullable"`
+
+	// Value stored in place of a null cell, takes precedence over Nullable
+	Default *string `json:"default,omitempty"`
+
+	// Constraints enforced whenever records are written
+	// Required values can't be null or empty, patterns must match the whole value
+	Required  bool     `json:"required"`
+	Min       *float64 `json:"min,omitempty"`
+	Max       *float64 `json:"max,omitempty"`
+	MaxLength *int     `json:"maxLength,omitempty"`
+	Pattern   string   `json:"pattern,omitempty"`
+	Enum      []string `json:"enum,omitempty"`
+
+	// How sortable string values are compared when ordering and in range filters
+	// binary (default) compares bytes, nocase compares lower cased values
+	Collation string `json:"collation,omitempty"`
 }
 
 type Schema struct {
@@ -25,17 +48,27 @@ type Schema struct {
 	Columns []Column `json:"columns" binding:"required,dive"`
 }
 
-func sortableDataType(dt string) bool {
+func numericDataType(dt string) bool {
 	if dt == "int" || dt == "float" {
 		return true
 	}
 	return false
 }
 
+// Numbers are sorted by value and strings lexicographically by their collation
+func sortableDataType(dt string) bool {
+	return numericDataType(dt) || dt == "string"
+}
+
 // validates the schema
-// For now this only makes sure all sortable columns are also filterable
+// Makes sure all sortable columns are also filterable, defaults match the datatype and constraints are valid
 func validateSchema(schema *Schema) error {
 	for _, c := range schema.Columns {
+		if c.Default != nil && numericDataType(c.DataType) {
+			if _, err := strconv.ParseFloat(*c.Default, 64); err != nil {
+				return errors.New(fmt.Sprintf("invalid schema %s default is not a %s", c.Name, c.DataType))
+			}
+		}
 		if c.Sortable {
 			// Must be filterable
 			if !c.Filterable {
@@ -45,8 +78,11 @@ func validateSchema(schema *Schema) error {
 				return errors.New(fmt.Sprintf("invalid schema %s datatype is not sortable", c.Name))
 			}
 		}
+		if err := validateCollation(&c); err != nil {
+			return err
+		}
 	}
-	return nil
+	return validateConstraints(schema)
 }
 
 // AddSchema attempts to add schema to the Database and also
@@ -60,28 +96,40 @@ func (db *Database) AddSchema(schema *Schema) error {
 
 	key := schema.formatSchemaKey()
 
-	// Check if the schema already exists
-	s, _ := db.Client.Get(Ctx, key).Result()
-	if s != "" {
-		return ErrImmutableKey
-	}
-
 	schemaJSON, err := json.Marshal(schema)
 	if err != nil {
 		return err
 	}
 
-	pipe := db.Client.TxPipeline()
-	// add schema key to schemas set
-	pipe.SAdd(Ctx, allSchemasKey, key)
-	// Add schema json
-	pipe.Set(Ctx, key, schemaJSON, 0)
-	_, err = pipe.Exec(Ctx)
-	if err != nil {
-		return err
-	}
+	// The existence and alias checks are watched so a concurrent alias can't be shadowed
+	return db.aliasTx(func(tx *redis.Tx) error {
+		// Check if the schema already exists
+		n, err := tx.Exists(Ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return ErrImmutableKey
+		}
+
+		// Table names can't shadow an alias
+		found, err := tx.HExists(Ctx, formatAliasesKey(), schema.Name).Result()
+		if err != nil {
+			return err
+		}
+		if found {
+			return ErrAliasConflict
+		}
 
-	return nil
+		_, err = tx.TxPipelined(Ctx, func(pipe redis.Pipeliner) error {
+			// add schema key to schemas set
+			pipe.SAdd(Ctx, allSchemasKey, key)
+			// Add schema json
+			pipe.Set(Ctx, key, schemaJSON, 0)
+			return nil
+		})
+		return err
+	}, schema.Name)
 }
 
 func (db *Database) getSchemaByKey(key string) (*Schema, error) {
@@ -106,11 +154,15 @@ func (db *Database) getSchemaByKey(key string) (*Schema, error) {
 	return &schema, nil
 }
 
-// GetSchema returns the schema based on table name
+// GetSchema returns the schema based on table or alias name
 func (db *Database) GetSchema(name string) (*Schema, error) {
 	if name == "" {
 		return nil, ErrEmptyKey
 	}
+	name, err := db.resolveTableName(name)
+	if err != nil {
+		return nil, err
+	}
 	return db.getSchemaByKey(formatSchemaKey(name))
 }
 
@@ -152,3 +204,37 @@ func (schema *Schema) isSortable(col string) (bool, error) {
 	}
 	return false, errors.New(fmt.Sprintf("column %s not found in schema", col))
 }
+
+// Returns true if any column is in the table's search index
+func (schema *Schema) hasSearchableColumns() bool {
+	for _, c := range schema.Columns {
+		if c.Searchable {
+			return true
+		}
+	}
+	return false
+}
+
+func (schema *Schema) getColumn(col string) (*Column, error) {
+	for i := range schema.Columns {
+		if schema.Columns[i].Name == col {
+			return &schema.Columns[i], nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("column %s not found in schema", col))
+}
+
+// Resolves a raw cell value into the value to store, null is true for null cells
+// Returns false if the cell should be stored as null
+func (col *Column) resolveValue(val string, null bool) (string, bool) {
+	if !null {
+		return val, true
+	}
+	if col.Default != nil {
+		return *col.Default, true
+	}
+	if col.Nullable {
+		return "", false
+	}
+	return val, true
+}
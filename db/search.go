@@ -0,0 +1,208 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Ways the words of a search term are matched
+// terms matches records with all words, phrase matches the words next to each other,
+// prefix matches words starting with each word and fuzzy matches words within a Levenshtein distance
+const (
+	SearchTerms  = "terms"
+	SearchPhrase = "phrase"
+	SearchPrefix = "prefix"
+	SearchFuzzy  = "fuzzy"
+)
+
+const (
+	// Largest Levenshtein distance RediSearch supports for fuzzy matching
+	MaxFuzzyDistance = 3
+
+	// Tags around the matched words of highlighted values
+	HighlightOpenTag  = "<b>"
+	HighlightCloseTag = "</b>"
+)
+
+// A full-text search, translated to RediSearch query syntax
+// Columns scopes the search to some searchable columns, by default all of them are searched
+// Distance is the Levenshtein distance of fuzzy searches, 1 by default
+// Highlight returns the values of matched columns with the matched words in tags
+type Search struct {
+	Term      string   `json:"term"`
+	Columns   []string `json:"columns"`
+	Mode      string   `json:"mode"`
+	Distance  int      `json:"distance"`
+	Highlight bool     `json:"highlight"`
+}
+
+// Characters with a meaning in RediSearch query syntax, they are escaped to be searched for
+const searchSpecialChars = `,.<>{}[]"':;!@#$%^&*()-+=~|/\`
+
+// Returns a replacer escaping the special characters and the extra ones with a backslash
+func newSearchEscaper(extra string) *strings.Replacer {
+	chars := searchSpecialChars + extra
+	oldnew := make([]string, 0, 2*len(chars))
+	for _, c := range chars {
+		oldnew = append(oldnew, string(c), `\`+string(c))
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+var searchEscaper = newSearchEscaper("")
+
+// Returns the search of a query, a plain searchTerm is searched as a phrase
+func (query *Query) search() *Search {
+	if query.Search != nil {
+		return query.Search
+	}
+	if query.SearchTerm != "" {
+		return &Search{Term: query.SearchTerm, Mode: SearchPhrase}
+	}
+	return nil
+}
+
+// Validates the search mode and that its columns are searchable text columns
+func (schema *Schema) validateSearch(search *Search) error {
+	if strings.TrimSpace(search.Term) == "" {
+		return errors.New("search term can't be empty")
+	}
+	if !schema.hasSearchableColumns() {
+		return errors.New(fmt.Sprintf("can't search %s, it has no searchable columns", schema.Name))
+	}
+	for _, name := range search.Columns {
+		col, err := schema.getColumn(name)
+		if err != nil {
+			return err
+		}
+		if !col.Searchable || col.columnIndexFieldType() != "TEXT" {
+			return errors.New(fmt.Sprintf("can't search non-searchable or non-text column %s", name))
+		}
+	}
+
+	switch search.Mode {
+	case "", SearchTerms, SearchPhrase, SearchPrefix:
+		if search.Distance != 0 {
+			return errors.New("distance is only valid for fuzzy searches")
+		}
+	case SearchFuzzy:
+		if search.Distance < 0 || search.Distance > MaxFuzzyDistance {
+			return errors.New(fmt.Sprintf("invalid distance %d, must be between 1 and %d", search.Distance, MaxFuzzyDistance))
+		}
+	default:
+		return errors.New(fmt.Sprintf("invalid search mode %s, must be %s, %s, %s or %s",
+			search.Mode, SearchTerms, SearchPhrase, SearchPrefix, SearchFuzzy))
+	}
+	return nil
+}
+
+// Returns the RediSearch query of the search
+// e.g. a fuzzy search for "acme corp" in name is @name:(%acme% %corp%)
+func (search *Search) queryString() string {
+	words := strings.Fields(search.Term)
+	for i, w := range words {
+		words[i] = searchEscaper.Replace(w)
+	}
+
+	var q string
+	switch search.Mode {
+	case SearchPhrase:
+		q = `"` + strings.Join(words, " ") + `"`
+	case SearchPrefix:
+		q = strings.Join(words, "* ") + "*"
+	case SearchFuzzy:
+		distance := search.Distance
+		if distance == 0 {
+			distance = 1
+		}
+		p := strings.Repeat("%", distance)
+		for i, w := range words {
+			words[i] = p + w + p
+		}
+		q = strings.Join(words, " ")
+	default:
+		q = strings.Join(words, " ")
+	}
+
+	if len(search.Columns) > 0 {
+		q = fmt.Sprintf("@%s:(%s)", strings.Join(search.Columns, "|"), q)
+	}
+	return q
+}
+
+// Returns the columns the search highlights, its columns or all searchable text columns
+func (search *Search) highlightColumns(schema *Schema) []string {
+	if len(search.Columns) > 0 {
+		return search.Columns
+	}
+	cols := make([]string, 0)
+	for _, c := range schema.Columns {
+		if c.Searchable && c.columnIndexFieldType() == "TEXT" {
+			cols = append(cols, c.Name)
+		}
+	}
+	return cols
+}
+
+// Returns the highlighted values of the matched columns of each record key, in the order of keys
+// The search is run again with INKEYS so only the records of the page are highlighted
+func (db *Database) getHighlights(table Table, search *Search, keys []string) ([]map[string]string, error) {
+	highlights := make([]map[string]string, len(keys))
+	for i := range highlights {
+		highlights[i] = make(map[string]string)
+	}
+	if len(keys) == 0 {
+		return highlights, nil
+	}
+
+	cols := search.highlightColumns(&table.Schema)
+	args := []any{"FT.SEARCH", table.formatTableIndex(), search.queryString(), "INKEYS", len(keys)}
+	for _, k := range keys {
+		args = append(args, k)
+	}
+	args = append(args, "RETURN", len(cols))
+	for _, c := range cols {
+		args = append(args, c)
+	}
+	args = append(args, "HIGHLIGHT", "FIELDS", len(cols))
+	for _, c := range cols {
+		args = append(args, c)
+	}
+	args = append(args, "TAGS", HighlightOpenTag, HighlightCloseTag, "LIMIT", 0, len(keys))
+
+	res, err := db.Client.Do(Ctx, args...).Result()
+	if err != nil {
+		return nil, err
+	}
+	results, ok := res.([]any)
+	if !ok || len(results) == 0 {
+		return nil, errors.New(fmt.Sprintf("unexpected search results for %s", search.Term))
+	}
+
+	// results are the total followed by pairs of key and field, value list
+	index := make(map[string]int, len(keys))
+	for i, k := range keys {
+		index[k] = i
+	}
+	for i := 1; i+1 < len(results); i += 2 {
+		key, _ := results[i].(string)
+		fields, _ := results[i+1].([]any)
+		pos, ok := index[key]
+		if !ok {
+			continue
+		}
+		for j := 0; j+1 < len(fields); j += 2 {
+			col, _ := fields[j].(string)
+			val, _ := fields[j+1].(string)
+			// only keep the columns with a match
+			if strings.Contains(val, HighlightOpenTag) {
+				highlights[pos][col] = val
+			}
+		}
+	}
+	return highlights, nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"testing"
+)
+
+func TestSearchQueryString(t *testing.T) {
+	tests := []struct {
+		search   Search
+		expected string
+	}{
+		{Search{Term: "acme corp"}, `acme corp`},
+		{Search{Term: "acme corp", Mode: SearchPhrase}, `"acme corp"`},
+		{Search{Term: "ac co", Mode: SearchPrefix}, `ac* co*`},
+		{Search{Term: "acme", Mode: SearchFuzzy}, `%acme%`},
+		{Search{Term: "acme", Mode: SearchFuzzy, Distance: 2}, `%%acme%%`},
+		{Search{Term: "acme", Columns: []string{"name", "city"}}, `@name|city:(acme)`},
+		{Search{Term: "a-b @c (d)|e*"}, `a\-b \@c \(d\)\|e\*`},
+		{Search{Term: `"x" y:z`, Mode: SearchPhrase}, `"\"x\" y\:z"`},
+	}
+	for _, test := range tests {
+		if q := test.search.queryString(); q != test.expected {
+			t.Fatalf("Expected query %s for %v, got %s", test.expected, test.search, q)
+		}
+	}
+
+	legacy := Query{SearchTerm: "AMER"}
+	if q := legacy.search().queryString(); q != `"AMER"` {
+		t.Fatalf("Expected searchTerm to be searched as a phrase, got %s", q)
+	}
+}
+
+func TestValidateSearch(t *testing.T) {
+	schema := Schema{
+		Name: "companies",
+		Columns: []Column{
+			{Name: "name", DataType: "string", Searchable: true},
+			{Name: "size", DataType: "int", Searchable: true},
+			{Name: "city", DataType: "string"},
+		},
+	}
+
+	valid := []Search{
+		{Term: "acme"},
+		{Term: "acme", Columns: []string{"name"}, Mode: SearchPrefix},
+		{Term: "acme", Mode: SearchFuzzy, Distance: MaxFuzzyDistance},
+	}
+	for _, s := range valid {
+		err := schema.validateSearch(&s)
+		if err != nil {
+			t.Fatalf("Failed validating search %v %s\n", s, err)
+		}
+	}
+
+	invalid := []Search{
+		{Term: " "},
+		{Term: "acme", Columns: []string{"size"}},
+		{Term: "acme", Columns: []string{"city"}},
+		{Term: "acme", Columns: []string{"missing"}},
+		{Term: "acme", Mode: "regex"},
+		{Term: "acme", Mode: SearchFuzzy, Distance: MaxFuzzyDistance + 1},
+		{Term: "acme", Distance: 1},
+	}
+	for _, s := range invalid {
+		err := schema.validateSearch(&s)
+		if err == nil {
+			t.Fatalf("Not failing for invalid search %v", s)
+		}
+	}
+
+	err := schema.validateQuery(Query{SearchTerm: "acme", Search: &Search{Term: "acme"}})
+	if err == nil {
+		t.Fatalf("Not failing for both searchTerm and search")
+	}
+}
+
+func TestParseMaxSearchResults(t *testing.T) {
+	tests := []struct {
+		res      any
+		expected int64
+	}{
+		{[]any{[]any{"MAXSEARCHRESULTS", "10000"}}, 10000},
+		{[]any{[]any{"MAXSEARCHRESULTS", "500"}}, 500},
+		{[]any{[]any{"MAXSEARCHRESULTS", "unlimited"}}, -1},
+		{[]any{}, DefaultMaxSearchResults},
+		{"blah", DefaultMaxSearchResults},
+	}
+	for _, test := range tests {
+		if max := parseMaxSearchResults(test.res); max != test.expected {
+			t.Fatalf("Expected %d for %v, got %d", test.expected, test.res, max)
+		}
+	}
+}
@@ -0,0 +1,1010 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Returned when a SQL statement can't be parsed or uses an unsupported construct
+// Pos is the 1 based position of the offending character in the statement
+type SQLError struct {
+	Pos    int    `json:"pos"`
+	Reason string `json:"reason"`
+}
+
+func (e *SQLError) Error() string {
+	return fmt.Sprintf("invalid sql at position %d, %s", e.Pos, e.Reason)
+}
+
+type sqlTokenKind int
+
+const (
+	sqlEOF sqlTokenKind = iota
+	sqlWord
+	sqlQuoted
+	sqlString
+	sqlNumber
+	sqlSymbol
+)
+
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+	pos  int
+}
+
+// Words that must be quoted to be used as table or column names
+var sqlKeywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "GROUP": true, "BY": true, "HAVING": true, "ORDER": true,
+	"LIMIT": true, "OFFSET": true, "AND": true, "OR": true, "NOT": true, "IN": true, "IS": true, "NULL": true,
+	"BETWEEN": true, "LIKE": true, "AS": true, "ASC": true, "DESC": true, "DISTINCT": true, "JOIN": true,
+	"UNION": true, "ON": true, "TRUE": true, "FALSE": true,
+}
+
+// Reducers of the aggregate functions, COUNT(DISTINCT col) is count_distinct
+var sqlAggregates = map[string]string{
+	"COUNT":  ReduceCount,
+	"SUM":    ReduceSum,
+	"AVG":    ReduceAvg,
+	"MIN":    ReduceMin,
+	"MAX":    ReduceMax,
+	"STDDEV": ReduceStddev,
+}
+
+// Splits a statement into words, quoted names, string literals, numbers and symbols
+// Names are quoted with double quotes or backticks, strings with single quotes, quotes are escaped by doubling them
+func tokenizeSQL(sql string) ([]sqlToken, error) {
+	runes := []rune(sql)
+	tokens := make([]sqlToken, 0)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlWord, text: string(runes[i:j]), pos: pos})
+			i = j
+		case unicode.IsDigit(r) || ((r == '-' || r == '.') && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			j := i + 1
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.' || runes[j] == 'e' || runes[j] == 'E' ||
+				((runes[j] == '-' || runes[j] == '+') && (runes[j-1] == 'e' || runes[j-1] == 'E'))) {
+				j++
+			}
+			text := string(runes[i:j])
+			if _, err := strconv.ParseFloat(text, 64); err != nil {
+				return nil, &SQLError{Pos: pos, Reason: fmt.Sprintf("invalid number %s", text)}
+			}
+			tokens = append(tokens, sqlToken{kind: sqlNumber, text: text, pos: pos})
+			i = j
+		case r == '\'' || r == '"' || r == '`':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(runes); j++ {
+				if runes[j] == r {
+					if j+1 < len(runes) && runes[j+1] == r {
+						sb.WriteRune(r)
+						j++
+						continue
+					}
+					break
+				}
+				sb.WriteRune(runes[j])
+			}
+			if j == len(runes) {
+				return nil, &SQLError{Pos: pos, Reason: fmt.Sprintf("unterminated %c", r)}
+			}
+			kind := sqlQuoted
+			if r == '\'' {
+				kind = sqlString
+			}
+			tokens = append(tokens, sqlToken{kind: kind, text: sb.String(), pos: pos})
+			i = j + 1
+		default:
+			text := string(r)
+			if i+1 < len(runes) {
+				switch two := string(runes[i : i+2]); two {
+				case "<=", ">=", "<>", "!=":
+					text = two
+				}
+			}
+			if !strings.Contains("=<>(),*.;", text) && len(text) == 1 {
+				return nil, &SQLError{Pos: pos, Reason: fmt.Sprintf("unexpected character %s", text)}
+			}
+			tokens = append(tokens, sqlToken{kind: sqlSymbol, text: text, pos: pos})
+			i += len([]rune(text))
+		}
+	}
+	// a trailing semicolon ends the statement
+	if n := len(tokens); n > 0 && tokens[n-1].kind == sqlSymbol && tokens[n-1].text == ";" {
+		tokens = tokens[:n-1]
+	}
+	return append(tokens, sqlToken{kind: sqlEOF, pos: len(runes) + 1}), nil
+}
+
+// A column or aggregate of the select list, Reducer is nil for columns
+type sqlSelectItem struct {
+	Col     string
+	Reducer *Reducer
+	pos     int
+}
+
+// A parsed SELECT statement, Limit is -1 without a LIMIT clause
+type sqlStatement struct {
+	Star     bool
+	Items    []sqlSelectItem
+	Table    string
+	Where    *FilterExpr
+	GroupBy  []string
+	Having   []sqlCondition
+	OrderBy  []sqlOrder
+	Limit    int
+	Offset   int
+	tablePos int
+	groupPos []int
+	leaves   []sqlLeaf
+}
+
+// A condition of the WHERE clause with the position of its column
+type sqlLeaf struct {
+	Filter Filter
+	pos    int
+}
+
+// A having condition on a column, alias or aggregate
+type sqlCondition struct {
+	Ref sqlSelectItem
+	Op  FilterOp
+	Val string
+}
+
+// An order by column, alias or aggregate
+type sqlOrder struct {
+	Ref   sqlSelectItem
+	Order string
+}
+
+type sqlParser struct {
+	tokens []sqlToken
+	i      int
+	leaves []sqlLeaf
+}
+
+func (p *sqlParser) peek() sqlToken {
+	return p.tokens[p.i]
+}
+
+func (p *sqlParser) next() sqlToken {
+	tok := p.tokens[p.i]
+	if tok.kind != sqlEOF {
+		p.i++
+	}
+	return tok
+}
+
+func (p *sqlParser) errorf(tok sqlToken, format string, a ...any) error {
+	return &SQLError{Pos: tok.pos, Reason: fmt.Sprintf(format, a...)}
+}
+
+// Returns an error naming the unexpected token
+func (p *sqlParser) unexpected(expected string) error {
+	tok := p.peek()
+	switch tok.kind {
+	case sqlEOF:
+		return p.errorf(tok, "expected %s, got end of statement", expected)
+	case sqlString:
+		return p.errorf(tok, "expected %s, got '%s'", expected, tok.text)
+	}
+	return p.errorf(tok, "expected %s, got %s", expected, tok.text)
+}
+
+func (p *sqlParser) isKeyword(kw string) bool {
+	tok := p.peek()
+	return tok.kind == sqlWord && strings.EqualFold(tok.text, kw)
+}
+
+func (p *sqlParser) acceptKeyword(kw string) bool {
+	if p.isKeyword(kw) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) expectKeyword(kw string) error {
+	if !p.acceptKeyword(kw) {
+		return p.unexpected(kw)
+	}
+	return nil
+}
+
+func (p *sqlParser) isSymbol(s string) bool {
+	tok := p.peek()
+	return tok.kind == sqlSymbol && tok.text == s
+}
+
+func (p *sqlParser) acceptSymbol(s string) bool {
+	if p.isSymbol(s) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) expectSymbol(s string) error {
+	if !p.acceptSymbol(s) {
+		return p.unexpected(s)
+	}
+	return nil
+}
+
+// Parses a table, column or alias name, keywords must be quoted
+func (p *sqlParser) name(what string) (string, error) {
+	tok := p.peek()
+	switch {
+	case tok.kind == sqlQuoted:
+		p.next()
+		return tok.text, nil
+	case tok.kind == sqlWord && !sqlKeywords[strings.ToUpper(tok.text)]:
+		p.next()
+		return tok.text, nil
+	case tok.kind == sqlWord:
+		return "", p.errorf(tok, "expected %s, got keyword %s, quote it to use it as a name", what, strings.ToUpper(tok.text))
+	}
+	return "", p.unexpected(what)
+}
+
+// Parses a string, number or boolean literal
+func (p *sqlParser) literal() (string, error) {
+	tok := p.peek()
+	switch {
+	case tok.kind == sqlString || tok.kind == sqlNumber:
+		p.next()
+		return tok.text, nil
+	case p.isKeyword("TRUE") || p.isKeyword("FALSE"):
+		p.next()
+		return strings.ToLower(tok.text), nil
+	case p.isKeyword("NULL"):
+		return "", p.errorf(tok, "NULL can only be compared with IS NULL or IS NOT NULL")
+	case tok.kind == sqlWord || tok.kind == sqlQuoted:
+		return "", p.errorf(tok, "comparing columns is not supported, expected a value")
+	}
+	return "", p.unexpected("a value")
+}
+
+// Parses a SELECT statement
+func parseSQL(sql string) (*sqlStatement, error) {
+	tokens, err := tokenizeSQL(sql)
+	if err != nil {
+		return nil, err
+	}
+	p := &sqlParser{tokens: tokens}
+	stmt := sqlStatement{Limit: -1}
+
+	if !p.acceptKeyword("SELECT") {
+		tok := p.peek()
+		if tok.kind == sqlWord {
+			return nil, p.errorf(tok, "only SELECT statements are supported")
+		}
+		return nil, p.unexpected("SELECT")
+	}
+	if p.isKeyword("DISTINCT") {
+		return nil, p.errorf(p.peek(), "SELECT DISTINCT is not supported, use GROUP BY")
+	}
+	if p.acceptSymbol("*") {
+		stmt.Star = true
+	} else {
+		for {
+			item, err := p.selectItem()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Items = append(stmt.Items, item)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	err = p.expectKeyword("FROM")
+	if err != nil {
+		return nil, err
+	}
+	stmt.tablePos = p.peek().pos
+	if p.isSymbol("(") {
+		return nil, p.errorf(p.peek(), "subqueries are not supported")
+	}
+	stmt.Table, err = p.name("a table")
+	if err != nil {
+		return nil, err
+	}
+	for _, kw := range []string{"JOIN", "INNER", "LEFT", "RIGHT", "FULL", "CROSS"} {
+		if p.isKeyword(kw) {
+			return nil, p.errorf(p.peek(), "JOIN is not supported, use the joins of a data query")
+		}
+	}
+	if p.isSymbol(",") {
+		return nil, p.errorf(p.peek(), "selecting from several tables is not supported")
+	}
+
+	if p.acceptKeyword("WHERE") {
+		stmt.Where, err = p.orExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.leaves = p.leaves
+	}
+	if p.acceptKeyword("GROUP") {
+		err = p.expectKeyword("BY")
+		if err != nil {
+			return nil, err
+		}
+		for {
+			pos := p.peek().pos
+			col, err := p.name("a column")
+			if err != nil {
+				return nil, err
+			}
+			stmt.GroupBy = append(stmt.GroupBy, col)
+			stmt.groupPos = append(stmt.groupPos, pos)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("HAVING") {
+		for {
+			cond, err := p.havingCondition()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Having = append(stmt.Having, cond)
+			if p.isKeyword("OR") {
+				return nil, p.errorf(p.peek(), "only AND is supported in HAVING")
+			}
+			if !p.acceptKeyword("AND") {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("ORDER") {
+		err = p.expectKeyword("BY")
+		if err != nil {
+			return nil, err
+		}
+		for {
+			ref, err := p.outputRef()
+			if err != nil {
+				return nil, err
+			}
+			o := sqlOrder{Ref: ref}
+			if p.acceptKeyword("DESC") {
+				o.Order = "desc"
+			} else if p.acceptKeyword("ASC") {
+				o.Order = "asc"
+			}
+			stmt.OrderBy = append(stmt.OrderBy, o)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("LIMIT") {
+		stmt.Limit, err = p.count("LIMIT")
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("OFFSET") {
+		stmt.Offset, err = p.count("OFFSET")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if tok := p.peek(); tok.kind != sqlEOF {
+		if p.isKeyword("UNION") {
+			return nil, p.errorf(tok, "UNION is not supported")
+		}
+		return nil, p.unexpected("end of statement")
+	}
+	return &stmt, nil
+}
+
+// Parses the non-negative integer of a LIMIT or OFFSET
+func (p *sqlParser) count(clause string) (int, error) {
+	tok := p.peek()
+	n, err := strconv.Atoi(tok.text)
+	if tok.kind != sqlNumber || err != nil || n < 0 {
+		return 0, p.errorf(tok, "%s must be a non-negative integer", clause)
+	}
+	p.next()
+	return n, nil
+}
+
+// Parses an aggregate call, the current token is its function name
+func (p *sqlParser) aggregate() (*Reducer, error) {
+	tok := p.next()
+	op, ok := sqlAggregates[strings.ToUpper(tok.text)]
+	if !ok {
+		return nil, p.errorf(tok, "function %s is not supported, only COUNT, SUM, AVG, MIN, MAX and STDDEV are", tok.text)
+	}
+	err := p.expectSymbol("(")
+	if err != nil {
+		return nil, err
+	}
+	r := Reducer{Op: op}
+	switch {
+	case p.isSymbol("*"):
+		if op != ReduceCount {
+			return nil, p.errorf(p.peek(), "only COUNT takes *")
+		}
+		p.next()
+	case op == ReduceCount && p.acceptKeyword("DISTINCT"):
+		r.Op = ReduceCountDistinct
+		r.Col, err = p.name("a column")
+		if err != nil {
+			return nil, err
+		}
+	case op == ReduceCount:
+		return nil, p.errorf(p.peek(), "COUNT of a column is not supported, use COUNT(*) or COUNT(DISTINCT column)")
+	default:
+		r.Col, err = p.name("a column")
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = p.expectSymbol(")")
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Parses a column, alias or aggregate call
+func (p *sqlParser) outputRef() (sqlSelectItem, error) {
+	tok := p.peek()
+	item := sqlSelectItem{pos: tok.pos}
+	if tok.kind == sqlWord && p.tokens[p.i+1].kind == sqlSymbol && p.tokens[p.i+1].text == "(" {
+		r, err := p.aggregate()
+		if err != nil {
+			return item, err
+		}
+		item.Reducer = r
+		return item, nil
+	}
+	col, err := p.name("a column")
+	if err != nil {
+		return item, err
+	}
+	if p.isSymbol(".") {
+		return item, p.errorf(p.peek(), "qualified column names are not supported")
+	}
+	item.Col = col
+	return item, nil
+}
+
+// Parses an item of the select list, aggregates can be named with AS
+func (p *sqlParser) selectItem() (sqlSelectItem, error) {
+	item, err := p.outputRef()
+	if err != nil {
+		return item, err
+	}
+	aliasTok := p.peek()
+	hasAs := p.acceptKeyword("AS")
+	if hasAs || aliasTok.kind == sqlQuoted || (aliasTok.kind == sqlWord && !sqlKeywords[strings.ToUpper(aliasTok.text)]) {
+		if item.Reducer == nil {
+			return item, p.errorf(aliasTok, "aliases are only supported for aggregates")
+		}
+		item.Reducer.As, err = p.name("an alias")
+		if err != nil {
+			return item, err
+		}
+	}
+	return item, nil
+}
+
+// Parses a having condition, an output compared with a value
+func (p *sqlParser) havingCondition() (sqlCondition, error) {
+	ref, err := p.outputRef()
+	if err != nil {
+		return sqlCondition{}, err
+	}
+	cond := sqlCondition{Ref: ref}
+	op, ok := p.comparison()
+	if !ok {
+		return cond, p.unexpected("a comparison")
+	}
+	cond.Op = op
+	cond.Val, err = p.literal()
+	return cond, err
+}
+
+// Parses a comparison operator
+func (p *sqlParser) comparison() (FilterOp, bool) {
+	ops := map[string]FilterOp{
+		"=":  EqualTo,
+		"!=": NotEqualTo,
+		"<>": NotEqualTo,
+		"<":  LessThan,
+		"<=": LessThanOrEqual,
+		">":  GreaterThan,
+		">=": GreaterThanOrEqual,
+	}
+	tok := p.peek()
+	if tok.kind != sqlSymbol {
+		return 0, false
+	}
+	op, ok := ops[tok.text]
+	if ok {
+		p.next()
+	}
+	return op, ok
+}
+
+// Parses conditions joined by OR
+func (p *sqlParser) orExpr() (*FilterExpr, error) {
+	return p.joinedExpr("OR", p.andExpr)
+}
+
+// Parses conditions joined by AND
+func (p *sqlParser) andExpr() (*FilterExpr, error) {
+	return p.joinedExpr("AND", p.notExpr)
+}
+
+// Parses operands joined by the keyword, nested nodes of the same kind are flattened
+func (p *sqlParser) joinedExpr(kw string, operand func() (*FilterExpr, error)) (*FilterExpr, error) {
+	children := make([]FilterExpr, 0)
+	for {
+		e, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case kw == "AND" && e.And != nil:
+			children = append(children, e.And...)
+		case kw == "OR" && e.Or != nil:
+			children = append(children, e.Or...)
+		default:
+			children = append(children, *e)
+		}
+		if !p.acceptKeyword(kw) {
+			break
+		}
+	}
+	if len(children) == 1 {
+		return &children[0], nil
+	}
+	if kw == "AND" {
+		return &FilterExpr{And: children}, nil
+	}
+	return &FilterExpr{Or: children}, nil
+}
+
+// Parses a negated condition, a parenthesized expression or a predicate
+func (p *sqlParser) notExpr() (*FilterExpr, error) {
+	if p.acceptKeyword("NOT") {
+		e, err := p.notExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &FilterExpr{Not: e}, nil
+	}
+	if p.acceptSymbol("(") {
+		if p.isKeyword("SELECT") {
+			return nil, p.errorf(p.peek(), "subqueries are not supported")
+		}
+		e, err := p.orExpr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expectSymbol(")")
+	}
+	return p.predicate()
+}
+
+// Parses a condition on a column
+func (p *sqlParser) predicate() (*FilterExpr, error) {
+	tok := p.peek()
+	if tok.kind == sqlString || tok.kind == sqlNumber {
+		return nil, p.errorf(tok, "the column must be on the left of a condition")
+	}
+	if tok.kind == sqlWord && p.tokens[p.i+1].kind == sqlSymbol && p.tokens[p.i+1].text == "(" {
+		return nil, p.errorf(tok, "functions are not supported in WHERE")
+	}
+	col, err := p.name("a column")
+	if err != nil {
+		return nil, err
+	}
+	if p.isSymbol(".") {
+		return nil, p.errorf(p.peek(), "qualified column names are not supported")
+	}
+	leaf := func(f Filter) *FilterExpr {
+		f.Col = col
+		p.leaves = append(p.leaves, sqlLeaf{Filter: f, pos: tok.pos})
+		return &FilterExpr{Filter: f}
+	}
+
+	if op, ok := p.comparison(); ok {
+		val, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		return leaf(Filter{Op: op, Val: []string{val}}), nil
+	}
+
+	if p.acceptKeyword("IS") {
+		op := IsNull
+		if p.acceptKeyword("NOT") {
+			op = IsNotNull
+		}
+		err = p.expectKeyword("NULL")
+		if err != nil {
+			return nil, err
+		}
+		return leaf(Filter{Op: op}), nil
+	}
+
+	negated := p.acceptKeyword("NOT")
+	switch {
+	case p.acceptKeyword("IN"):
+		err = p.expectSymbol("(")
+		if err != nil {
+			return nil, err
+		}
+		if p.isKeyword("SELECT") {
+			return nil, p.errorf(p.peek(), "subqueries are not supported")
+		}
+		vals := make([]string, 0)
+		for {
+			val, err := p.literal()
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, val)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		err = p.expectSymbol(")")
+		if err != nil {
+			return nil, err
+		}
+		if negated {
+			return leaf(Filter{Op: NotEqualTo, Val: vals}), nil
+		}
+		return leaf(Filter{Op: In, Val: vals}), nil
+	case p.acceptKeyword("BETWEEN"):
+		lo, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		err = p.expectKeyword("AND")
+		if err != nil {
+			return nil, err
+		}
+		hi, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		e := leaf(Filter{Op: Between, Val: []string{lo, hi}})
+		if negated {
+			e = &FilterExpr{Not: e}
+		}
+		return e, nil
+	case p.isKeyword("LIKE"):
+		likeTok := p.next()
+		patTok := p.peek()
+		if patTok.kind != sqlString {
+			return nil, p.unexpected("a LIKE pattern")
+		}
+		p.next()
+		f, err := likeFilter(patTok.text)
+		if err != nil {
+			return nil, p.errorf(likeTok, "%s", err)
+		}
+		e := leaf(f)
+		if negated {
+			e = &FilterExpr{Not: e}
+		}
+		return e, nil
+	}
+	if negated {
+		return nil, p.unexpected("IN, BETWEEN or LIKE")
+	}
+	return nil, p.unexpected("a comparison, IN, BETWEEN, LIKE or IS")
+}
+
+// Returns the filter of a LIKE pattern, only 'prefix%', '%contains%' and patterns without wildcards are supported
+func likeFilter(pattern string) (Filter, error) {
+	if strings.Contains(pattern, "_") {
+		return Filter{}, fmt.Errorf("the _ wildcard of LIKE is not supported")
+	}
+	inner := strings.Trim(pattern, "%")
+	if strings.Contains(inner, "%") {
+		return Filter{}, fmt.Errorf("LIKE only supports 'prefix%%' and '%%contains%%' patterns")
+	}
+	starts, ends := strings.HasPrefix(pattern, "%"), strings.HasSuffix(pattern, "%")
+	switch {
+	case inner == "" && (starts || ends):
+		return Filter{Op: IsNotNull}, nil
+	case starts && ends:
+		return Filter{Op: Contains, Val: []string{inner}}, nil
+	case ends:
+		return Filter{Op: StartsWith, Val: []string{inner}}, nil
+	case starts:
+		return Filter{}, fmt.Errorf("LIKE only supports 'prefix%%' and '%%contains%%' patterns")
+	}
+	return Filter{Op: EqualTo, Val: []string{pattern}}, nil
+}
+
+// Validates the columns of the statement against the schema
+// Errors point at the column they are about, the compiled query or aggregation is validated again when it runs
+func (stmt *sqlStatement) validate(schema *Schema) error {
+	for _, leaf := range stmt.leaves {
+		err := schema.validateFilters([]Filter{leaf.Filter})
+		if err != nil {
+			return &SQLError{Pos: leaf.pos, Reason: err.Error()}
+		}
+		col, _ := schema.getColumn(leaf.Filter.Col)
+		if leaf.Filter.Op == EqualTo && !col.Filterable {
+			return &SQLError{Pos: leaf.pos, Reason: fmt.Sprintf("can't compare non-filterable column %s", col.Name)}
+		}
+	}
+	for _, item := range stmt.Items {
+		col := item.Col
+		if item.Reducer != nil {
+			col = item.Reducer.Col
+		}
+		if col == "" {
+			continue
+		}
+		_, err := schema.getColumn(col)
+		if err != nil {
+			return &SQLError{Pos: item.pos, Reason: err.Error()}
+		}
+	}
+	for i, col := range stmt.GroupBy {
+		_, err := schema.getColumn(col)
+		if err != nil {
+			return &SQLError{Pos: stmt.groupPos[i], Reason: err.Error()}
+		}
+	}
+	if stmt.isAggregate() {
+		return nil
+	}
+	for _, o := range stmt.OrderBy {
+		err := schema.validateOrderBy([]OrderBy{{Col: o.Ref.Col, Order: o.Order}})
+		if err != nil {
+			return &SQLError{Pos: o.Ref.pos, Reason: err.Error()}
+		}
+	}
+	return nil
+}
+
+// Returns the condition matching the records where expr is true in sql's three-valued logic
+// A comparison with null is neither true nor false, the filter sets of a comparison already leave nulls out
+// but the not of a data query subtracts from every record, so negations are rewritten by falseExpr
+func excludeNulls(expr *FilterExpr, schema *Schema) *FilterExpr {
+	if expr == nil {
+		return nil
+	}
+	switch {
+	case expr.Not != nil:
+		return falseExpr(expr.Not, schema)
+	case expr.And != nil:
+		return &FilterExpr{And: mapExprs(expr.And, schema, excludeNulls)}
+	case expr.Or != nil:
+		return &FilterExpr{Or: mapExprs(expr.Or, schema, excludeNulls)}
+	}
+	return expr
+}
+
+// Returns the condition matching the records where expr is false, and not unknown because of a null
+// An and is false when any of its conditions is, an or when all of them are
+func falseExpr(expr *FilterExpr, schema *Schema) *FilterExpr {
+	switch {
+	case expr.Not != nil:
+		return excludeNulls(expr.Not, schema)
+	case expr.And != nil:
+		return &FilterExpr{Or: mapExprs(expr.And, schema, falseExpr)}
+	case expr.Or != nil:
+		return &FilterExpr{And: mapExprs(expr.Or, schema, falseExpr)}
+	}
+	not := &FilterExpr{Not: expr}
+	if expr.Op == IsNull || expr.Op == IsNotNull {
+		return not
+	}
+	// columns in conditions are filterable, so their nulls are in the null set
+	col, err := schema.getColumn(expr.Col)
+	if err != nil || !col.Filterable || !col.Nullable {
+		return not
+	}
+	return &FilterExpr{And: []FilterExpr{*not, {Filter: Filter{Col: expr.Col, Op: IsNotNull}}}}
+}
+
+// Applies fn to each of the conditions
+func mapExprs(exprs []FilterExpr, schema *Schema, fn func(*FilterExpr, *Schema) *FilterExpr) []FilterExpr {
+	mapped := make([]FilterExpr, 0, len(exprs))
+	for i := range exprs {
+		mapped = append(mapped, *fn(&exprs[i], schema))
+	}
+	return mapped
+}
+
+// Returns true if the statement groups or selects aggregates
+func (stmt *sqlStatement) isAggregate() bool {
+	if len(stmt.GroupBy) > 0 {
+		return true
+	}
+	for _, item := range stmt.Items {
+		if item.Reducer != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the limit of the query or aggregation, where 0 is no limit
+func (stmt *sqlStatement) limit() int {
+	if stmt.Limit < 0 {
+		return 0
+	}
+	return stmt.Limit
+}
+
+// Returns the data query of a statement without aggregates
+func (stmt *sqlStatement) query() (Query, error) {
+	query := Query{Where: stmt.Where, Limit: stmt.limit(), Offset: stmt.Offset}
+	if len(stmt.Having) > 0 {
+		return query, &SQLError{Pos: stmt.Having[0].Ref.pos, Reason: "HAVING needs GROUP BY or aggregates"}
+	}
+	for _, item := range stmt.Items {
+		query.Columns = append(query.Columns, item.Col)
+	}
+	for _, o := range stmt.OrderBy {
+		if o.Ref.Reducer != nil {
+			return query, &SQLError{Pos: o.Ref.pos, Reason: "ordering by an aggregate needs GROUP BY or aggregates"}
+		}
+		query.OrderBy = append(query.OrderBy, OrderBy{Col: o.Ref.Col, Order: o.Order})
+	}
+	return query, nil
+}
+
+// Returns the aggregation request of a statement with GROUP BY or aggregates
+// Selected columns must be grouped by, having and order by refer to the grouped columns,
+// the aggregate aliases or aggregates of the select list
+func (stmt *sqlStatement) aggRequest() (AggRequest, error) {
+	aggReq := AggRequest{Groupby: stmt.GroupBy, Limit: stmt.limit(), Offset: stmt.Offset}
+	if stmt.Where != nil {
+		aggReq.Query = &Query{Where: stmt.Where}
+	}
+	if stmt.Star {
+		return aggReq, &SQLError{Pos: stmt.tablePos, Reason: "SELECT * can't be used with GROUP BY or aggregates"}
+	}
+
+	grouped := make(map[string]bool, len(stmt.GroupBy))
+	for _, g := range stmt.GroupBy {
+		grouped[g] = true
+	}
+	for _, item := range stmt.Items {
+		if item.Reducer == nil {
+			if !grouped[item.Col] {
+				return aggReq, &SQLError{Pos: item.pos, Reason: fmt.Sprintf("column %s must be in GROUP BY or in an aggregate", item.Col)}
+			}
+			continue
+		}
+		aggReq.Reducers = append(aggReq.Reducers, *item.Reducer)
+	}
+	if len(aggReq.Reducers) == 0 {
+		return aggReq, &SQLError{Pos: stmt.tablePos, Reason: "GROUP BY needs at least one aggregate"}
+	}
+
+	// the output an order by or having refers to
+	output := func(ref sqlSelectItem) (string, error) {
+		if ref.Reducer == nil {
+			return ref.Col, nil
+		}
+		for _, r := range aggReq.Reducers {
+			if r.Op == ref.Reducer.Op && r.Col == ref.Reducer.Col {
+				return r.name(), nil
+			}
+		}
+		return "", &SQLError{Pos: ref.pos, Reason: "aggregates in HAVING and ORDER BY must be selected"}
+	}
+	for _, h := range stmt.Having {
+		name, err := output(h.Ref)
+		if err != nil {
+			return aggReq, err
+		}
+		aggReq.Having = append(aggReq.Having, Filter{Col: name, Op: h.Op, Val: []string{h.Val}})
+	}
+	for _, o := range stmt.OrderBy {
+		name, err := output(o.Ref)
+		if err != nil {
+			return aggReq, err
+		}
+		aggReq.OrderBy = append(aggReq.OrderBy, OrderBy{Col: name, Order: o.Order})
+	}
+	return aggReq, nil
+}
+
+// Runs a SELECT statement
+// Statements without aggregates are data queries, the others are aggregations returned as records,
+// their result set only has a count
+func (db *Database) QuerySQL(sql string) (*GetDataResponse, error) {
+	stmt, err := parseSQL(sql)
+	if err != nil {
+		return nil, err
+	}
+	table, err := db.getTable(stmt.Table)
+	if err == ErrNil {
+		return nil, &SQLError{Pos: stmt.tablePos, Reason: fmt.Sprintf("table %s not found", stmt.Table)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = stmt.validate(&table.Schema)
+	if err != nil {
+		return nil, err
+	}
+	stmt.Where = excludeNulls(stmt.Where, &table.Schema)
+
+	if !stmt.isAggregate() {
+		query, err := stmt.query()
+		if err != nil {
+			return nil, err
+		}
+		err = table.Schema.validateQuery(query)
+		if err != nil {
+			// what isn't about a single column, like a column selected twice
+			return nil, &SQLError{Pos: stmt.tablePos, Reason: err.Error()}
+		}
+		if stmt.Limit == 0 {
+			resp := &GetDataResponse{Records: make([]map[string]any, 0)}
+			resp.Metadata.ResultSet = ResultSet{Offset: query.Offset}
+			return resp, nil
+		}
+		resp, err := db.GetData(stmt.Table, query)
+		if err == ErrNil {
+			// a filter matched no records
+			resp = &GetDataResponse{Records: make([]map[string]any, 0)}
+			resp.Metadata.ResultSet = ResultSet{Offset: query.Offset, Limit: query.Limit}
+			return resp, nil
+		}
+		return resp, err
+	}
+
+	aggReq, err := stmt.aggRequest()
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]map[string]string, 0)
+	if stmt.Limit == 0 {
+		err = table.Schema.validateAggRequest(&aggReq)
+	} else {
+		rows, err = db.AggregateData(stmt.Table, aggReq)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp := GetDataResponse{Records: make([]map[string]any, 0, len(rows))}
+	for _, row := range rows {
+		record := make(map[string]any, len(row))
+		for k, v := range row {
+			record[k] = v
+		}
+		resp.Records = append(resp.Records, record)
+	}
+	resp.Metadata.ResultSet = ResultSet{Count: len(rows), Offset: aggReq.Offset, Limit: aggReq.Limit}
+	return &resp, nil
+}
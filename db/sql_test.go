@@ -0,0 +1,203 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseSQL(t *testing.T) {
+	stmt, err := parseSQL(`select region, "rep" FROM sales WHERE (amount >= 5 AND NOT rep LIKE 'a%') OR region IN ('EMEA', 'it''s') ` +
+		`ORDER BY amount DESC, rep LIMIT 10 OFFSET 2;`)
+	if err != nil {
+		t.Fatalf("Failed parsing sql %s\n", err)
+	}
+	where := &FilterExpr{Or: []FilterExpr{
+		{And: []FilterExpr{
+			{Filter: Filter{Col: "amount", Op: GreaterThanOrEqual, Val: []string{"5"}}},
+			{Not: &FilterExpr{Filter: Filter{Col: "rep", Op: StartsWith, Val: []string{"a"}}}},
+		}},
+		{Filter: Filter{Col: "region", Op: In, Val: []string{"EMEA", "it's"}}},
+	}}
+	query, err := stmt.query()
+	if err != nil {
+		t.Fatalf("Failed compiling sql %s\n", err)
+	}
+	expected := Query{
+		Columns: []string{"region", "rep"},
+		Where:   where,
+		OrderBy: []OrderBy{{Col: "amount", Order: "desc"}, {Col: "rep"}},
+		Limit:   10,
+		Offset:  2,
+	}
+	if stmt.Table != "sales" || !reflect.DeepEqual(query, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, query)
+	}
+
+	stmt, err = parseSQL("SELECT region, COUNT(*) n, SUM(amount) AS total, COUNT(DISTINCT rep) FROM sales " +
+		"WHERE region IS NOT NULL AND amount NOT BETWEEN 1 AND 2 GROUP BY region HAVING n > 1 AND SUM(amount) < 100 ORDER BY COUNT(DISTINCT rep) DESC LIMIT 5")
+	if err != nil {
+		t.Fatalf("Failed parsing sql %s\n", err)
+	}
+	aggReq, err := stmt.aggRequest()
+	if err != nil {
+		t.Fatalf("Failed compiling sql %s\n", err)
+	}
+	expectedAgg := AggRequest{
+		Groupby:  []string{"region"},
+		Reducers: []Reducer{{Op: ReduceCount, As: "n"}, {Op: ReduceSum, Col: "amount", As: "total"}, {Op: ReduceCountDistinct, Col: "rep"}},
+		Query: &Query{Where: &FilterExpr{And: []FilterExpr{
+			{Filter: Filter{Col: "region", Op: IsNotNull}},
+			{Not: &FilterExpr{Filter: Filter{Col: "amount", Op: Between, Val: []string{"1", "2"}}}},
+		}}},
+		Having:  []Filter{{Col: "n", Op: GreaterThan, Val: []string{"1"}}, {Col: "total", Op: LessThan, Val: []string{"100"}}},
+		OrderBy: []OrderBy{{Col: "count_distinct_rep", Order: "desc"}},
+		Limit:   5,
+	}
+	if !reflect.DeepEqual(aggReq, expectedAgg) {
+		t.Fatalf("Expected %+v, got %+v", expectedAgg, aggReq)
+	}
+
+	// errors point at the offending token
+	invalid := map[string]int{
+		"DELETE FROM sales":                                             1,
+		"SELECT * FROM sales WHERE rep = 'ann":                          33,
+		"SELECT * FROM sales JOIN reps ON rep = name":                   21,
+		"SELECT * FROM sales, reps":                                     20,
+		"SELECT * FROM (SELECT * FROM sales)":                           15,
+		"SELECT * FROM sales WHERE amount > (SELECT 1)":                 36,
+		"SELECT * FROM sales WHERE 5 < amount":                          27,
+		"SELECT * FROM sales WHERE amount = rep":                        36,
+		"SELECT * FROM sales WHERE rep = NULL":                          33,
+		"SELECT * FROM sales WHERE rep LIKE '_nn'":                      31,
+		"SELECT * FROM sales WHERE rep LIKE '%nn'":                      31,
+		"SELECT * FROM sales WHERE lower(rep) = 'ann'":                  27,
+		"SELECT * FROM sales WHERE s.rep = 'ann'":                       28,
+		"SELECT COUNT(rep) FROM sales":                                  14,
+		"SELECT MEDIAN(amount) FROM sales":                              8,
+		"SELECT rep AS r FROM sales":                                    12,
+		"SELECT DISTINCT rep FROM sales":                                8,
+		"SELECT * FROM order":                                           15,
+		"SELECT * FROM sales LIMIT -1":                                  27,
+		"SELECT * FROM sales LIMIT 10 UNION SELECT * FROM s2":           30,
+		"SELECT * FROM sales WHERE amount > 1 HAVING COUNT(*) > 1 OR 1": 58,
+		"SELECT * FROM sales WHERE rep ~ 'ann'":                         31,
+		"SELECT * FROM sales WHERE":                                     26,
+	}
+	for sql, pos := range invalid {
+		_, err := parseSQL(sql)
+		var sqlErr *SQLError
+		if !errors.As(err, &sqlErr) || sqlErr.Pos != pos {
+			t.Fatalf("Expected an error at position %d for %s, got %v", pos, sql, err)
+		}
+	}
+}
+
+func TestQuerySQL(t *testing.T) {
+	mr := newMiniRedis(t)
+	loadNativeAggTestData(t, mr)
+
+	data, err := mr.QuerySQL("SELECT rep, amount FROM sales WHERE region = 'AMER' AND amount > 5 OR region LIKE 'E%' ORDER BY amount DESC")
+	if err != nil {
+		t.Fatalf("Failed querying sql %s\n", err)
+	}
+	expected := []map[string]any{{"rep": "bob", "amount": "30"}, {"rep": "ann", "amount": "20"}, {"rep": "ann", "amount": "10"}}
+	if !reflect.DeepEqual(data.Records, expected) || data.Metadata.ResultSet.Total != 3 {
+		t.Fatalf("Expected %v, got %v %+v", expected, data.Records, data.Metadata)
+	}
+
+	// no matching records
+	data, err = mr.QuerySQL("SELECT * FROM sales WHERE region IN ('APAC')")
+	if err != nil || len(data.Records) != 0 {
+		t.Fatalf("Expected no records, got %v %v", data, err)
+	}
+
+	data, err = mr.QuerySQL("SELECT region, COUNT(*), SUM(amount) AS total FROM sales WHERE region IS NOT NULL GROUP BY region ORDER BY total DESC LIMIT 1")
+	if err != nil {
+		t.Fatalf("Failed querying sql %s\n", err)
+	}
+	expected = []map[string]any{{"region": "EMEA", "count": "2", "total": "40"}}
+	if !reflect.DeepEqual(data.Records, expected) || data.Metadata.ResultSet.Count != 1 {
+		t.Fatalf("Expected %v, got %v %+v", expected, data.Records, data.Metadata)
+	}
+
+	data, err = mr.QuerySQL("SELECT MAX(amount) FROM sales WHERE region = 'AMER'")
+	if err != nil {
+		t.Fatalf("Failed querying sql %s\n", err)
+	}
+	expected = []map[string]any{{"max_amount": "20"}}
+	if !reflect.DeepEqual(data.Records, expected) {
+		t.Fatalf("Expected %v, got %v", expected, data.Records)
+	}
+
+	// LIMIT 0 returns no rows
+	for _, sql := range []string{"SELECT * FROM sales LIMIT 0", "SELECT region, COUNT(*) FROM sales GROUP BY region LIMIT 0"} {
+		data, err = mr.QuerySQL(sql)
+		if err != nil || len(data.Records) != 0 {
+			t.Fatalf("Expected no records for %s, got %v %v", sql, data, err)
+		}
+	}
+
+	// negated conditions leave out null values like in sql
+	data, err = mr.QuerySQL("SELECT rep FROM sales WHERE NOT (region = 'EMEA') ORDER BY amount")
+	if err != nil {
+		t.Fatalf("Failed querying sql %s\n", err)
+	}
+	expected = []map[string]any{{"rep": "ann"}, {"rep": "cid"}, {"rep": "ann"}}
+	if !reflect.DeepEqual(data.Records, expected) {
+		t.Fatalf("Expected %v, got %v", expected, data.Records)
+	}
+	for _, sql := range []string{
+		"SELECT rep FROM sales WHERE NOT (region = 'EMEA' OR amount > 30) ORDER BY amount",
+		"SELECT rep FROM sales WHERE NOT (region = 'EMEA' AND amount >= 1) ORDER BY amount",
+		"SELECT rep FROM sales WHERE NOT NOT NOT (region = 'EMEA') ORDER BY amount",
+	} {
+		data, err = mr.QuerySQL(sql)
+		if err != nil || !reflect.DeepEqual(data.Records, expected) {
+			t.Fatalf("Expected %v for %s, got %v %v", expected, sql, data, err)
+		}
+	}
+
+	// columns the query can't use point at their token
+	positions := map[string]int{
+		"SELECT * FROM sales WHERE rep = 'ann'":                27,
+		"SELECT * FROM sales WHERE amount > 1 OR region > 'A'": 41,
+		"SELECT * FROM sales ORDER BY region":                  30,
+		"SELECT missing FROM sales":                            8,
+		"SELECT region, COUNT(*) FROM sales GROUP BY missing":  45,
+	}
+	for sql, pos := range positions {
+		_, err := mr.QuerySQL(sql)
+		var sqlErr *SQLError
+		if !errors.As(err, &sqlErr) || sqlErr.Pos != pos {
+			t.Fatalf("Expected an error at position %d for %s, got %v", pos, sql, err)
+		}
+	}
+
+	invalid := []string{
+		"SELECT * FROM missing",
+		"SELECT rep, COUNT(*) FROM sales GROUP BY region",
+		"SELECT * FROM sales GROUP BY region",
+		"SELECT region FROM sales GROUP BY region",
+		"SELECT rep FROM sales HAVING COUNT(*) > 1",
+		"SELECT COUNT(*) FROM sales ORDER BY SUM(amount)",
+	}
+	for _, sql := range invalid {
+		_, err := mr.QuerySQL(sql)
+		var sqlErr *SQLError
+		if !errors.As(err, &sqlErr) {
+			t.Fatalf("Expected a sql error for %s, got %v", sql, err)
+		}
+	}
+	// statements that parse are validated like queries and aggregations
+	for _, sql := range []string{"SELECT SUM(rep) FROM sales", `SELECT SUM(amount) AS "total revenue" FROM sales`} {
+		_, err = mr.QuerySQL(sql)
+		var aggErr *AggregationError
+		if !errors.As(err, &aggErr) {
+			t.Fatalf("Expected an aggregation error for %s, got %v", sql, err)
+		}
+	}
+}
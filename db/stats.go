@@ -0,0 +1,210 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Buckets of a histogram when none are given
+	DefaultHistogramBuckets = 10
+
+	// Most buckets a histogram can have
+	MaxHistogramBuckets = 1000
+)
+
+// Records with a value of the column from Min up to Max, Max is inclusive for the last bucket only
+type HistogramBucket struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int64   `json:"count"`
+}
+
+// The distribution of a sortable numeric column
+// Count is the number of records with a value and Nulls the number without,
+// the other stats are left out when no record has a value
+type NumericStats struct {
+	Col       string            `json:"col"`
+	Count     int64             `json:"count"`
+	Nulls     int64             `json:"nulls"`
+	Min       *float64          `json:"min,omitempty"`
+	Max       *float64          `json:"max,omitempty"`
+	Mean      *float64          `json:"mean,omitempty"`
+	P50       *float64          `json:"p50,omitempty"`
+	P90       *float64          `json:"p90,omitempty"`
+	P99       *float64          `json:"p99,omitempty"`
+	Histogram []HistogramBucket `json:"histogram"`
+}
+
+// Returns the stats of a sortable numeric column over the records of the query, with a histogram of equal width buckets
+// The column's order set is scored by value so min, max and percentiles are read by rank and the histogram
+// is counted by score, only the mean reads every value
+func (db *Database) GetNumericStats(tableName string, colName string, query Query, buckets int) (*NumericStats, error) {
+	table, err := db.getTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+	col, err := table.Schema.getColumn(colName)
+	if err != nil {
+		return nil, err
+	}
+	if !col.Sortable || !numericDataType(col.DataType) {
+		return nil, errors.New(fmt.Sprintf("can't get stats of column %s, it must be sortable and numeric", colName))
+	}
+	if buckets == 0 {
+		buckets = DefaultHistogramBuckets
+	}
+	if buckets < 1 || buckets > MaxHistogramBuckets {
+		return nil, errors.New(fmt.Sprintf("buckets must be between 1 and %d", MaxHistogramBuckets))
+	}
+	err = table.Schema.validateQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := NumericStats{Col: colName, Histogram: make([]HistogramBucket, 0)}
+	plans, err := db.planJoins(table, query.Joins, query.Columns)
+	if err != nil {
+		return nil, err
+	}
+	err = db.restrictJoins(table, &query, plans)
+	if err == ErrNil {
+		// no dimension record matches an inner join
+		return &stats, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	valsKey := table.formatOrderKey(colName)
+	nullsKey := table.formatNullKey(colName)
+	if len(query.Filters) > 0 || query.Where != nil || query.search() != nil || len(query.joinSets) > 0 {
+		key, err := db.getQueryKey(table, query)
+		if err == ErrNil {
+			// a filter matched no records
+			return &stats, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		t := time.Now().String()
+		valsKey = table.formatStatsStoreKey(colName, "vals", t)
+		nullsKey = table.formatStatsStoreKey(colName, "nulls", t)
+		pipe := db.Client.Pipeline()
+		pipe.ZInterStore(Ctx, valsKey, &redis.ZStore{Keys: []string{key, table.formatOrderKey(colName)}, Weights: []float64{0, 1}})
+		pipe.ZInterStore(Ctx, nullsKey, &redis.ZStore{Keys: []string{key, table.formatNullKey(colName)}})
+		pipe.Expire(Ctx, valsKey, TempKeyTTL)
+		pipe.Expire(Ctx, nullsKey, TempKeyTTL)
+		_, err = pipe.Exec(Ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer db.deleteTempKeys(valsKey, nullsKey)
+	}
+
+	pipe := db.Client.Pipeline()
+	count := pipe.ZCard(Ctx, valsKey)
+	var nulls *redis.IntCmd
+	if nullsKey == table.formatNullKey(colName) {
+		nulls = pipe.SCard(Ctx, nullsKey)
+	} else {
+		nulls = pipe.ZCard(Ctx, nullsKey)
+	}
+	_, err = pipe.Exec(Ctx)
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	stats.Count, stats.Nulls = count.Val(), nulls.Val()
+	if stats.Count == 0 {
+		return &stats, nil
+	}
+
+	// min, max and nearest rank percentiles
+	ranks := []int64{0, stats.Count - 1, percentileRank(0.5, stats.Count), percentileRank(0.9, stats.Count), percentileRank(0.99, stats.Count)}
+	pipe = db.Client.Pipeline()
+	cmds := make([]*redis.ZSliceCmd, len(ranks))
+	for i, r := range ranks {
+		cmds[i] = pipe.ZRangeWithScores(Ctx, valsKey, r, r)
+	}
+	_, err = pipe.Exec(Ctx)
+	if err != nil {
+		return nil, err
+	}
+	scores := make([]*float64, len(ranks))
+	for i, cmd := range cmds {
+		if z := cmd.Val(); len(z) > 0 {
+			scores[i] = &z[0].Score
+		}
+	}
+	stats.Min, stats.Max, stats.P50, stats.P90, stats.P99 = scores[0], scores[1], scores[2], scores[3], scores[4]
+	if stats.Min == nil || stats.Max == nil {
+		return &stats, nil
+	}
+
+	sum := 0.0
+	for start := int64(0); start < stats.Count; start += ScanCount {
+		z, err := db.Client.ZRangeWithScores(Ctx, valsKey, start, start+ScanCount-1).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range z {
+			sum += v.Score
+		}
+	}
+	mean := sum / float64(stats.Count)
+	stats.Mean = &mean
+
+	stats.Histogram, err = db.getHistogram(valsKey, *stats.Min, *stats.Max, buckets)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// Returns the 0 based rank of the nearest rank percentile p of n values
+func percentileRank(p float64, n int64) int64 {
+	rank := int64(math.Ceil(p*float64(n))) - 1
+	if rank < 0 {
+		return 0
+	}
+	return rank
+}
+
+// Counts the members of the sorted set in equal width buckets between min and max
+// All values are in a single bucket when min equals max
+func (db *Database) getHistogram(key string, min float64, max float64, buckets int) ([]HistogramBucket, error) {
+	if min == max {
+		buckets = 1
+	}
+	width := (max - min) / float64(buckets)
+	format := func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+	histogram := make([]HistogramBucket, buckets)
+	cmds := make([]*redis.IntCmd, buckets)
+	pipe := db.Client.Pipeline()
+	for i := range histogram {
+		lo := min + float64(i)*width
+		hi := min + float64(i+1)*width
+		rangeMax := "(" + format(hi)
+		if i == buckets-1 {
+			hi = max
+			rangeMax = format(hi)
+		}
+		histogram[i] = HistogramBucket{Min: lo, Max: hi}
+		cmds[i] = pipe.ZCount(Ctx, key, format(lo), rangeMax)
+	}
+	_, err := pipe.Exec(Ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, cmd := range cmds {
+		histogram[i].Count = cmd.Val()
+	}
+	return histogram, nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetNumericStats(t *testing.T) {
+	mr := newMiniRedis(t)
+	schema := Schema{
+		Name: "sales",
+		Columns: []Column{
+			{Name: "region", DataType: "string", Filterable: true},
+			{Name: "amount", DataType: "float", Filterable: true, Sortable: true, Nullable: true},
+			{Name: "rep", DataType: "string", Filterable: true, Sortable: true},
+		},
+	}
+	err := mr.AddSchema(&schema)
+	if err != nil {
+		t.Fatalf("Failed adding schema %s\n", err)
+	}
+	csv := "region,amount,rep\nEMEA,1,ann\nEMEA,3,bob\nAMER,3,ann\nAMER,9,cid\nAMER,,dan\n"
+	err = mr.BulkLoad("sales", strings.NewReader(csv), "csv")
+	if err != nil {
+		t.Fatalf("Failed loading data %s\n", err)
+	}
+
+	stats, err := mr.GetNumericStats("sales", "amount", Query{}, 2)
+	if err != nil {
+		t.Fatalf("Failed getting stats %s\n", err)
+	}
+	f := func(v float64) *float64 { return &v }
+	expected := &NumericStats{
+		Col: "amount", Count: 4, Nulls: 1,
+		Min: f(1), Max: f(9), Mean: f(4), P50: f(3), P90: f(9), P99: f(9),
+		Histogram: []HistogramBucket{{Min: 1, Max: 5, Count: 3}, {Min: 5, Max: 9, Count: 1}},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, stats)
+	}
+
+	// only the records of the query
+	query := Query{Filters: []Filter{{Col: "region", Op: EqualTo, Val: []string{"AMER"}}}}
+	stats, err = mr.GetNumericStats("sales", "amount", query, 0)
+	if err != nil {
+		t.Fatalf("Failed getting stats %s\n", err)
+	}
+	if stats.Count != 2 || stats.Nulls != 1 || *stats.Min != 3 || *stats.Max != 9 || *stats.Mean != 6 || *stats.P50 != 3 {
+		t.Fatalf("Expected stats of AMER, got %+v", stats)
+	}
+	if len(stats.Histogram) != DefaultHistogramBuckets || stats.Histogram[0].Count != 1 || stats.Histogram[DefaultHistogramBuckets-1].Count != 1 {
+		t.Fatalf("Expected %d buckets, got %+v", DefaultHistogramBuckets, stats.Histogram)
+	}
+	keys, err := mr.Client.Keys(Ctx, "*statsstore*").Result()
+	if err != nil || len(keys) != 0 {
+		t.Fatalf("Expected stats keys to be deleted, got %v %v", keys, err)
+	}
+
+	// a single value is a single bucket
+	query = Query{Filters: []Filter{{Col: "rep", Op: EqualTo, Val: []string{"ann"}}, {Col: "region", Op: EqualTo, Val: []string{"EMEA"}}}}
+	stats, err = mr.GetNumericStats("sales", "amount", query, 5)
+	if err != nil {
+		t.Fatalf("Failed getting stats %s\n", err)
+	}
+	if !reflect.DeepEqual(stats.Histogram, []HistogramBucket{{Min: 1, Max: 1, Count: 1}}) {
+		t.Fatalf("Expected a single bucket, got %+v", stats.Histogram)
+	}
+
+	// no values
+	query = Query{Filters: []Filter{{Col: "rep", Op: EqualTo, Val: []string{"dan"}}}}
+	stats, err = mr.GetNumericStats("sales", "amount", query, 0)
+	if err != nil {
+		t.Fatalf("Failed getting stats %s\n", err)
+	}
+	if stats.Count != 0 || stats.Nulls != 1 || stats.Min != nil || stats.Mean != nil || len(stats.Histogram) != 0 {
+		t.Fatalf("Expected no stats, got %+v", stats)
+	}
+
+	for _, col := range []string{"region", "rep", "missing"} {
+		_, err = mr.GetNumericStats("sales", col, Query{}, 0)
+		if err == nil {
+			t.Fatalf("Expected an error for column %s", col)
+		}
+	}
+	_, err = mr.GetNumericStats("sales", "amount", Query{}, MaxHistogramBuckets+1)
+	if err == nil {
+		t.Fatalf("Expected an error for too many buckets")
+	}
+}
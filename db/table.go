@@ -9,11 +9,16 @@ type Table struct {
 	Name    string
 }
 
+// Returns the table for name, aliases are resolved to the table they point to
 func (db *Database) getTable(name string) (Table, error) {
+	name, err := db.resolveTableName(name)
+	if err != nil {
+		return Table{Name: name}, err
+	}
 	table := Table{Name: name}
 
 	// Get table schema
-	schema, err := db.GetSchema(name)
+	schema, err := db.getSchemaByKey(formatSchemaKey(name))
 	if err != nil {
 		return table, err
 	}
@@ -26,6 +31,14 @@ func (db *Database) getTable(name string) (Table, error) {
 	}
 	version := load.Version
 
+	// reads stay on the last successful load while a load runs or after it fails
+	current, err := db.getCurrentVersion(table)
+	if err == nil {
+		version = current
+	} else if err != ErrNil {
+		return table, err
+	}
+
 	return Table{
 		Schema:  *schema,
 		Version: version,
@@ -0,0 +1,132 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// How long the temporary keys of a query are kept, long enough for the query to page through them
+	TempKeyTTL = time.Minute
+)
+
+// Kinds of temporary keys created by queries, the kind follows the table version in the key
+// {Prefix}:{table}:{version}:{kind}:...
+var tempKeyKinds = []string{"unionstore", "exprstore", "interstore", "orderstore", "searchstore", "facetstore", "statsstore", "joinstore"}
+
+// Sets the TTL of temporary keys so they expire even if the query never cleans them up
+func (db *Database) expireTempKeys(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	pipe := db.Client.Pipeline()
+	for _, k := range keys {
+		pipe.Expire(Ctx, k, TempKeyTTL)
+	}
+	_, err := pipe.Exec(Ctx)
+	return err
+}
+
+// Deletes temporary keys once a query no longer needs them
+func (db *Database) deleteTempKeys(keys ...string) error {
+	for _, chunk := range chunkKeys(keys) {
+		err := db.Client.Del(Ctx, chunk...).Err()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns true if the key looks like a temporary key of a table that is not one of its column's keys
+// A column may share its name with a kind, e.g. {Prefix}:{table}:{version}:unionstore:{val} is a filter set,
+// such keys are never swept and are left to expire
+func isTempKey(key string, schemas map[string]*Schema) bool {
+	parts := strings.SplitN(strings.TrimPrefix(key, Prefix+":"), ":", 4)
+	if len(parts) < 4 {
+		return false
+	}
+	found := false
+	for _, kind := range tempKeyKinds {
+		if parts[2] == kind {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false
+	}
+	schema, ok := schemas[parts[0]]
+	if !ok {
+		return true
+	}
+	_, err := schema.getColumn(parts[2])
+	return err != nil
+}
+
+// Deletes temporary keys left without a TTL, like the ones leaked by queries before they expired them
+// Returns the number of deleted keys
+func (db *Database) SweepTempKeys() (int64, error) {
+	schemas := make(map[string]*Schema)
+	all, err := db.GetAllSchemas()
+	if err != nil {
+		return 0, err
+	}
+	for i := range *all {
+		schemas[(*all)[i].Name] = &(*all)[i]
+	}
+
+	var deleted int64
+	var cursor uint64
+	for {
+		keys, next, err := db.Client.Scan(Ctx, cursor, fmt.Sprintf("%s:*", Prefix), ScanCount).Result()
+		if err != nil {
+			return deleted, err
+		}
+
+		candidates := make([]string, 0)
+		for _, k := range keys {
+			if isTempKey(k, schemas) {
+				candidates = append(candidates, k)
+			}
+		}
+
+		// keys with a TTL expire on their own and may still be in use
+		pipe := db.Client.Pipeline()
+		cmds := make([]*redis.DurationCmd, 0, len(candidates))
+		for _, k := range candidates {
+			cmds = append(cmds, pipe.TTL(Ctx, k))
+		}
+		if len(cmds) > 0 {
+			_, err = pipe.Exec(Ctx)
+			if err != nil {
+				return deleted, err
+			}
+		}
+		leaked := make([]string, 0, len(candidates))
+		for i, cmd := range cmds {
+			if cmd.Val() == -1 {
+				leaked = append(leaked, candidates[i])
+			}
+		}
+		if len(leaked) > 0 {
+			n, err := db.Client.Del(Ctx, leaked...).Result()
+			if err != nil {
+				return deleted, err
+			}
+			deleted += n
+		}
+
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+	return deleted, nil
+}
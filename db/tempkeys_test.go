@@ -0,0 +1,97 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTempKeys(t *testing.T) {
+	mr := newMiniRedis(t)
+
+	// a column named like a kind of temporary key
+	schema := Schema{
+		Name: "jobs",
+		Columns: []Column{
+			{Name: "unionstore", DataType: "string", Filterable: true},
+			{Name: "size", DataType: "int", Filterable: true, Sortable: true},
+		},
+	}
+	err := mr.AddSchema(&schema)
+	if err != nil {
+		t.Fatalf("Failed adding schema %s\n", err)
+	}
+	err = mr.BulkLoad("jobs", strings.NewReader("unionstore,size\na,1\nb,2\na,3\n"), "csv")
+	if err != nil {
+		t.Fatalf("Failed loading data %s\n", err)
+	}
+	table, err := mr.getTable("jobs")
+	if err != nil {
+		t.Fatalf("Failed getting table %s\n", err)
+	}
+	match := fmt.Sprintf("%s:*store:*", table.formatKeyPrefix())
+
+	query := Query{
+		Filters: []Filter{{Col: "unionstore", Op: EqualTo, Val: []string{"a"}}},
+		Where:   &FilterExpr{Or: []FilterExpr{{Filter: Filter{Col: "size", Op: GreaterThan, Val: []string{"2"}}}, {Filter: Filter{Col: "size", Op: EqualTo, Val: []string{"1"}}}}},
+		OrderBy: []OrderBy{{Col: "size"}},
+	}
+	data, err := mr.GetData("jobs", query)
+	if err != nil || len(data.Records) != 2 {
+		t.Fatalf("Expected 2 records, got %v %v", data, err)
+	}
+
+	// only the keys the query pages through are left, and they expire
+	matched, err := mr.Client.Keys(Ctx, match).Result()
+	if err != nil {
+		t.Fatalf("Failed listing keys %s\n", err)
+	}
+	keys := make([]string, 0, len(matched))
+	for _, k := range matched {
+		if k != table.formatFilterKey("unionstore", "a") && k != table.formatFilterKey("unionstore", "b") {
+			keys = append(keys, k)
+		}
+	}
+	// the final key is moved to the query cache
+	if len(keys) != 2 {
+		t.Fatalf("Expected ordered keys only, got %v", keys)
+	}
+	for _, k := range keys {
+		ttl, err := mr.Client.TTL(Ctx, k).Result()
+		if err != nil || ttl <= 0 {
+			t.Fatalf("Expected a ttl on %s, got %v %v", k, ttl, err)
+		}
+	}
+
+	// leaked keys without a ttl are swept, column keys are left alone
+	leaked := []string{
+		table.formatInterStoreKey([]string{"x"}, "old"),
+		table.formatExprStoreKey(1, "old"),
+		table.formatOrderStoreKey("size", "vals", "old"),
+	}
+	for _, k := range leaked {
+		mr.Client.SAdd(Ctx, k, "member")
+	}
+	ambiguous := table.formatUnionStoreKey(query.Filters[0], "old")
+	mr.Client.SAdd(Ctx, ambiguous, "member")
+	deleted, err := mr.SweepTempKeys()
+	if err != nil || deleted != int64(len(leaked)) {
+		t.Fatalf("Expected %d swept keys, got %d %v", len(leaked), deleted, err)
+	}
+	n, err := mr.Client.Exists(Ctx, leaked...).Result()
+	if err != nil || n != 0 {
+		t.Fatalf("Expected leaked keys to be deleted, got %d %v", n, err)
+	}
+	// unionstore keys can't be told apart from the filter keys of the unionstore column, they are kept
+	n, err = mr.Client.Exists(Ctx, table.formatFilterKey("unionstore", "a"), ambiguous).Result()
+	if err != nil || n != 2 {
+		t.Fatalf("Expected filter key of unionstore column to be kept, got %d %v", n, err)
+	}
+	n, err = mr.Client.Exists(Ctx, keys...).Result()
+	if err != nil || n != int64(len(keys)) {
+		t.Fatalf("Expected keys with a ttl to be kept, got %d %v", n, err)
+	}
+}
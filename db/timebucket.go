@@ -0,0 +1,340 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Intervals of time buckets, weeks start on monday, buckets are in UTC
+const (
+	BucketHour  = "hour"
+	BucketDay   = "day"
+	BucketWeek  = "week"
+	BucketMonth = "month"
+)
+
+const (
+	// Most buckets a time series can be gap filled to
+	MaxTimeBuckets = 10000
+
+	// Default strptime format of date columns
+	DefaultBucketFormat = "%Y-%m-%d"
+)
+
+// Groups records by the time bucket of a column, as well as by the group by columns
+// int and float columns are seconds since the epoch, date columns are parsed with Format (strptime style)
+// The series are gap filled from Start to End, or from their first to last bucket, with empty buckets
+type TimeBucket struct {
+	Col      string `json:"col"`
+	Interval string `json:"interval"`
+	Format   string `json:"format"`
+	As       string `json:"as"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+}
+
+// Go layouts of the strptime directives supported in formats
+var strptimeLayouts = map[byte]string{
+	'Y': "2006",
+	'm': "01",
+	'd': "02",
+	'H': "15",
+	'M': "04",
+	'S': "05",
+	'z': "-0700",
+	'Z': "MST",
+	'%': "%",
+}
+
+// Returns the Go layout of a strptime format
+func strptimeToLayout(format string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			sb.WriteByte(format[i])
+			continue
+		}
+		i++
+		if i == len(format) {
+			return "", aggregationError("format %s ends with %%", format)
+		}
+		layout, ok := strptimeLayouts[format[i]]
+		if !ok {
+			return "", aggregationError("unsupported directive %%%c in format %s", format[i], format)
+		}
+		sb.WriteString(layout)
+	}
+	return sb.String(), nil
+}
+
+// Returns the name of the bucket output
+func (b *TimeBucket) name() string {
+	if b.As != "" {
+		return b.As
+	}
+	return "bucket"
+}
+
+func (b *TimeBucket) format() string {
+	if b.Format != "" {
+		return b.Format
+	}
+	return DefaultBucketFormat
+}
+
+// Returns the start of the bucket of t
+func (b *TimeBucket) truncate(t time.Time) time.Time {
+	t = t.UTC()
+	switch b.Interval {
+	case BucketHour:
+		return t.Truncate(time.Hour)
+	case BucketWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case BucketMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Returns the start of the bucket after the bucket starting at t
+func (b *TimeBucket) next(t time.Time) time.Time {
+	switch b.Interval {
+	case BucketHour:
+		return t.Add(time.Hour)
+	case BucketWeek:
+		return t.AddDate(0, 0, 7)
+	case BucketMonth:
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// Parses a value of the bucket column, numbers are seconds since the epoch
+func (b *TimeBucket) parse(col *Column, val string) (time.Time, error) {
+	if numericDataType(col.DataType) {
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(int64(f), 0).UTC(), nil
+	}
+	layout, err := strptimeToLayout(b.format())
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(layout, val)
+}
+
+// Parses the start or end of the series, given in the bucket column's format or as RFC3339
+func (b *TimeBucket) parseBound(col *Column, val string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, val); err == nil {
+		return t, nil
+	}
+	return b.parse(col, val)
+}
+
+// Validates the bucket column, interval, format and gap filling range
+// outputs are the names already taken by the aggregation
+func (schema *Schema) validateTimeBucket(b *TimeBucket, outputs map[string]bool) error {
+	col, err := schema.getColumn(b.Col)
+	if err != nil {
+		return aggregationError(err.Error())
+	}
+	if !numericDataType(col.DataType) && col.DataType != "date" {
+		return aggregationError("can't bucket column %s, it must be an int, float or date", b.Col)
+	}
+	switch b.Interval {
+	case BucketHour, BucketDay, BucketWeek, BucketMonth:
+	default:
+		return aggregationError("invalid interval %s, must be %s, %s, %s or %s", b.Interval, BucketHour, BucketDay, BucketWeek, BucketMonth)
+	}
+	if b.Format != "" {
+		if numericDataType(col.DataType) {
+			return aggregationError("format is only valid for date columns")
+		}
+		if _, err := strptimeToLayout(b.Format); err != nil {
+			return err
+		}
+	}
+	if outputs[b.name()] {
+		return aggregationError("output %s is given more than once", b.name())
+	}
+
+	var start, end time.Time
+	if b.Start != "" {
+		if start, err = b.parseBound(col, b.Start); err != nil {
+			return aggregationError("invalid start %s", b.Start)
+		}
+	}
+	if b.End != "" {
+		if end, err = b.parseBound(col, b.End); err != nil {
+			return aggregationError("invalid end %s", b.End)
+		}
+	}
+	if b.Start != "" && b.End != "" {
+		if end.Before(start) {
+			return aggregationError("end %s is before start %s", b.End, b.Start)
+		}
+		if n := countBuckets(b, start, end); n > MaxTimeBuckets {
+			return aggregationError("%d buckets between start and end, at most %d can be filled", n, MaxTimeBuckets)
+		}
+	}
+	return nil
+}
+
+// Returns the number of buckets from the bucket of start through the bucket of end, up to MaxTimeBuckets+1
+func countBuckets(b *TimeBucket, start, end time.Time) int {
+	n := 0
+	for t := b.truncate(start); !t.After(end) && n <= MaxTimeBuckets; t = b.next(t) {
+		n++
+	}
+	return n
+}
+
+// Returns the APPLY expression of the bucket of the column, a unix timestamp
+func (b *TimeBucket) applyExpression(col *Column) string {
+	t := "@" + col.Name
+	if !numericDataType(col.DataType) {
+		t = fmt.Sprintf("parsetime(@%s, \"%s\")", col.Name, b.format())
+	}
+	switch b.Interval {
+	case BucketHour:
+		return fmt.Sprintf("hour(%s)", t)
+	case BucketWeek:
+		return fmt.Sprintf("day(%s) - ((dayofweek(%s) + 6) %% 7) * 86400", t, t)
+	case BucketMonth:
+		return fmt.Sprintf("month(%s)", t)
+	}
+	return fmt.Sprintf("day(%s)", t)
+}
+
+// Returns the value of a reducer for a bucket without records
+func emptyReducerValue(r *Reducer) string {
+	switch r.Op {
+	case ReduceCount, ReduceCountDistinct, ReduceSum:
+		return "0"
+	}
+	return ""
+}
+
+// Gap fills the series of aggregated rows and formats their buckets as RFC3339
+// Rows hold their bucket as a unix timestamp, each combination of group by values is a series
+// Rows without a bucket, where the column is null or could not be parsed, are dropped
+// At most MaxTimeBuckets buckets are filled across all the series
+func fillTimeBuckets(rows []map[string]string, aggReq *AggRequest, col *Column) ([]map[string]string, error) {
+	b := aggReq.Bucket
+	name := b.name()
+
+	type series struct {
+		group   map[string]string
+		buckets map[int64]map[string]string
+	}
+	all := make(map[string]*series)
+	order := make([]string, 0)
+	var first, last time.Time
+	for _, row := range rows {
+		f, err := strconv.ParseFloat(row[name], 64)
+		if err != nil {
+			continue
+		}
+		t := time.Unix(int64(f), 0).UTC()
+		if first.IsZero() || t.Before(first) {
+			first = t
+		}
+		if last.IsZero() || t.After(last) {
+			last = t
+		}
+
+		vals := make([]*string, len(aggReq.Groupby))
+		group := make(map[string]string, len(aggReq.Groupby))
+		for i, g := range aggReq.Groupby {
+			if v, ok := row[g]; ok {
+				vals[i] = &v
+				group[g] = v
+			}
+		}
+		key := aggGroupKey(vals)
+		s, ok := all[key]
+		if !ok {
+			s = &series{group: group, buckets: make(map[int64]map[string]string)}
+			all[key] = s
+			order = append(order, key)
+		}
+		s.buckets[t.Unix()] = row
+	}
+
+	if b.Start != "" {
+		first, _ = b.parseBound(col, b.Start)
+	}
+	if b.End != "" {
+		last, _ = b.parseBound(col, b.End)
+	}
+	if len(all) == 0 && len(aggReq.Groupby) == 0 && b.Start != "" && b.End != "" {
+		// a series without records is still filled between start and end
+		all[""] = &series{group: map[string]string{}, buckets: map[int64]map[string]string{}}
+		order = append(order, "")
+	}
+	if len(all) == 0 {
+		return make([]map[string]string, 0), nil
+	}
+	n := countBuckets(b, first, last)
+	if n > MaxTimeBuckets {
+		return nil, aggregationError("more than %d buckets from %s to %s, set start and end", MaxTimeBuckets,
+			first.Format(time.RFC3339), last.Format(time.RFC3339))
+	}
+	if n*len(order) > MaxTimeBuckets {
+		return nil, aggregationError("%d series of %d buckets, at most %d buckets can be filled", len(order), n, MaxTimeBuckets)
+	}
+
+	filled := make([]map[string]string, 0, n*len(order))
+	for _, key := range order {
+		s := all[key]
+		for t := b.truncate(first); !t.After(last); t = b.next(t) {
+			row, ok := s.buckets[t.Unix()]
+			if !ok {
+				row = make(map[string]string, len(s.group)+len(aggReq.reducers())+1)
+				for g, v := range s.group {
+					row[g] = v
+				}
+				for _, r := range aggReq.reducers() {
+					row[r.name()] = emptyReducerValue(&r)
+				}
+			}
+			row[name] = t.Format(time.RFC3339)
+			filled = append(filled, row)
+		}
+	}
+	return filled, nil
+}
+
+// Gap fills the time series of the aggregated rows, then applies the having conditions, order by and limit
+func (table *Table) finishTimeBuckets(rows []map[string]string, aggReq *AggRequest) ([]map[string]string, error) {
+	col, err := table.Schema.getColumn(aggReq.Bucket.Col)
+	if err != nil {
+		return nil, err
+	}
+	filled, err := fillTimeBuckets(rows, aggReq, col)
+	if err != nil {
+		return nil, err
+	}
+	return finishAggregation(filled, aggReq), nil
+}
+
+// Returns the bucket of a value of the column as a unix timestamp, nil for nulls and values that can't be parsed
+func (b *TimeBucket) bucketValue(col *Column, val *string) *string {
+	if val == nil {
+		return nil
+	}
+	t, err := b.parse(col, *val)
+	if err != nil {
+		return nil
+	}
+	s := strconv.FormatInt(b.truncate(t).Unix(), 10)
+	return &s
+}
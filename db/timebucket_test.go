@@ -0,0 +1,174 @@
+// Copyright 2023 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package db
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTimeBucketAggregation(t *testing.T) {
+	mr := newMiniRedis(t)
+	schema := Schema{
+		Name: "orders",
+		Columns: []Column{
+			{Name: "region", DataType: "string", Filterable: true},
+			{Name: "created", DataType: "date", Filterable: true, Nullable: true},
+			{Name: "ts", DataType: "int", Filterable: true, Sortable: true},
+			{Name: "amount", DataType: "float", Filterable: true, Sortable: true},
+		},
+	}
+	err := mr.AddSchema(&schema)
+	if err != nil {
+		t.Fatalf("Failed adding schema %s\n", err)
+	}
+	// 2023-01-02 is a monday
+	csv := "region,created,ts,amount\n" +
+		"EMEA,2023-01-02,1672617600,10\n" +
+		"EMEA,2023-01-02,1672621200,30\n" +
+		"AMER,2023-01-04,1672790400,5\n" +
+		"EMEA,2023-01-16,1673827200,20\n" +
+		"AMER,,1673827200,1\n"
+	err = mr.BulkLoad("orders", strings.NewReader(csv), "csv")
+	if err != nil {
+		t.Fatalf("Failed loading data %s\n", err)
+	}
+
+	// days are gap filled between start and end, nulls are left out
+	aggReq := AggRequest{
+		Bucket:   &TimeBucket{Col: "created", Interval: BucketDay, Start: "2023-01-01", End: "2023-01-04"},
+		Reducers: []Reducer{{Op: ReduceCount}, {Op: ReduceAvg, Col: "amount"}},
+	}
+	res, err := mr.AggregateData("orders", aggReq)
+	if err != nil {
+		t.Fatalf("Failed aggregating %s\n", err)
+	}
+	expected := []map[string]string{
+		{"bucket": "2023-01-01T00:00:00Z", "count": "0", "avg_amount": ""},
+		{"bucket": "2023-01-02T00:00:00Z", "count": "2", "avg_amount": "20"},
+		{"bucket": "2023-01-03T00:00:00Z", "count": "0", "avg_amount": ""},
+		{"bucket": "2023-01-04T00:00:00Z", "count": "1", "avg_amount": "5"},
+	}
+	if !reflect.DeepEqual(res, expected) {
+		t.Fatalf("Expected %v, got %v", expected, res)
+	}
+
+	// weeks of epoch seconds, a series per group
+	aggReq = AggRequest{
+		Groupby:  []string{"region"},
+		Bucket:   &TimeBucket{Col: "ts", Interval: BucketWeek, As: "week"},
+		Reducers: []Reducer{{Op: ReduceSum, Col: "amount", As: "total"}},
+		OrderBy:  []OrderBy{{Col: "region"}, {Col: "week"}},
+	}
+	res, err = mr.AggregateData("orders", aggReq)
+	if err != nil {
+		t.Fatalf("Failed aggregating %s\n", err)
+	}
+	expected = []map[string]string{
+		{"region": "AMER", "week": "2023-01-02T00:00:00Z", "total": "5"},
+		{"region": "AMER", "week": "2023-01-09T00:00:00Z", "total": "0"},
+		{"region": "AMER", "week": "2023-01-16T00:00:00Z", "total": "1"},
+		{"region": "EMEA", "week": "2023-01-02T00:00:00Z", "total": "40"},
+		{"region": "EMEA", "week": "2023-01-09T00:00:00Z", "total": "0"},
+		{"region": "EMEA", "week": "2023-01-16T00:00:00Z", "total": "20"},
+	}
+	if !reflect.DeepEqual(res, expected) {
+		t.Fatalf("Expected %v, got %v", expected, res)
+	}
+
+	// having and limit apply to the filled series
+	aggReq = AggRequest{
+		Bucket:   &TimeBucket{Col: "ts", Interval: BucketHour},
+		Reducers: []Reducer{{Op: ReduceCount}},
+		Having:   []Filter{{Col: "count", Op: EqualTo, Val: []string{"0"}}},
+		Limit:    1,
+	}
+	res, err = mr.AggregateData("orders", aggReq)
+	if err != nil {
+		t.Fatalf("Failed aggregating %s\n", err)
+	}
+	expected = []map[string]string{{"bucket": "2023-01-02T02:00:00Z", "count": "0"}}
+	if !reflect.DeepEqual(res, expected) {
+		t.Fatalf("Expected %v, got %v", expected, res)
+	}
+
+	invalid := []TimeBucket{
+		{Col: "region", Interval: BucketDay},
+		{Col: "created", Interval: "year"},
+		{Col: "created", Interval: BucketDay, Format: "%Q"},
+		{Col: "ts", Interval: BucketDay, Format: "%Y"},
+		{Col: "created", Interval: BucketDay, As: "count"},
+		{Col: "created", Interval: BucketDay, As: "day of year"},
+		{Col: "created", Interval: BucketDay, Start: "2023-02-01", End: "2023-01-01"},
+		{Col: "created", Interval: BucketHour, Start: "2000-01-01", End: "2023-01-01"},
+	}
+	for _, b := range invalid {
+		b := b
+		_, err = mr.AggregateData("orders", AggRequest{Bucket: &b, Reducers: []Reducer{{Op: ReduceCount}}})
+		if _, ok := err.(*AggregationError); !ok {
+			t.Fatalf("Expected an aggregation error for %v, got %v", b, err)
+		}
+	}
+}
+
+func TestTimeBucketAggregateArgs(t *testing.T) {
+	table := Table{Schema: Schema{
+		Name: "orders",
+		Columns: []Column{
+			{Name: "region", DataType: "string", Filterable: true},
+			{Name: "created", DataType: "date", Filterable: true},
+		},
+	}}
+	aggReq := AggRequest{
+		Groupby:  []string{"region"},
+		Bucket:   &TimeBucket{Col: "created", Interval: BucketWeek, Format: "%Y-%m-%dT%H:%M:%S"},
+		Reducers: []Reducer{{Op: ReduceCount}},
+		Limit:    5,
+	}
+	args, err := table.aggregateArgs(&aggReq)
+	if err != nil {
+		t.Fatalf("Failed building args %s\n", err)
+	}
+	expected := []any{
+		"FT.AGGREGATE", table.formatTableIndex(), "*",
+		"LOAD", 1, "@created",
+		"APPLY", `day(parsetime(@created, "%Y-%m-%dT%H:%M:%S")) - ((dayofweek(parsetime(@created, "%Y-%m-%dT%H:%M:%S")) + 6) % 7) * 86400`, "AS", "bucket",
+		"GROUPBY", 2, "@region", "@bucket",
+		"REDUCE", "COUNT", 0, "AS", "count",
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Fatalf("Expected %v, got %v", expected, args)
+	}
+}
+
+func TestFillTimeBucketsLimit(t *testing.T) {
+	col := &Column{Name: "ts", DataType: "int", Filterable: true, Sortable: true}
+	// 2000-01-01 and 2023-01-01, filling formats the buckets of the rows so each fill gets new rows
+	rows := func() []map[string]string {
+		return []map[string]string{
+			{"region": "EMEA", "bucket": "946684800", "count": "1"},
+			{"region": "AMER", "bucket": "1672531200", "count": "1"},
+		}
+	}
+
+	// without start and end the range of the rows is checked
+	aggReq := AggRequest{Bucket: &TimeBucket{Col: "ts", Interval: BucketHour}, Reducers: []Reducer{{Op: ReduceCount}}}
+	_, err := fillTimeBuckets(rows(), &aggReq, col)
+	if _, ok := err.(*AggregationError); !ok {
+		t.Fatalf("Expected an aggregation error for too many buckets, got %v", err)
+	}
+
+	// 8402 days fit in one series but not in two
+	aggReq.Bucket.Interval = BucketDay
+	_, err = fillTimeBuckets(rows(), &aggReq, col)
+	if err != nil {
+		t.Fatalf("Failed filling buckets %s\n", err)
+	}
+	aggReq.Groupby = []string{"region"}
+	_, err = fillTimeBuckets(rows(), &aggReq, col)
+	if _, ok := err.(*AggregationError); !ok {
+		t.Fatalf("Expected an aggregation error for too many buckets across series, got %v", err)
+	}
+}
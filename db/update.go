@@ -18,24 +18,32 @@ func (db *Database) updateFilterableRecordToPipe(table Table, pipe *redis.Pipeli
 	if err != nil {
 		return err
 	}
-	oldVal := (*record)[col]
-
-	// remove key from old filter set
-	(*pipe).SRem(Ctx, table.formatFilterKey(col, oldVal), key)
+	// remove key from old filter set, or from the null set if there was no value
+	if oldVal, ok := (*record)[col]; ok {
+		(*pipe).SRem(Ctx, table.formatFilterKey(col, oldVal), key)
+	} else {
+		(*pipe).SRem(Ctx, table.formatNullKey(col), key)
+	}
 
 	// add key to new filter set
 	(*pipe).SAdd(Ctx, table.formatFilterKey(col, val), key)
+	(*pipe).ZAdd(Ctx, table.formatValuesKey(col), redis.Z{Member: val})
 
 	// If sortable we need to also add that to the sorted set
-	sortable, err := table.Schema.isSortable(col)
+	column, err := table.Schema.getColumn(col)
 	if err != nil {
 		return err
 	}
-	if sortable {
-		err = addSortableValToPipe(table, pipe, table.formatFilterKey(col, val), col, val)
+	if column.Sortable {
+		err = addSortableValToPipe(table, pipe, table.formatFilterKey(col, val), column, val)
 		if err != nil {
 			return err
 		}
+		err = addOrderValToPipe(table, pipe, key, column, val)
+		if err != nil {
+			return err
+		}
+		invalidateStringOrderToPipe(table, pipe, column)
 	}
 	return nil
 }
@@ -59,6 +67,7 @@ func (db *Database) updateRecords(table Table, keys []string, values map[string]
 			pipe.HSet(Ctx, key, col, val)
 		}
 	}
+	invalidateQueryCacheToPipe(table, &pipe)
 	_, err := pipe.Exec(Ctx)
 	return err
 }
@@ -80,6 +89,22 @@ func (db *Database) UpdateData(tableName string, query Query) error {
 		return err
 	}
 
+	// Every matching record gets the same values, so they are only checked once
+	checker, err := newConstraintChecker(&table.Schema)
+	if err != nil {
+		return err
+	}
+	for i := range table.Schema.Columns {
+		col := &table.Schema.Columns[i]
+		if val, ok := query.Updates[col.Name]; ok {
+			checker.check(0, "", col, val, false)
+		}
+	}
+	err = checker.errs.err()
+	if err != nil {
+		return err
+	}
+
 	// Get all matching recordkeys
 	recordKeys, _, err := db.getRecordKeys(table, query)
 
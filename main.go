@@ -12,6 +12,7 @@ import (
 	"os"
 	"rdb/db"
 	"strconv"
+	"strings"
 
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
@@ -43,6 +44,14 @@ func main() {
 	}
 	InfoLog.Println("succesfully connected to redis")
 
+	// clean up temporary query keys leaked before they were expired
+	deleted, err := database.SweepTempKeys()
+	if err != nil {
+		WarningLog.Printf("failed sweeping temporary keys: %s", err.Error())
+	} else {
+		InfoLog.Printf("swept %d leaked temporary keys\n", deleted)
+	}
+
 	router := initRouter(database)
 	router.Run(getServerAddr())
 }
@@ -55,7 +64,15 @@ func initRouter(database *db.Database) *gin.Engine {
 		// TODO needs to be a primary key
 		// If no primary key, it can't be transactional (full load only)
 		var schema db.Schema
-		err := c.ShouldBindJSON(&schema)
+		var err error
+
+		// Schemas can also be imported from sql, avro and jsonschema definitions
+		format := c.DefaultQuery("format", "json")
+		if format == "json" {
+			err = c.ShouldBindJSON(&schema)
+		} else {
+			schema, err = importSchema(c, format)
+		}
 		if err != nil {
 			ErrorLog.Println("error binding json to schema: ", err.Error())
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -72,6 +89,37 @@ func initRouter(database *db.Database) *gin.Engine {
 
 		c.JSON(http.StatusOK, gin.H{"schema": schema})
 	})
+	router.POST("/api/v1/schema/infer", func(c *gin.Context) {
+		name := c.Query("name")
+		if name == "" {
+			ErrorLog.Println("error inferring schema: missing name")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "parameter 'name' is required"})
+			return
+		}
+		format := c.DefaultQuery("format", "csv")
+		InfoLog.Printf("inferring %s schema for %s\n", format, name)
+
+		schema, err := db.InferSchema(name, c.Request.Body, format, c.Query("nullToken"))
+		if err != nil {
+			ErrorLog.Println("error inferring schema: ", err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// optionally add the inferred schema
+		if c.Query("create") == "true" {
+			err = database.AddSchema(schema)
+			if err != nil {
+				ErrorLog.Println("error adding schema: ", err.Error())
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			InfoLog.Printf("successfully added schema for %s\n", schema.Name)
+		}
+
+		InfoLog.Printf("successfully inferred schema for %s\n", schema.Name)
+		c.JSON(http.StatusOK, gin.H{"schema": schema})
+	})
 	router.GET("/api/v1/schema/:table", func(c *gin.Context) {
 		table := c.Param("table")
 		InfoLog.Printf("retrieving schema for %s\n", table)
@@ -106,13 +154,127 @@ func initRouter(database *db.Database) *gin.Engine {
 		InfoLog.Println("successfully retrieved all schemas")
 		c.JSON(http.StatusOK, gin.H{"schemas": schemas})
 	})
+	router.GET("/api/v1/aliases", func(c *gin.Context) {
+		InfoLog.Println("retrieving all aliases")
+
+		aliases, err := database.GetAllAliases()
+		if err != nil {
+			ErrorLog.Println("error retrieving all aliases:", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		InfoLog.Println("successfully retrieved all aliases")
+		c.JSON(http.StatusOK, gin.H{"aliases": aliases})
+	})
+	router.GET("/api/v1/aliases/:name", func(c *gin.Context) {
+		name := c.Param("name")
+		InfoLog.Printf("retrieving alias %s\n", name)
+
+		alias, err := database.GetAlias(name)
+		if err != nil {
+			if err == db.ErrNil {
+				ErrorLog.Printf("error: no alias %s\n", name)
+				c.JSON(http.StatusNotFound, gin.H{"error": "No alias found for " + name})
+				return
+			}
+			ErrorLog.Printf("error retrieving alias %s: %s\n", name, err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		InfoLog.Printf("successfully retrieved alias %s\n", name)
+		c.JSON(http.StatusOK, gin.H{"alias": alias})
+	})
+	router.PUT("/api/v1/aliases/:name", func(c *gin.Context) {
+		name := c.Param("name")
+		var req db.AliasRequest
+		err := c.ShouldBindJSON(&req)
+		if err != nil {
+			ErrorLog.Println("error binding json to alias: ", err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err = database.AddAlias(name, req.Table)
+		if err != nil {
+			ErrorLog.Println("error adding alias: ", err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		InfoLog.Printf("successfully added alias %s for %s\n", name, req.Table)
+		c.JSON(http.StatusOK, gin.H{"alias": db.Alias{Name: name, Table: req.Table}})
+	})
+	router.POST("/api/v1/aliases/:name/swap", func(c *gin.Context) {
+		name := c.Param("name")
+		var req db.AliasRequest
+		err := c.ShouldBindJSON(&req)
+		if err != nil {
+			ErrorLog.Println("error binding json to alias: ", err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		previous, err := database.SwapAlias(name, req.Table, req.Expected)
+		if err != nil {
+			if err == db.ErrNil {
+				ErrorLog.Printf("error: no alias %s\n", name)
+				c.JSON(http.StatusNotFound, gin.H{"error": "No alias found for " + name})
+				return
+			}
+			ErrorLog.Println("error swapping alias: ", err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		InfoLog.Printf("successfully swapped alias %s from %s to %s\n", name, previous, req.Table)
+		c.JSON(http.StatusOK, gin.H{
+			"alias":    db.Alias{Name: name, Table: req.Table},
+			"previous": previous,
+		})
+	})
+	router.DELETE("/api/v1/aliases/:name", func(c *gin.Context) {
+		name := c.Param("name")
+
+		err := database.DeleteAlias(name)
+		if err != nil {
+			if err == db.ErrNil {
+				ErrorLog.Printf("error: no alias %s\n", name)
+				c.JSON(http.StatusNotFound, gin.H{"error": "No alias found for " + name})
+				return
+			}
+			ErrorLog.Println("error deleting alias: ", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		InfoLog.Printf("successfully deleted alias %s\n", name)
+		c.JSON(http.StatusOK, gin.H{"Status": "Successfully deleted alias"})
+	})
+	router.POST("/api/v1/admin/sweep", func(c *gin.Context) {
+		deleted, err := database.SweepTempKeys()
+		if err != nil {
+			ErrorLog.Println("error sweeping temporary keys: ", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		InfoLog.Printf("successfully swept %d temporary keys\n", deleted)
+		c.JSON(http.StatusOK, gin.H{"deleted": deleted})
+	})
 	router.POST("/api/v1/schema/:table/load", func(c *gin.Context) {
 		table := c.Param("table")
 		InfoLog.Printf("Loading data for %s\n", table)
 
-		err := database.BulkLoad(table, c.Request.Body, "csv")
+		// cells matching the null token are loaded as null, defaults to the empty string
+		opts := db.LoadOptions{NullToken: c.Query("nullToken")}
+
+		err := database.BulkLoadWithOptions(table, c.Request.Body, "csv", opts)
 		if err != nil {
 			ErrorLog.Println("error loading data:", err.Error())
+			if writeViolations(c, err) {
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -144,12 +306,29 @@ func initRouter(database *db.Database) *gin.Engine {
 		query.Limit = pageLimit
 		query.Offset = pageOffset
 
+		// columns can also be given as a comma separated parameter
+		if columns := getListParam(c, "columns"); len(columns) > 0 {
+			query.Columns = columns
+		}
+
+		// scrolls can also be started and continued with parameters
+		if c.Query("scroll") == "true" {
+			query.Scroll = true
+		}
+		if cursor := c.Query("cursor"); cursor != "" {
+			query.Cursor = cursor
+		}
+
 		// Get data for table
 		table := c.Param("table")
 		InfoLog.Printf("Getting data for %s\n", table)
 		getDataResp, err := database.GetData(table, query)
 		if err != nil {
 			ErrorLog.Println("error retreiving data:", err.Error())
+			if err == db.ErrInvalidCursor {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -162,6 +341,129 @@ func initRouter(database *db.Database) *gin.Engine {
 		InfoLog.Println("successfully retrieved all data")
 		c.JSON(http.StatusOK, resp)
 	})
+	router.GET("/api/v1/schema/:table/count", func(c *gin.Context) {
+		var query db.Query
+		err := c.ShouldBindJSON(&query)
+		if err != nil && err != io.EOF {
+			ErrorLog.Println("error binding json to query: ", err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		table := c.Param("table")
+		count, err := database.CountData(table, query)
+		if err != nil {
+			ErrorLog.Println("error counting data:", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		InfoLog.Printf("successfully counted %d records for %s\n", count, table)
+		c.JSON(http.StatusOK, gin.H{"count": count})
+	})
+	router.GET("/api/v1/schema/:table/exists", func(c *gin.Context) {
+		var query db.Query
+		err := c.ShouldBindJSON(&query)
+		if err != nil && err != io.EOF {
+			ErrorLog.Println("error binding json to query: ", err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		table := c.Param("table")
+		exists, err := database.ExistsData(table, query)
+		if err != nil {
+			ErrorLog.Println("error checking data:", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		InfoLog.Printf("successfully checked records for %s\n", table)
+		c.JSON(http.StatusOK, gin.H{"exists": exists})
+	})
+	router.GET("/api/v1/schema/:table/facets", func(c *gin.Context) {
+		col := c.Query("col")
+		if col == "" {
+			ErrorLog.Println("error getting facets: missing col parameter")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "col parameter is required"})
+			return
+		}
+		var query db.Query
+		err := c.ShouldBindJSON(&query)
+		if err != nil && err != io.EOF {
+			ErrorLog.Println("error binding json to query: ", err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		table := c.Param("table")
+		facets, err := database.GetFacets(table, col, query)
+		if err != nil {
+			ErrorLog.Println("error getting facets:", err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		InfoLog.Printf("successfully retrieved facets of %s for %s\n", col, table)
+		c.JSON(http.StatusOK, facets)
+	})
+	router.GET("/api/v1/schema/:table/stats", func(c *gin.Context) {
+		version := -1
+		if v := c.Query("version"); v != "" {
+			var err error
+			version, err = strconv.Atoi(v)
+			if err != nil || version < 0 {
+				ErrorLog.Println("error getting table stats: invalid version parameter", v)
+				c.JSON(http.StatusBadRequest, gin.H{"error": "version must be an integer >= 0"})
+				return
+			}
+		}
+
+		table := c.Param("table")
+		profile, err := database.GetTableProfile(table, version)
+		if err != nil {
+			ErrorLog.Println("error getting table stats:", err.Error())
+			if err == db.ErrNil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "No stats found for " + table})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		InfoLog.Printf("successfully retrieved stats for %s\n", table)
+		c.JSON(http.StatusOK, profile)
+	})
+	router.GET("/api/v1/schema/:table/stats/:col", func(c *gin.Context) {
+		buckets := 0
+		if b := c.Query("buckets"); b != "" {
+			var err error
+			buckets, err = strconv.Atoi(b)
+			if err != nil {
+				ErrorLog.Println("error getting stats: invalid buckets parameter", b)
+				c.JSON(http.StatusBadRequest, gin.H{"error": "buckets must be an integer"})
+				return
+			}
+		}
+		var query db.Query
+		err := c.ShouldBindJSON(&query)
+		if err != nil && err != io.EOF {
+			ErrorLog.Println("error binding json to query: ", err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		table, col := c.Param("table"), c.Param("col")
+		stats, err := database.GetNumericStats(table, col, query, buckets)
+		if err != nil {
+			ErrorLog.Println("error getting stats:", err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		InfoLog.Printf("successfully retrieved stats of %s for %s\n", col, table)
+		c.JSON(http.StatusOK, stats)
+	})
 	router.PATCH("/api/v1/schema/:table/update", func(c *gin.Context) {
 		// Get filters and values from body
 		var query db.Query
@@ -179,6 +481,9 @@ func initRouter(database *db.Database) *gin.Engine {
 		err = database.UpdateData(table, query)
 		if err != nil {
 			ErrorLog.Println("error updating data:", err.Error())
+			if writeViolations(c, err) {
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -201,6 +506,11 @@ func initRouter(database *db.Database) *gin.Engine {
 		response, err := database.AggregateData(tableName, aggRequest)
 		if err != nil {
 			ErrorLog.Println("error in performing aggregation:", err.Error())
+			var aerr *db.AggregationError
+			if errors.As(err, &aerr) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -209,11 +519,45 @@ func initRouter(database *db.Database) *gin.Engine {
 		c.JSON(http.StatusOK, gin.H{"records": response})
 	})
 
+	// runs a SELECT statement, see the SQL section of the README for what is supported
+	router.POST("/api/v1/sql", func(c *gin.Context) {
+		var body struct {
+			Query string `json:"query" binding:"required"`
+		}
+		err := c.BindJSON(&body)
+		if err != nil {
+			ErrorLog.Println("error binding json to sql query: ", err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		InfoLog.Printf("Running sql %s\n", body.Query)
+		response, err := database.QuerySQL(body.Query)
+		if err != nil {
+			ErrorLog.Println("error running sql:", err.Error())
+			if writeSQLError(c, err) {
+				return
+			}
+			var aerr *db.AggregationError
+			if errors.As(err, &aerr) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
+	})
+
 	router.POST("/api/v1/schema/:table/record", func(c *gin.Context) {
 		tableName := c.Param("table")
 		recCount, err := database.CreateRecord(tableName, c.Request.Body)
 		if err != nil {
 			ErrorLog.Println("error in adding the record", err.Error())
+			if writeViolations(c, err) {
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -235,6 +579,9 @@ func initRouter(database *db.Database) *gin.Engine {
 		delRecCount, err := database.DeleteRecord(tableName, recGetDelRequest)
 		if err != nil {
 			ErrorLog.Println("error in deleting the record", err.Error())
+			if writeConditionError(c, err) {
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -256,6 +603,9 @@ func initRouter(database *db.Database) *gin.Engine {
 		response, err := database.GetRecord(tableName, getRecRequest)
 		if err != nil {
 			ErrorLog.Println("error in getting the record", err.Error())
+			if writeConditionError(c, err) {
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -276,6 +626,12 @@ func initRouter(database *db.Database) *gin.Engine {
 		updateRecCount, err := database.UpdateRecord(tableName, reqBody)
 		if err != nil {
 			ErrorLog.Println("error in updating the record", err.Error())
+			if writeViolations(c, err) {
+				return
+			}
+			if writeConditionError(c, err) {
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -288,6 +644,83 @@ func initRouter(database *db.Database) *gin.Engine {
 	return router
 }
 
+// Responds with a 400 and the violations if err is a constraint ValidationError
+// Returns false for any other error
+func writeViolations(c *gin.Context, err error) bool {
+	var verr *db.ValidationError
+	if !errors.As(err, &verr) {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":      err.Error(),
+		"total":      verr.Total,
+		"violations": verr.Violations,
+	})
+	return true
+}
+
+// Writes a 400 response if err is an invalid record condition
+// Returns true if the response was written
+func writeConditionError(c *gin.Context, err error) bool {
+	var cerr *db.ConditionError
+	if !errors.As(err, &cerr) {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":  err.Error(),
+		"column": cerr.Column,
+		"reason": cerr.Reason,
+	})
+	return true
+}
+
+// Writes a 400 response with the position of the error if err is an invalid SQL statement
+// Returns true if the response was written
+func writeSQLError(c *gin.Context, err error) bool {
+	var serr *db.SQLError
+	if !errors.As(err, &serr) {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":  err.Error(),
+		"pos":    serr.Pos,
+		"reason": serr.Reason,
+	})
+	return true
+}
+
+// Imports the request body as a schema definition in format
+// Column flags are given as comma separated lists in the filterable, sortable and searchable parameters
+func importSchema(c *gin.Context, format string) (db.Schema, error) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return db.Schema{}, err
+	}
+
+	opts := db.ImportOptions{
+		Name:       c.Query("name"),
+		Filterable: getListParam(c, "filterable"),
+		Sortable:   getListParam(c, "sortable"),
+		Searchable: getListParam(c, "searchable"),
+	}
+	schema, err := db.ImportSchema(body, format, opts)
+	if err != nil {
+		return db.Schema{}, err
+	}
+	return *schema, nil
+}
+
+// Returns a comma separated query parameter as a list, empty values are skipped
+func getListParam(c *gin.Context, name string) []string {
+	vals := make([]string, 0)
+	for _, v := range strings.Split(c.Query(name), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			vals = append(vals, v)
+		}
+	}
+	return vals
+}
+
 func getPaginationParams(params map[string][]string) (int, int, error) {
 	var limit, offset int
 	var err error